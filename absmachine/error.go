@@ -3,6 +3,7 @@ package absmachine
 const (
 	ErrorIconsistency = iota + 1
 	ErrorInvalidDirection
+	ErrorDuplicateId
 )
 
 type LowLevelOpsError struct {
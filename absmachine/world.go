@@ -47,29 +47,79 @@ const (
 	PC_Wizard
 )
 
+const NUM_CLASSES = 4
+
+type ClassStats struct {
+	Health int
+	Mana   int
+}
+
+// The stats a newly created character starts out with, indexed by class
+var StartingStats = [NUM_CLASSES]ClassStats{
+	// PC_Warrior = 0
+	{Health: 30, Mana: 0},
+	// PC_Thief = 1
+	{Health: 20, Mana: 5},
+	// PC_Cleric = 2
+	{Health: 15, Mana: 20},
+	// PC_Wizard = 3
+	{Health: 10, Mana: 30},
+}
+
+type ExitFlags uint32
+
+const (
+	EX_DOOR ExitFlags = 1 << iota
+	EX_PICKPROOF
+)
+
+// Details about an exit that is more than a plain passage to an adjacent room
+type ExitDetails struct {
+	Description string // What is seen when looking in the direction of the exit
+	Keywords    string // Words that refer to the door, e.g. "door wooden"
+	Flags       ExitFlags
+	KeyVNum     int // Virtual number of the object prototype that locks and unlocks the door, 0 if there is none
+}
+
 type Room struct {
+	VNum          int // Virtual number, a stable ID of the room
 	Title         string
 	Description   string
 	Players       []*Player
 	Mobs          []*Mob
 	Objects       []*Object
 	AdjacentRooms [NUM_DIR]*Room
+	ExitDetails   [NUM_DIR]*ExitDetails // nil for plain exits
 	World         *World
 }
 
 type Player struct {
-	Name        string
-	Description string
-	Room        *Room
-	World       *World
-	Health      int
-	Mana        int
-	Level       int
-	State       PlayerState
-	Class       PlayerClass
+	Name         string
+	Description  string
+	Room         *Room
+	World        *World
+	Health       int
+	Mana         int
+	Level        int
+	State        PlayerState
+	Class        PlayerClass
+	ColorTheme   map[string]string // The player's own markup for semantic tags, e.g. "error" to "$fg_red$"
+	SplitScreen  bool              // Output scrolls above a status bar and the prompt, on terminals that can do it
+	PromptFormat string            // What the prompt shows (see mudio.RenderPrompt), empty for the default prompt
+}
+
+// A mob prototype describes a kind of mob, and mobs (instances) are created from it
+type MobPrototype struct {
+	VNum            int // Virtual number, a stable ID of the prototype
+	Name            string
+	Description     string
+	RoomDescription string
+	Actions         []MobAction
 }
 
 type Mob struct {
+	Id              int           // Unique for every mob instance in a world
+	Prototype       *MobPrototype // The prototype the mob was created from (nil if it was created from scratch)
 	Name            string
 	Description     string
 	Room            *Room
@@ -89,14 +139,37 @@ type MobAction struct {
 }
 
 type World struct {
-	StartRoom *Room
-	Rooms     []*Room
-	Players   []*Player
-	Mobs      []*Mob
-	Objects   []*Object
+	StartRoom        *Room
+	Rooms            []*Room
+	Players          []*Player
+	Mobs             []*Mob
+	Objects          []*Object
+	MobPrototypes    map[int]*MobPrototype    // Indexed by VNum
+	ObjectPrototypes map[int]*ObjectPrototype // Indexed by VNum
+
+	// Indexes, kept consistent by the low level operations
+	roomsByVNum   map[int]*Room
+	mobsById      map[int]*Mob
+	objectsById   map[int]*Object
+	playersByName map[string]*Player   // Lower cased name -> player
+	mobsByName    map[string][]*Mob    // Lower cased name -> mobs
+	objectsByName map[string][]*Object // Lower cased name -> objects
+	nextRoomVNum  int
+	nextMobId     int
+	nextObjectId  int
+}
+
+// An object prototype describes a kind of object, and objects (instances) are created from it
+type ObjectPrototype struct {
+	VNum            int // Virtual number, a stable ID of the prototype
+	Name            string
+	Description     string
+	RoomDescription string
 }
 
 type Object struct {
+	Id              int              // Unique for every object instance in a world
+	Prototype       *ObjectPrototype // The prototype the object was created from (nil if it was created from scratch)
 	Name            string
 	Description     string
 	Room            *Room
@@ -112,6 +185,10 @@ type DirectionMovable interface {
 	Move(direction Direction) *LowLevelOpsError
 }
 
+func (ef ExitFlags) HasFlag(f ExitFlags) bool { return f&ef != 0 }
+func (ef *ExitFlags) SetFlag(f ExitFlags)     { *ef |= f }
+func (ef *ExitFlags) ClearFlag(f ExitFlags)   { *ef &= ^f }
+
 func (ps PlayerState) HasFlag(f PlayerState) bool { return f&ps != 0 }
 func (ps *PlayerState) SetFlag(f PlayerState)     { *ps |= f }
 func (ps *PlayerState) ClearFlag(f PlayerState)   { *ps &= ^f }
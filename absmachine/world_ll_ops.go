@@ -1,11 +1,15 @@
 package absmachine
 
 import (
-	"strings"
+	"fmt"
+
+	"github.com/jorgensigvardsson/gomud/charset"
 )
 
 func NewWorld() *World {
-	return &World{}
+	world := &World{}
+	world.ensureIndexes()
+	return world
 }
 
 func NewPlayer() *Player {
@@ -27,6 +31,92 @@ func NewObject() *Object {
 	return &Object{}
 }
 
+// Creates a new mob from a prototype. The mob gets its own copy of the prototype's actions.
+func NewMobFromPrototype(prototype *MobPrototype) *Mob {
+	return &Mob{
+		Prototype:       prototype,
+		Name:            prototype.Name,
+		Description:     prototype.Description,
+		RoomDescription: prototype.RoomDescription,
+		Actions:         append([]MobAction(nil), prototype.Actions...),
+	}
+}
+
+// Creates a new object from a prototype
+func NewObjectFromPrototype(prototype *ObjectPrototype) *Object {
+	return &Object{
+		Prototype:       prototype,
+		Name:            prototype.Name,
+		Description:     prototype.Description,
+		RoomDescription: prototype.RoomDescription,
+	}
+}
+
+// Worlds may be created as literals (typically in tests), so the indexes are created lazily
+func (world *World) ensureIndexes() {
+	if world.roomsByVNum != nil {
+		return
+	}
+
+	world.roomsByVNum = make(map[int]*Room)
+	world.mobsById = make(map[int]*Mob)
+	world.objectsById = make(map[int]*Object)
+	world.playersByName = make(map[string]*Player)
+	world.mobsByName = make(map[string][]*Mob)
+	world.objectsByName = make(map[string][]*Object)
+
+	// A world literal may come with rooms, mobs, objects and players, which must be found like the ones added later
+	for _, room := range world.Rooms {
+		if room.VNum != 0 {
+			world.roomsByVNum[room.VNum] = room
+		}
+		if room.VNum > world.nextRoomVNum {
+			world.nextRoomVNum = room.VNum
+		}
+	}
+
+	for _, mob := range world.Mobs {
+		if mob.Id != 0 {
+			world.mobsById[mob.Id] = mob
+		}
+		if mob.Id > world.nextMobId {
+			world.nextMobId = mob.Id
+		}
+		key := nameKey(mob.Name)
+		world.mobsByName[key] = append(world.mobsByName[key], mob)
+	}
+
+	for _, object := range world.Objects {
+		if object.Id != 0 {
+			world.objectsById[object.Id] = object
+		}
+		if object.Id > world.nextObjectId {
+			world.nextObjectId = object.Id
+		}
+		key := nameKey(object.Name)
+		world.objectsByName[key] = append(world.objectsByName[key], object)
+	}
+
+	for _, player := range world.Players {
+		if player.Name != "" {
+			world.playersByName[nameKey(player.Name)] = player
+		}
+	}
+
+	if world.MobPrototypes == nil {
+		world.MobPrototypes = make(map[int]*MobPrototype)
+	}
+
+	if world.ObjectPrototypes == nil {
+		world.ObjectPrototypes = make(map[int]*ObjectPrototype)
+	}
+}
+
+// Names are looked up regardless of case and accents
+func nameKey(name string) string {
+	return charset.Fold(name)
+}
+
 func DestroyPlayer(player *Player) {
 	if player.World == nil {
 		return
@@ -39,14 +129,32 @@ func DestroyPlayer(player *Player) {
 	removePlayerFromWorld(player.World, player)
 }
 
-func (world *World) HasPlayer(name string) bool {
-	for _, v := range world.Players {
-		if strings.EqualFold(v.Name, name) {
-			return true
-		}
+func DestroyMob(mob *Mob) {
+	if mob.World == nil {
+		return
 	}
 
-	return false
+	if mob.Room != nil {
+		removeMobFromRoom(mob.Room, mob)
+	}
+
+	removeMobFromWorld(mob.World, mob)
+}
+
+func DestroyObject(object *Object) {
+	if object.World == nil {
+		return
+	}
+
+	if object.Room != nil {
+		removeObjectFromRoom(object.Room, object)
+	}
+
+	removeObjectFromWorld(object.World, object)
+}
+
+func (world *World) HasPlayer(name string) bool {
+	return world.FindPlayerByName(name) != nil
 }
 
 // Adds a set of rooms to a world. None of the rooms may be associated with a world already!
@@ -60,10 +168,39 @@ func (world *World) AddRooms(rooms []*Room) *LowLevelOpsError {
 		}
 	}
 
+	// Are any of the virtual numbers already taken?
+	world.ensureIndexes()
+	vnums := make(map[int]bool, len(rooms))
+	for _, room := range rooms {
+		if room.VNum == 0 {
+			continue
+		}
+
+		if _, found := world.roomsByVNum[room.VNum]; found || vnums[room.VNum] {
+			return &LowLevelOpsError{errorCode: ErrorDuplicateId, message: fmt.Sprintf("Room virtual number %v is already in use!", room.VNum)}
+		}
+		vnums[room.VNum] = true
+	}
+
 	// Nope, let's go right ahead and add them!
 	world.Rooms = append(world.Rooms, rooms...)
 	for _, room := range rooms {
 		room.World = world
+		if room.VNum != 0 {
+			world.roomsByVNum[room.VNum] = room
+		}
+		if room.VNum > world.nextRoomVNum {
+			world.nextRoomVNum = room.VNum
+		}
+	}
+
+	// Rooms without a virtual number are given one that is not in use
+	for _, room := range rooms {
+		if room.VNum == 0 {
+			world.nextRoomVNum++
+			room.VNum = world.nextRoomVNum
+			world.roomsByVNum[room.VNum] = room
+		}
 	}
 	return nil
 }
@@ -79,10 +216,28 @@ func (world *World) AddPlayers(players []*Player) *LowLevelOpsError {
 		}
 	}
 
+	// Are any of the names already taken? Nameless players (not logged in yet) are not indexed.
+	world.ensureIndexes()
+	names := make(map[string]bool, len(players))
+	for _, player := range players {
+		if player.Name == "" {
+			continue
+		}
+
+		key := nameKey(player.Name)
+		if _, found := world.playersByName[key]; found || names[key] {
+			return &LowLevelOpsError{errorCode: ErrorDuplicateId, message: fmt.Sprintf("A player named %v is already in the world!", player.Name)}
+		}
+		names[key] = true
+	}
+
 	// Nope, let's go right ahead and add them!
 	world.Players = append(world.Players, players...)
 	for _, player := range players {
 		player.World = world
+		if player.Name != "" {
+			world.playersByName[nameKey(player.Name)] = player
+		}
 	}
 
 	return nil
@@ -99,10 +254,37 @@ func (world *World) AddMobs(mobs []*Mob) *LowLevelOpsError {
 		}
 	}
 
+	// Are any of the IDs already taken?
+	world.ensureIndexes()
+	ids := make(map[int]bool, len(mobs))
+	for _, mob := range mobs {
+		if mob.Id == 0 {
+			continue
+		}
+
+		if _, found := world.mobsById[mob.Id]; found || ids[mob.Id] {
+			return &LowLevelOpsError{errorCode: ErrorDuplicateId, message: fmt.Sprintf("Mob ID %v is already in use!", mob.Id)}
+		}
+		ids[mob.Id] = true
+	}
+
 	// Nope, let's go right ahead and add them!
 	world.Mobs = append(world.Mobs, mobs...)
 	for _, mob := range mobs {
 		mob.World = world
+		if mob.Id > world.nextMobId {
+			world.nextMobId = mob.Id
+		}
+	}
+
+	for _, mob := range mobs {
+		if mob.Id == 0 {
+			world.nextMobId++
+			mob.Id = world.nextMobId
+		}
+		world.mobsById[mob.Id] = mob
+		key := nameKey(mob.Name)
+		world.mobsByName[key] = append(world.mobsByName[key], mob)
 	}
 	return nil
 }
@@ -118,10 +300,81 @@ func (world *World) AddObjects(objects []*Object) *LowLevelOpsError {
 		}
 	}
 
+	// Are any of the IDs already taken?
+	world.ensureIndexes()
+	ids := make(map[int]bool, len(objects))
+	for _, object := range objects {
+		if object.Id == 0 {
+			continue
+		}
+
+		if _, found := world.objectsById[object.Id]; found || ids[object.Id] {
+			return &LowLevelOpsError{errorCode: ErrorDuplicateId, message: fmt.Sprintf("Object ID %v is already in use!", object.Id)}
+		}
+		ids[object.Id] = true
+	}
+
 	// Nope, let's go right ahead and add them!
 	world.Objects = append(world.Objects, objects...)
 	for _, object := range objects {
 		object.World = world
+		if object.Id > world.nextObjectId {
+			world.nextObjectId = object.Id
+		}
+	}
+
+	for _, object := range objects {
+		if object.Id == 0 {
+			world.nextObjectId++
+			object.Id = world.nextObjectId
+		}
+		world.objectsById[object.Id] = object
+		key := nameKey(object.Name)
+		world.objectsByName[key] = append(world.objectsByName[key], object)
+	}
+	return nil
+}
+
+// Adds a set of mob prototypes to a world. The virtual numbers must not be in use already!
+func (world *World) AddMobPrototypes(prototypes []*MobPrototype) *LowLevelOpsError {
+	world.ensureIndexes()
+
+	for i, prototype := range prototypes {
+		if _, found := world.MobPrototypes[prototype.VNum]; found {
+			return &LowLevelOpsError{errorCode: ErrorDuplicateId, message: fmt.Sprintf("Mob prototype virtual number %v is already in use!", prototype.VNum)}
+		}
+
+		for _, other := range prototypes[:i] {
+			if other.VNum == prototype.VNum {
+				return &LowLevelOpsError{errorCode: ErrorDuplicateId, message: fmt.Sprintf("Mob prototype virtual number %v is used more than once!", prototype.VNum)}
+			}
+		}
+	}
+
+	for _, prototype := range prototypes {
+		world.MobPrototypes[prototype.VNum] = prototype
+	}
+	return nil
+}
+
+// Adds a set of object prototypes to a world. The virtual numbers must not be in use already!
+func (world *World) AddObjectPrototypes(prototypes []*ObjectPrototype) *LowLevelOpsError {
+	world.ensureIndexes()
+
+	for i, prototype := range prototypes {
+		if _, found := world.ObjectPrototypes[prototype.VNum]; found {
+			return &LowLevelOpsError{errorCode: ErrorDuplicateId, message: fmt.Sprintf("Object prototype virtual number %v is already in use!", prototype.VNum)}
+		}
+
+		for _, other := range prototypes[:i] {
+			if other.VNum == prototype.VNum {
+				return &LowLevelOpsError{errorCode: ErrorDuplicateId, message: fmt.Sprintf("Object prototype virtual number %v is used more than once!", prototype.VNum)}
+			}
+		}
+	}
+
+	for _, prototype := range prototypes {
+		world.ObjectPrototypes[prototype.VNum] = prototype
 	}
 	return nil
 }
@@ -157,6 +410,10 @@ func (player *Player) RelocateToRoom(room *Room) *LowLevelOpsError {
 		return nil
 	}
 
+	if room.World != player.World {
+		return &LowLevelOpsError{errorCode: ErrorIconsistency, message: "Player and room belong to different worlds!"}
+	}
+
 	if player.Room != nil {
 		err := removePlayerFromRoom(player.Room, player)
 		if err != nil {
@@ -175,6 +432,10 @@ func (mob *Mob) RelocateToRoom(room *Room) *LowLevelOpsError {
 		return nil
 	}
 
+	if room.World != mob.World {
+		return &LowLevelOpsError{errorCode: ErrorIconsistency, message: "Mob and room belong to different worlds!"}
+	}
+
 	if mob.Room != nil {
 		err := removeMobFromRoom(mob.Room, mob)
 		if err != nil {
@@ -193,6 +454,10 @@ func (object *Object) RelocateToRoom(room *Room) *LowLevelOpsError {
 		return nil
 	}
 
+	if room.World != object.World {
+		return &LowLevelOpsError{errorCode: ErrorIconsistency, message: "Object and room belong to different worlds!"}
+	}
+
 	if object.Room != nil {
 		err := removeObjectFromRoom(object.Room, object)
 		if err != nil {
@@ -234,6 +499,26 @@ func indexOfWorldPlayer(world *World, player *Player) int {
 	return -1
 }
 
+func indexOfWorldMob(world *World, mob *Mob) int {
+	for index, v := range world.Mobs {
+		if mob == v {
+			return index
+		}
+	}
+
+	return -1
+}
+
+func indexOfWorldObject(world *World, object *Object) int {
+	for index, v := range world.Objects {
+		if object == v {
+			return index
+		}
+	}
+
+	return -1
+}
+
 func indexOfRoomPlayer(room *Room, player *Player) int {
 	for index, v := range room.Players {
 		if player == v {
@@ -271,10 +556,71 @@ func removePlayerFromWorld(world *World, player *Player) *LowLevelOpsError {
 	}
 
 	world.Players = append(world.Players[:index], world.Players[index+1:]...)
+	if world.playersByName[nameKey(player.Name)] == player {
+		delete(world.playersByName, nameKey(player.Name))
+	}
 	player.World = nil
 	return nil
 }
 
+func removeMobFromWorld(world *World, mob *Mob) *LowLevelOpsError {
+	index := indexOfWorldMob(world, mob)
+	if index < 0 {
+		return &LowLevelOpsError{errorCode: ErrorIconsistency, message: "Mob was not in world's list of mobs!"}
+	}
+
+	world.Mobs = append(world.Mobs[:index], world.Mobs[index+1:]...)
+	if world.mobsById[mob.Id] == mob {
+		delete(world.mobsById, mob.Id)
+	}
+
+	key := nameKey(mob.Name)
+	named := world.mobsByName[key]
+	for i, v := range named {
+		if v == mob {
+			named = append(named[:i:i], named[i+1:]...)
+			break
+		}
+	}
+	if len(named) == 0 {
+		delete(world.mobsByName, key)
+	} else {
+		world.mobsByName[key] = named
+	}
+
+	mob.World = nil
+	return nil
+}
+
+func removeObjectFromWorld(world *World, object *Object) *LowLevelOpsError {
+	index := indexOfWorldObject(world, object)
+	if index < 0 {
+		return &LowLevelOpsError{errorCode: ErrorIconsistency, message: "Object was not in world's list of objects!"}
+	}
+
+	world.Objects = append(world.Objects[:index], world.Objects[index+1:]...)
+	if world.objectsById[object.Id] == object {
+		delete(world.objectsById, object.Id)
+	}
+
+	key := nameKey(object.Name)
+	named := world.objectsByName[key]
+	for i, v := range named {
+		if v == object {
+			named = append(named[:i:i], named[i+1:]...)
+			break
+		}
+	}
+	if len(named) == 0 {
+		delete(world.objectsByName, key)
+	} else {
+		world.objectsByName[key] = named
+	}
+
+	object.World = nil
+	return nil
+}
+
 func removePlayerFromRoom(room *Room, player *Player) *LowLevelOpsError {
 	index := indexOfRoomPlayer(room, player)
 	if index < 0 {
@@ -309,10 +655,33 @@ func removeObjectFromRoom(room *Room, object *Object) *LowLevelOpsError {
 }
 
 func (world *World) FindPlayerByName(name string) *Player {
-	for _, player := range world.Players {
-		if strings.EqualFold(player.Name, name) {
-			return player
-		}
-	}
-	return nil
+	world.ensureIndexes()
+	return world.playersByName[nameKey(name)]
+}
+
+func (world *World) FindRoomByVNum(vnum int) *Room {
+	world.ensureIndexes()
+	return world.roomsByVNum[vnum]
+}
+
+func (world *World) FindMobById(id int) *Mob {
+	world.ensureIndexes()
+	return world.mobsById[id]
+}
+
+func (world *World) FindObjectById(id int) *Object {
+	world.ensureIndexes()
+	return world.objectsById[id]
+}
+
+// Returns all mobs in the world with a name (case insensitive)
+func (world *World) FindMobsByName(name string) []*Mob {
+	world.ensureIndexes()
+	return world.mobsByName[nameKey(name)]
+}
+
+// Returns all objects in the world with a name (case insensitive)
+func (world *World) FindObjectsByName(name string) []*Object {
+	world.ensureIndexes()
+	return world.objectsByName[nameKey(name)]
 }
@@ -347,3 +347,179 @@ func Test_ConnectDuplex_Bidirectional(t *testing.T) {
 		t.Errorf("Failed to connect northRoom to room in the south direction (not bidirectional)!")
 	}
 }
+
+func Test_AddRooms_AssignsVirtualNumbers(t *testing.T) {
+	// Arrange
+	world := NewWorld()
+	room1 := &Room{VNum: 3001}
+	room2 := NewRoom()
+
+	// Act
+	err := world.AddRooms([]*Room{room1, room2})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", *err)
+	}
+
+	if room2.VNum == 0 || room2.VNum == room1.VNum {
+		t.Errorf("Unexpected virtual number: %v", room2.VNum)
+	}
+
+	if world.FindRoomByVNum(3001) != room1 || world.FindRoomByVNum(room2.VNum) != room2 {
+		t.Errorf("Rooms could not be found by virtual number!")
+	}
+}
+
+func Test_AddRooms_DuplicateVirtualNumber(t *testing.T) {
+	// Arrange
+	world := NewWorld()
+	world.AddRooms([]*Room{{VNum: 3001}})
+
+	// Act
+	err := world.AddRooms([]*Room{{VNum: 3001}})
+
+	// Assert
+	if err == nil || err.ErrorCode() != ErrorDuplicateId {
+		t.Errorf("Expected a duplicate id error, got: %v", err)
+	}
+
+	if len(world.Rooms) != 1 {
+		t.Errorf("Duplicate room was added!")
+	}
+}
+
+func Test_WorldLiteral_ExistingContentsIndexed(t *testing.T) {
+	// Arrange
+	room := &Room{VNum: 3001}
+	mob := &Mob{Id: 4, Name: "Cow"}
+	player := &Player{Name: "Bob"}
+	world := &World{Rooms: []*Room{room}, Mobs: []*Mob{mob}, Players: []*Player{player}}
+
+	// Act
+	newMob := &Mob{Name: "Cow"}
+	err := world.AddMobs([]*Mob{newMob})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", *err)
+	}
+
+	if world.FindRoomByVNum(3001) != room || world.FindMobById(4) != mob || world.FindPlayerByName("bob") != player {
+		t.Errorf("Contents of the world literal were not found!")
+	}
+
+	if newMob.Id == mob.Id || len(world.FindMobsByName("cow")) != 2 {
+		t.Errorf("Added mob clashes with the contents of the world literal!")
+	}
+}
+
+func Test_FindPlayerByName_CaseInsensitive(t *testing.T) {
+	// Arrange
+	world := NewWorld()
+	player := NewPlayer()
+	player.Name = "Bob"
+	world.AddPlayers([]*Player{player})
+
+	// Act & Assert
+	if world.FindPlayerByName("bOB") != player {
+		t.Errorf("Player was not found by name!")
+	}
+
+	DestroyPlayer(player)
+
+	if world.FindPlayerByName("Bob") != nil || world.HasPlayer("Bob") {
+		t.Errorf("Destroyed player was still found by name!")
+	}
+}
+
+func Test_FindPlayerByName_AccentInsensitive(t *testing.T) {
+	// Arrange
+	world := NewWorld()
+	player := NewPlayer()
+	player.Name = "Åsa"
+	world.AddPlayers([]*Player{player})
+
+	// Act & Assert
+	if world.FindPlayerByName("asa") != player || world.FindPlayerByName("ÅSA") != player {
+		t.Errorf("Player was not found by name!")
+	}
+}
+
+func Test_NewMobFromPrototype_IndexedInstances(t *testing.T) {
+	// Arrange
+	world := NewWorld()
+	prototype := &MobPrototype{VNum: 7, Name: "Cow"}
+	world.AddMobPrototypes([]*MobPrototype{prototype})
+	mob1 := NewMobFromPrototype(prototype)
+	mob2 := NewMobFromPrototype(prototype)
+
+	// Act
+	err := world.AddMobs([]*Mob{mob1, mob2})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", *err)
+	}
+
+	if mob1.Id == mob2.Id || world.FindMobById(mob1.Id) != mob1 || world.FindMobById(mob2.Id) != mob2 {
+		t.Errorf("Mob instances were not given distinct ids!")
+	}
+
+	if mob1.Prototype != prototype || mob1.Name != "Cow" {
+		t.Errorf("Mob instance does not reflect its prototype!")
+	}
+
+	if len(world.FindMobsByName("cow")) != 2 {
+		t.Errorf("Mob instances were not found by name!")
+	}
+}
+
+func Test_DestroyMob_RemovedFromWorldAndRoom(t *testing.T) {
+	// Arrange
+	world := NewWorld()
+	room := NewRoom()
+	world.AddRooms([]*Room{room})
+	mob1 := &Mob{Name: "Cow"}
+	mob2 := &Mob{Name: "Cow"}
+	world.AddMobs([]*Mob{mob1, mob2})
+	mob1.RelocateToRoom(room)
+
+	// Act
+	DestroyMob(mob1)
+
+	// Assert
+	if len(world.Mobs) != 1 || world.Mobs[0] != mob2 || world.FindMobById(mob1.Id) != nil {
+		t.Errorf("Mob was not removed from the world!")
+	}
+
+	if len(room.Mobs) != 0 || mob1.Room != nil || mob1.World != nil {
+		t.Errorf("Mob was not removed from its room!")
+	}
+
+	if named := world.FindMobsByName("cow"); len(named) != 1 || named[0] != mob2 {
+		t.Errorf("Mob was still found by name!")
+	}
+}
+
+func Test_RelocateToRoom_OtherWorld(t *testing.T) {
+	// Arrange
+	world := NewWorld()
+	otherWorld := NewWorld()
+	room := NewRoom()
+	otherWorld.AddRooms([]*Room{room})
+	player := NewPlayer()
+	world.AddPlayers([]*Player{player})
+
+	// Act
+	err := player.RelocateToRoom(room)
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected an error when relocating to a room in another world!")
+	}
+
+	if player.Room == room {
+		t.Errorf("Player was relocated to a room in another world!")
+	}
+}
@@ -3,6 +3,7 @@ package ansi
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -12,11 +13,30 @@ import (
 // $fg_red$ = foreground red (31)
 // $bg_red$ = background red (41)
 // $fg_bred$ = foreground bright red (91)
+// $fg_c208$ = foreground color 208 of the 256 color palette
+// $bg_#ff8800$ = background color #ff8800 (truecolor)
+// $bold$, $underline$ = turn on bold or underlined text
+// $reset$ = turn off all colors and attributes
 // etc...
 
-var reColorization = regexp.MustCompile(`\$[a-z_]*\$`)
+var reColorization = regexp.MustCompile(`\$[a-z_]*(?:c[0-9]{1,3}|#[0-9a-fA-F]{6})?\$`)
 
+// How many colors a terminal can show
+type ColorDepth int
+
+const (
+	COLORS_16 ColorDepth = iota
+	COLORS_256
+	TRUE_COLOR
+)
+
+// Turns markup into escape codes, for a terminal that can show any color
 func Encode(text string) string {
+	return EncodeForDepth(text, TRUE_COLOR)
+}
+
+// Turns markup into escape codes. Colors the terminal can't show are replaced by the nearest color it can show.
+func EncodeForDepth(text string, depth ColorDepth) string {
 	// Optimization. Without this check, this function is 20 times slower!
 	if strings.IndexRune(text, '$') < 0 {
 		// Nothing to encode
@@ -28,10 +48,11 @@ func Encode(text string) string {
 			return "$"
 		}
 
-		return transformFunc(s)
+		return transformFunc(s, depth)
 	})
 }
 
+// Removes the markup from text, leaving the text as it is shown (escaped dollar signs become dollar signs)
 func Strip(text string) string {
 	// Optimization. Without this check, this function is 20 times slower!
 	if strings.IndexRune(text, '$') < 0 {
@@ -39,7 +60,13 @@ func Strip(text string) string {
 		return text
 	}
 
-	return reColorization.ReplaceAllLiteralString(text, "")
+	return reColorization.ReplaceAllStringFunc(text, func(s string) string {
+		if s == "$$" {
+			return "$"
+		}
+
+		return ""
+	})
 }
 
 type ansiColor struct {
@@ -91,7 +118,17 @@ func findColor(name string) int {
 	return -1
 }
 
-func transformFunc(f string) string {
+var ansiAttributes = map[string]int{
+	"reset":     0,
+	"bold":      1,
+	"underline": 4,
+}
+
+func transformFunc(f string, depth ColorDepth) string {
+	if attribute, ok := ansiAttributes[f[1:len(f)-1]]; ok {
+		return fmt.Sprintf("\x1b[%vm", attribute)
+	}
+
 	if len(f) < 5 {
 		// Can't be a color
 		return ""
@@ -100,6 +137,17 @@ func transformFunc(f string) string {
 	fgOrBg := f[1:3]
 	colorName := f[4 : len(f)-1]
 
+	if (fgOrBg != "fg" && fgOrBg != "bg") || f[3] != '_' || len(colorName) == 0 {
+		return ""
+	}
+
+	switch {
+	case colorName[0] == '#':
+		return encodeTrueColor(fgOrBg, colorName[1:], depth)
+	case colorName[0] == 'c' && len(colorName) > 1 && colorName[1] >= '0' && colorName[1] <= '9':
+		return encodePaletteColor(fgOrBg, colorName[1:], depth)
+	}
+
 	i := findColor(colorName)
 
 	if i < 0 {
@@ -116,6 +164,64 @@ func transformFunc(f string) string {
 	return fmt.Sprintf("\x1b[%vm", ansiIndex)
 }
 
+// Encodes $fg_#rrggbb$ and $bg_#rrggbb$
+func encodeTrueColor(fgOrBg string, hex string, depth ColorDepth) string {
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return ""
+	}
+
+	color := rgb{int(value >> 16), int(value >> 8 & 0xff), int(value & 0xff)}
+
+	switch depth {
+	case TRUE_COLOR:
+		return fmt.Sprintf("\x1b[%v;2;%v;%v;%vm", extendedColorSelector(fgOrBg), color.r, color.g, color.b)
+	case COLORS_256:
+		return fmt.Sprintf("\x1b[%v;5;%vm", extendedColorSelector(fgOrBg), nearestPaletteColor(color))
+	default:
+		return encodeBasicColor(fgOrBg, nearestBasicColor(color))
+	}
+}
+
+// Encodes $fg_cN$ and $bg_cN$, where N is a color of the 256 color palette
+func encodePaletteColor(fgOrBg string, number string, depth ColorDepth) string {
+	index, err := strconv.Atoi(number)
+	if err != nil || index > 255 {
+		return ""
+	}
+
+	if depth == COLORS_16 {
+		if index >= 16 {
+			index = nearestBasicColor(paletteColor(index))
+		}
+		return encodeBasicColor(fgOrBg, index)
+	}
+
+	return fmt.Sprintf("\x1b[%v;5;%vm", extendedColorSelector(fgOrBg), index)
+}
+
+// The parameter that introduces a 256 color or truecolor in an escape code
+func extendedColorSelector(fgOrBg string) int {
+	if fgOrBg == "fg" {
+		return 38
+	}
+	return 48
+}
+
+// Encodes one of the 16 basic colors, by its index in the palette (0-7 normal, 8-15 bright)
+func encodeBasicColor(fgOrBg string, index int) string {
+	value := 30 + index
+	if index >= 8 {
+		value = 90 + index - 8
+	}
+
+	if fgOrBg == "bg" {
+		value += 10
+	}
+
+	return fmt.Sprintf("\x1b[%vm", value)
+}
+
 func Escape(text string) string {
 	return strings.ReplaceAll(text, "$", "$$")
 }
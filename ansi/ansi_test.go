@@ -149,3 +149,106 @@ func Test_Encode_UndonesEscape(t *testing.T) {
 		)
 	}
 }
+
+func Test_Encode_Attributes(t *testing.T) {
+	result := Encode("$bold$Bold$underline$ and underlined$reset$")
+
+	if result != "\x1b[1mBold\x1b[4m and underlined\x1b[0m" {
+		t.Errorf("Unexpected result: %q", result)
+	}
+}
+
+func Test_Encode_PaletteColor(t *testing.T) {
+	result := Encode("$fg_c208$Orange$bg_c17$")
+
+	if result != "\x1b[38;5;208mOrange\x1b[48;5;17m" {
+		t.Errorf("Unexpected result: %q", result)
+	}
+}
+
+func Test_Encode_PaletteColorOutOfRange_Stripped(t *testing.T) {
+	result := Encode("$fg_c256$Text")
+
+	if result != "Text" {
+		t.Errorf("Unexpected result: %q", result)
+	}
+}
+
+func Test_Encode_NoColorName_Stripped(t *testing.T) {
+	result := Encode("$fg_$Text$bg_$")
+
+	if result != "Text" {
+		t.Errorf("Unexpected result: %q", result)
+	}
+}
+
+func Test_Encode_TrueColor(t *testing.T) {
+	result := Encode("$fg_#ff8800$Orange$bg_#0000AA$")
+
+	if result != "\x1b[38;2;255;136;0mOrange\x1b[48;2;0;0;170m" {
+		t.Errorf("Unexpected result: %q", result)
+	}
+}
+
+func Test_EncodeForDepth_TrueColorDownsampled(t *testing.T) {
+	testCases := []struct {
+		depth    ColorDepth
+		expected string
+	}{
+		{COLORS_256, "\x1b[38;5;208m"},
+		{COLORS_16, "\x1b[33m"},
+	}
+
+	for _, testCase := range testCases {
+		if result := EncodeForDepth("$fg_#ff8800$", testCase.depth); result != testCase.expected {
+			t.Errorf("Unexpected result for depth %v: %q", testCase.depth, result)
+		}
+	}
+}
+
+func Test_EncodeForDepth_GrayDownsampledToGrayRamp(t *testing.T) {
+	result := EncodeForDepth("$bg_#808080$", COLORS_256)
+
+	if result != "\x1b[48;5;244m" {
+		t.Errorf("Unexpected result: %q", result)
+	}
+}
+
+func Test_EncodeForDepth_PaletteColorDownsampled(t *testing.T) {
+	testCases := map[string]string{
+		"$fg_c1$":   "\x1b[31m",
+		"$bg_c12$":  "\x1b[104m",
+		"$fg_c196$": "\x1b[91m",
+		"$bg_c232$": "\x1b[40m",
+	}
+
+	for markup, expected := range testCases {
+		if result := EncodeForDepth(markup, COLORS_16); result != expected {
+			t.Errorf("Unexpected result for %v: %q", markup, result)
+		}
+	}
+}
+
+func Test_Strip_ExtendedMarkup(t *testing.T) {
+	result := Strip("$bold$$fg_c208$Orange$fg_#ff8800$ juice$reset$")
+
+	if result != "Orange juice" {
+		t.Errorf("Unexpected result: %q", result)
+	}
+}
+
+func Test_Strip_EscapedDollar_Kept(t *testing.T) {
+	result := Strip("$fg_red$Costs $$5$reset$")
+
+	if result != "Costs $5" {
+		t.Errorf("Unexpected result: %q", result)
+	}
+}
+
+func Test_Encode_DollarsAroundNumbers_LeftAlone(t *testing.T) {
+	result := Encode("From $$5$$ to $$10$$")
+
+	if result != "From $5$ to $10$" {
+		t.Errorf("Unexpected result: %q", result)
+	}
+}
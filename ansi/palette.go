@@ -0,0 +1,85 @@
+package ansi
+
+// Colors are downsampled by picking the color of the terminal's palette that is closest to it. The palette is the
+// one of xterm, since that's what most terminals (and MUD clients) imitate.
+
+type rgb struct {
+	r, g, b int
+}
+
+// The 16 basic colors: black, red, green, yellow, blue, magenta, cyan and white, then their bright variants
+var basicColors = [16]rgb{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0}, {0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0}, {92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+// The levels of each component in the 6x6x6 color cube of the 256 color palette (colors 16-231)
+var cubeLevels = [6]int{0, 95, 135, 175, 215, 255}
+
+// The color of the 256 color palette with index `index`
+func paletteColor(index int) rgb {
+	switch {
+	case index < 16:
+		return basicColors[index]
+	case index < 232:
+		index -= 16
+		return rgb{cubeLevels[index/36], cubeLevels[index/6%6], cubeLevels[index%6]}
+	default:
+		// A gray ramp from 8 to 238
+		gray := 8 + (index-232)*10
+		return rgb{gray, gray, gray}
+	}
+}
+
+// The index of the color of the 256 color palette that is closest to `color`. The basic colors are left out,
+// since terminals often change them.
+func nearestPaletteColor(color rgb) int {
+	cube := 16 + 36*nearestCubeLevel(color.r) + 6*nearestCubeLevel(color.g) + nearestCubeLevel(color.b)
+
+	gray := ((color.r+color.g+color.b)/3 - 8 + 5) / 10
+	if gray < 0 {
+		gray = 0
+	} else if gray > 23 {
+		gray = 23
+	}
+	gray += 232
+
+	if distance(color, paletteColor(gray)) < distance(color, paletteColor(cube)) {
+		return gray
+	}
+	return cube
+}
+
+func nearestCubeLevel(component int) int {
+	nearest := 0
+	for i, level := range cubeLevels {
+		if abs(level-component) < abs(cubeLevels[nearest]-component) {
+			nearest = i
+		}
+	}
+	return nearest
+}
+
+// The index (0-15) of the basic color that is closest to `color`
+func nearestBasicColor(color rgb) int {
+	nearest := 0
+	for i, basic := range basicColors {
+		if distance(color, basic) < distance(color, basicColors[nearest]) {
+			nearest = i
+		}
+	}
+	return nearest
+}
+
+// The squared distance between two colors, which is good enough for comparing them
+func distance(a rgb, b rgb) int {
+	dr, dg, db := a.r-b.r, a.g-b.g, a.b-b.b
+	return dr*dr + dg*dg + db*db
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
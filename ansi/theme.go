@@ -0,0 +1,106 @@
+package ansi
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Semantic markup says what a piece of text is rather than how it looks, e.g. $error$ or $roomtitle$. A theme maps
+// the semantic tags to markup, and players pick their own themes. Tags that a theme leaves out look like in the
+// default theme.
+
+// The most markup names a style may be made of
+const MAX_STYLE_NAMES = 4
+
+var ErrInvalidStyle = errors.New("invalid style")
+
+// Maps semantic tags (without the dollar signs) to markup, e.g. "error" to "$fg_bred$"
+type Theme map[string]string
+
+var DefaultTheme = Theme{
+	"error":     "$fg_bred$",
+	"exit":      "$fg_green$",
+	"heading":   "$fg_yellow$",
+	"mobaction": "$fg_cyan$",
+	"prompt":    "$fg_bcyan$",
+	"roomtitle": "$fg_bwhite$",
+	"tell":      "$fg_bcyan$",
+}
+
+// The semantic tags, sorted
+func SemanticTags() []string {
+	tags := make([]string, 0, len(DefaultTheme))
+	for tag := range DefaultTheme {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func IsSemanticTag(tag string) bool {
+	_, found := DefaultTheme[tag]
+	return found
+}
+
+// The markup of a semantic tag
+func (theme Theme) Style(tag string) string {
+	if style, found := theme[tag]; found {
+		return style
+	}
+	return DefaultTheme[tag]
+}
+
+// Replaces the semantic tags in marked up text with the markup of the theme
+func (theme Theme) Apply(text string) string {
+	// Optimization, like in Encode
+	if strings.IndexRune(text, '$') < 0 {
+		return text
+	}
+
+	return reColorization.ReplaceAllStringFunc(text, func(s string) string {
+		tag := s[1 : len(s)-1]
+		if !IsSemanticTag(tag) {
+			return s
+		}
+		return theme.Style(tag)
+	})
+}
+
+// Makes a copy of the theme, which can be handed to another goroutine
+func (theme Theme) Copy() Theme {
+	copied := make(Theme, len(theme))
+	for tag, style := range theme {
+		copied[tag] = style
+	}
+	return copied
+}
+
+// Turns markup names, as players type them (e.g. "bold" and "fg_c208"), into a style (e.g. "$bold$$fg_c208$")
+func ParseStyle(names []string) (string, error) {
+	if len(names) == 0 || len(names) > MAX_STYLE_NAMES {
+		return "", ErrInvalidStyle
+	}
+
+	var style strings.Builder
+	for _, name := range names {
+		markup := "$" + strings.ToLower(name) + "$"
+		if reColorization.FindString(markup) != markup || transformFunc(markup, TRUE_COLOR) == "" {
+			return "", ErrInvalidStyle
+		}
+		style.WriteString(markup)
+	}
+
+	return style.String(), nil
+}
+
+// Tells if a style is one that ParseStyle could have made, e.g. when it was read from a file that may have been edited
+func IsValidStyle(style string) bool {
+	parsed, err := ParseStyle(strings.Fields(StyleNames(style)))
+	return err == nil && parsed == style
+}
+
+// Turns a style back into the markup names it was made of, separated by spaces
+func StyleNames(style string) string {
+	return strings.Join(strings.Fields(strings.ReplaceAll(style, "$", " ")), " ")
+}
@@ -0,0 +1,79 @@
+package ansi
+
+import "testing"
+
+func Test_Theme_Apply_PlayersStyleOrDefault(t *testing.T) {
+	theme := Theme{"error": "$bold$$fg_c196$"}
+
+	result := theme.Apply("$error$Oops $tell$Hi $fg_red$$$5$meh$")
+
+	if result != "$bold$$fg_c196$Oops $fg_bcyan$Hi $fg_red$$$5$meh$" {
+		t.Errorf("Unexpected result: %q", result)
+	}
+}
+
+func Test_Theme_Apply_NilTheme_DefaultColors(t *testing.T) {
+	var theme Theme
+
+	if result := Encode(theme.Apply("$error$Oops")); result != "\x1b[91mOops" {
+		t.Errorf("Unexpected result: %q", result)
+	}
+}
+
+func Test_Theme_Apply_EscapedTag_LeftAlone(t *testing.T) {
+	result := Theme{}.Apply(Escape("$error$"))
+
+	if result != "$$error$$" {
+		t.Errorf("Unexpected result: %q", result)
+	}
+}
+
+func Test_ParseStyle(t *testing.T) {
+	style, err := ParseStyle([]string{"Bold", "fg_c208", "bg_#FF8800"})
+
+	if err != nil || style != "$bold$$fg_c208$$bg_#ff8800$" {
+		t.Errorf("Unexpected style %q (%v)", style, err)
+	}
+
+	if StyleNames(style) != "bold fg_c208 bg_#ff8800" {
+		t.Errorf("Unexpected names %q", StyleNames(style))
+	}
+}
+
+func Test_ParseStyle_Invalid(t *testing.T) {
+	invalid := [][]string{
+		{},
+		{"fg_purple"},
+		{"error"},
+		{"fg_red$$bold"},
+		{"fg_c300"},
+		{"fg_"},
+		{"bg_"},
+		{"bold", "underline", "fg_red", "bg_blue", "reset"},
+	}
+
+	for _, names := range invalid {
+		if _, err := ParseStyle(names); err != ErrInvalidStyle {
+			t.Errorf("Expected %v to be invalid, but got %v", names, err)
+		}
+	}
+}
+
+func Test_IsValidStyle(t *testing.T) {
+	testCases := []struct {
+		style    string
+		expected bool
+	}{
+		{"$bold$$fg_c208$", true},
+		{"$fg_$", false},
+		{"$fg_red$text", false},
+		{"$error$", false},
+		{"", false},
+	}
+
+	for _, testCase := range testCases {
+		if IsValidStyle(testCase.style) != testCase.expected {
+			t.Errorf("Expected IsValidStyle(%q) to be %v", testCase.style, testCase.expected)
+		}
+	}
+}
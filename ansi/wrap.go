@@ -0,0 +1,124 @@
+package ansi
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// A piece of marked up text, and how many columns it takes up on the screen
+type token struct {
+	text  string
+	width int
+}
+
+// Splits marked up text into tokens of one rune each, except for the markup, which becomes tokens of zero width
+// (or one, for "$$")
+func tokenize(text string) []token {
+	tokens := make([]token, 0, len(text))
+	markup := reColorization.FindAllStringIndex(text, -1)
+
+	for i := 0; i < len(text); {
+		if len(markup) > 0 && markup[0][0] == i {
+			s := text[markup[0][0]:markup[0][1]]
+			width := 0
+			if s == "$$" {
+				width = 1
+			}
+
+			tokens = append(tokens, token{s, width})
+			i = markup[0][1]
+			markup = markup[1:]
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(text[i:])
+		width := 1
+		if r == '\r' || r == '\n' {
+			width = 0
+		}
+
+		tokens = append(tokens, token{text[i : i+size], width})
+		i += size
+	}
+
+	return tokens
+}
+
+// Returns the number of columns marked up text takes up on the screen
+func Width(text string) int {
+	width := 0
+	for _, t := range tokenize(text) {
+		width += t.width
+	}
+	return width
+}
+
+// Wraps marked up text so that no line is wider than `width` columns. Lines are broken between words, and the
+// spaces at the break are dropped. Words that are wider than a line are broken wherever they must. Markup takes
+// up no room. A width of 0 or less leaves the text as it is.
+func Wrap(text string, width int) string {
+	if width <= 0 {
+		return text
+	}
+
+	var result strings.Builder
+	result.Grow(len(text))
+
+	column := 0
+	var spaces []token // Spaces between the last word written and the current one
+	var word []token   // The current word, which may contain markup
+
+	writeWord := func() {
+		wordWidth := 0
+		for _, t := range word {
+			wordWidth += t.width
+		}
+
+		spacesWidth := len(spaces)
+		if wordWidth > 0 && column > 0 && column+spacesWidth+wordWidth > width {
+			// Break the line between the words, rather than in the middle of the word
+			result.WriteByte('\n')
+			column = 0
+		} else {
+			for _, t := range spaces {
+				if column+t.width > width {
+					break
+				}
+				result.WriteString(t.text)
+				column += t.width
+			}
+		}
+
+		for _, t := range word {
+			if t.width > 0 && column+t.width > width {
+				result.WriteByte('\n')
+				column = 0
+			}
+			result.WriteString(t.text)
+			column += t.width
+		}
+
+		spaces = spaces[:0]
+		word = word[:0]
+	}
+
+	for _, t := range tokenize(text) {
+		switch t.text {
+		case " ", "\t":
+			if len(word) > 0 {
+				writeWord()
+			}
+			spaces = append(spaces, token{t.text, 1})
+		case "\r", "\n":
+			writeWord()
+			result.WriteString(t.text)
+			column = 0
+		default:
+			word = append(word, t)
+		}
+	}
+
+	writeWord()
+
+	return result.String()
+}
@@ -0,0 +1,49 @@
+package ansi
+
+import "testing"
+
+func Test_Wrap(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		width    int
+		expected string
+	}{
+		{"fits", "a short line", 20, "a short line"},
+		{"no width", "a short line", 0, "a short line"},
+		{"between words", "the quick brown fox", 10, "the quick\nbrown fox"},
+		{"spaces at break dropped", "the quick   brown", 9, "the quick\nbrown"},
+		{"existing line breaks", "the quick\r\nbrown fox jumps", 10, "the quick\r\nbrown fox\njumps"},
+		{"indentation kept", "   You are in the temple.", 12, "   You are\nin the\ntemple."},
+		{"long word broken", "abcdefghij", 4, "abcd\nefgh\nij"},
+		{"markup is zero width", "$fg_red$the$fg_white$ quick $fg_bblue$brown", 9, "$fg_red$the$fg_white$ quick\n$fg_bblue$brown"},
+		{"escaped dollar has width", "pay $$10 now", 7, "pay $$10\nnow"},
+		{"multibyte runes", "åäö åäö", 3, "åäö\nåäö"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			result := Wrap(testCase.text, testCase.width)
+
+			if result != testCase.expected {
+				t.Errorf("Expected %q, got %q", testCase.expected, result)
+			}
+		})
+	}
+}
+
+func Test_Width(t *testing.T) {
+	result := Width("$fg_red$Red$$$bg_black$ åä")
+
+	if result != 7 {
+		t.Errorf("Unexpected result: %v", result)
+	}
+}
+
+func Test_Width_ExtendedMarkup(t *testing.T) {
+	result := Width("$bold$$fg_c208$Orange$fg_#ff8800$$reset$")
+
+	if result != 6 {
+		t.Errorf("Unexpected result: %v", result)
+	}
+}
@@ -0,0 +1,80 @@
+// Package charset converts text between the character sets clients may use, and folds text for matching
+// names regardless of case and accents.
+package charset
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Charset int
+
+const (
+	UTF8 Charset = iota
+	Latin1
+	ASCII
+)
+
+// Names of the character sets, as registered with IANA
+var names = []string{
+	UTF8:   "UTF-8",
+	Latin1: "ISO-8859-1",
+	ASCII:  "US-ASCII",
+}
+
+// Other names clients use for the character sets
+var aliases = map[string]Charset{
+	"UTF8":       UTF8,
+	"LATIN1":     Latin1,
+	"LATIN-1":    Latin1,
+	"ISO8859-1":  Latin1,
+	"ISO_8859-1": Latin1,
+	"ASCII":      ASCII,
+}
+
+func (c Charset) Name() string {
+	return names[c]
+}
+
+// Finds a character set by its name (or an alias), regardless of case
+func Parse(name string) (Charset, bool) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+
+	for c, n := range names {
+		if n == name {
+			return Charset(c), true
+		}
+	}
+
+	c, found := aliases[name]
+	return c, found
+}
+
+// Appends the encoding of a rune to a buffer. Runes that the character set lacks are transliterated to ASCII.
+func (c Charset) AppendRune(buf []byte, r rune) []byte {
+	switch {
+	case c == UTF8:
+		var encoded [utf8.UTFMax]byte
+		n := utf8.EncodeRune(encoded[:], r)
+		return append(buf, encoded[:n]...)
+	case r < utf8.RuneSelf, c == Latin1 && r <= unicode.MaxLatin1:
+		return append(buf, byte(r))
+	default:
+		return append(buf, TransliterateRune(r)...)
+	}
+}
+
+// Decodes text received from a client. Invalid UTF-8 sequences are replaced by U+FFFD, and ASCII is read as
+// Latin-1, in case the client sends more than it claims to.
+func (c Charset) Decode(data []byte) string {
+	if c == UTF8 {
+		return strings.ToValidUTF8(string(data), string(utf8.RuneError))
+	}
+
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
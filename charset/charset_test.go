@@ -0,0 +1,76 @@
+package charset
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func Test_TransliterationTable(t *testing.T) {
+	if utf8.RuneCountInString(accented) != utf8.RuneCountInString(unaccented) {
+		t.Fatalf("%v accented letters, but %v unaccented", utf8.RuneCountInString(accented), utf8.RuneCountInString(unaccented))
+	}
+}
+
+func Test_Parse(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected Charset
+		found    bool
+	}{
+		{"UTF-8", UTF8, true},
+		{"utf8", UTF8, true},
+		{"ISO-8859-1", Latin1, true},
+		{"latin1", Latin1, true},
+		{"US-ASCII", ASCII, true},
+		{"KOI8-R", UTF8, false},
+	}
+
+	for _, testCase := range testCases {
+		c, found := Parse(testCase.name)
+
+		if found != testCase.found || found && c != testCase.expected {
+			t.Errorf("Unexpected result for %v: %v, %v", testCase.name, c, found)
+		}
+	}
+}
+
+func Test_AppendRune(t *testing.T) {
+	testCases := []struct {
+		charset  Charset
+		r        rune
+		expected string
+	}{
+		{UTF8, 'å', "\xc3\xa5"},
+		{Latin1, 'å', "\xe5"},
+		{Latin1, 'ł', "l"},
+		{ASCII, 'å', "a"},
+		{ASCII, 'Æ', "AE"},
+		{ASCII, '“', "\""},
+		{ASCII, '漢', "?"},
+		{ASCII, 'a', "a"},
+	}
+
+	for _, testCase := range testCases {
+		result := string(testCase.charset.AppendRune(nil, testCase.r))
+
+		if result != testCase.expected {
+			t.Errorf("Expected %q for %q in %v, but got %q", testCase.expected, testCase.r, testCase.charset.Name(), result)
+		}
+	}
+}
+
+func Test_Decode(t *testing.T) {
+	if result := UTF8.Decode([]byte("\xc3\xa5sa\xff")); result != "åsa�" {
+		t.Errorf("Unexpected UTF-8 result: %q", result)
+	}
+
+	if result := Latin1.Decode([]byte("\xe5sa")); result != "åsa" {
+		t.Errorf("Unexpected Latin-1 result: %q", result)
+	}
+}
+
+func Test_Fold(t *testing.T) {
+	if result := Fold("Åsa Ærø Straße Ωmega"); result != "asa aero strasse ωmega" {
+		t.Errorf("Unexpected result: %q", result)
+	}
+}
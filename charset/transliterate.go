@@ -0,0 +1,69 @@
+package charset
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Letters with diacritics, and the letters they are transliterated to, rune by rune
+const (
+	accented = "ÀÁÂÃÄÅÇÈÉÊËÌÍÎÏÐÑÒÓÔÕÖØÙÚÛÜÝàáâãäåçèéêëìíîïðñòóôõöøùúûüýÿ" +
+		"ĀāĂăĄąĆćĈĉĊċČčĎďĐđĒēĔĕĖėĘęĚěĜĝĞğĠġĢģĤĥĦħĨĩĪīĬĭĮįİıĴĵĶķĹĺĻļĽľĿŀŁł" +
+		"ŃńŅņŇňŌōŎŏŐőŔŕŖŗŘřŚśŜŝŞşŠšŢţŤťŦŧŨũŪūŬŭŮůŰűŲųŴŵŶŷŸŹźŻżŽž"
+	unaccented = "AAAAAACEEEEIIIIDNOOOOOOUUUUYaaaaaaceeeeiiiidnoooooouuuuyy" +
+		"AaAaAaCcCcCcCcDdDdEeEeEeEeEeGgGgGgGgHhHhIiIiIiIiIiJjKkLlLlLlLlLl" +
+		"NnNnNnOoOoOoRrRrRrSsSsSsSsTtTtTtUuUuUuUuUuUuWwYyYZzZzZz"
+)
+
+// Runes that are transliterated to more than one letter, or aren't letters
+var transliterations = map[rune]string{
+	'Æ': "AE", 'æ': "ae", 'Œ': "OE", 'œ': "oe", 'ß': "ss", 'Þ': "TH", 'þ': "th",
+	'‘': "'", '’': "'", '‚': "'", '“': "\"", '”': "\"", '„': "\"", '«': "<<", '»': ">>",
+	'–': "-", '—': "-", '…': "...", '•': "*", '·': ".", ' ': " ",
+	'¡': "!", '¿': "?", '©': "(c)", '®': "(R)", '™': "(TM)", '€': "EUR", '£': "GBP", '×': "x", '÷': "/",
+}
+
+func init() {
+	unaccentedRunes := []rune(unaccented)
+	for i, r := range []rune(accented) {
+		transliterations[r] = string(unaccentedRunes[i])
+	}
+}
+
+// Transliterates a rune to ASCII. Runes that have no transliteration become "?".
+func TransliterateRune(r rune) string {
+	if r < utf8.RuneSelf {
+		return string(r)
+	}
+
+	if t, found := transliterations[r]; found {
+		return t
+	}
+
+	return "?"
+}
+
+// Transliterates text to ASCII
+func Transliterate(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		b.WriteString(TransliterateRune(r))
+	}
+	return b.String()
+}
+
+// Folds text for matching: lower case, and without diacritics, so that "Åsa" matches "asa". Runes that can't be
+// transliterated are kept, so that names in other scripts can still be matched.
+func Fold(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		r = unicode.ToLower(r)
+		if t, found := transliterations[r]; found && r >= utf8.RuneSelf {
+			b.WriteString(t)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,261 @@
+// Package circle imports CircleMUD area files (.wld, .mob, .obj and .zon) into a world.
+//
+// Constructs the world has no counterpart for (room flags, sectors, mob and object stats, extra descriptions
+// of rooms, applies) are read and thrown away. Zone commands are run once, at import: mobs and objects are
+// loaded into rooms. Objects given to, or equipped by, mobs and objects put into containers are left out, since
+// there are no inventories (yet), and so are the states of doors, since doors can't be opened (yet). Scripts (triggers) are reported as
+// errors, as are virtual number 0 (which is reserved), and anything else that can't be parsed.
+package circle
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+)
+
+// The rooms, prototypes and zones read from a set of files
+type areas struct {
+	rooms   []*roomRecord
+	mobs    []*mobRecord
+	objects []*objectRecord
+	zones   []*zoneRecord
+}
+
+// Imports all CircleMUD area files in a directory and its subdirectories. `startRoom` is the virtual number
+// of the room players start in (3001 in CircleMUD's own world), or 0 for the room with the lowest number.
+func ImportDirectory(directory string, startRoom int) (*absmachine.World, error) {
+	var paths []string
+
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".wld", ".mob", ".obj", ".zon":
+			if !info.IsDir() {
+				paths = append(paths, path)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(paths)
+	return Import(paths, startRoom)
+}
+
+// Imports a set of CircleMUD area files. The kind of each file is told by its extension.
+func Import(paths []string, startRoom int) (*absmachine.World, error) {
+	var areas areas
+	var errors ParseErrors
+
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		errors = append(errors, areas.parse(path, file)...)
+		file.Close()
+	}
+
+	if len(errors) > 0 {
+		return nil, errors
+	}
+
+	world, errors := areas.build(startRoom)
+	if len(errors) > 0 {
+		return nil, errors
+	}
+
+	return world, nil
+}
+
+func (areas *areas) parse(path string, input io.Reader) ParseErrors {
+	var errors ParseErrors
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".wld":
+		var rooms []*roomRecord
+		rooms, errors = parseRooms(path, input)
+		areas.rooms = append(areas.rooms, rooms...)
+	case ".mob":
+		var mobs []*mobRecord
+		mobs, errors = parseMobs(path, input)
+		areas.mobs = append(areas.mobs, mobs...)
+	case ".obj":
+		var objects []*objectRecord
+		objects, errors = parseObjects(path, input)
+		areas.objects = append(areas.objects, objects...)
+	case ".zon":
+		var zones []*zoneRecord
+		zones, errors = parseZones(path, input)
+		areas.zones = append(areas.zones, zones...)
+	default:
+		errors = ParseErrors{location{file: path}.errorf("unknown kind of area file")}
+	}
+
+	return errors
+}
+
+func (areas *areas) build(startRoom int) (*absmachine.World, ParseErrors) {
+	world := absmachine.NewWorld()
+	var errors ParseErrors
+
+	// Rooms
+	roomLocations := make(map[int]location)
+	rooms := make([]*absmachine.Room, 0, len(areas.rooms))
+	for _, record := range areas.rooms {
+		if other, found := roomLocations[record.room.VNum]; found {
+			errors = append(errors, record.errorf("room %v is already defined at %v:%v", record.room.VNum, other.file, other.line))
+			continue
+		}
+
+		roomLocations[record.room.VNum] = record.location
+		rooms = append(rooms, record.room)
+	}
+
+	if lowLevelErr := world.AddRooms(rooms); lowLevelErr != nil {
+		return nil, append(errors, location{}.errorf("%v", lowLevelErr))
+	}
+
+	for _, record := range areas.rooms {
+		for _, exit := range record.exits {
+			if exit.toRoom == noWhere {
+				continue
+			}
+
+			adjacentRoom := world.FindRoomByVNum(exit.toRoom)
+			if adjacentRoom == nil {
+				errors = append(errors, exit.errorf("exit leads to room %v, which does not exist", exit.toRoom))
+				continue
+			}
+
+			if lowLevelErr := record.room.Connect(adjacentRoom, exit.direction); lowLevelErr != nil {
+				errors = append(errors, exit.errorf("%v", lowLevelErr))
+				continue
+			}
+			record.room.ExitDetails[exit.direction] = exit.details
+		}
+	}
+
+	// Prototypes
+	for _, record := range areas.mobs {
+		if lowLevelErr := world.AddMobPrototypes([]*absmachine.MobPrototype{record.prototype}); lowLevelErr != nil {
+			errors = append(errors, record.errorf("%v", lowLevelErr))
+		}
+	}
+
+	for _, record := range areas.objects {
+		if lowLevelErr := world.AddObjectPrototypes([]*absmachine.ObjectPrototype{record.prototype}); lowLevelErr != nil {
+			errors = append(errors, record.errorf("%v", lowLevelErr))
+		}
+	}
+
+	// Zone resets
+	for _, zone := range areas.zones {
+		for _, command := range zone.commands {
+			if err := runZoneCommand(world, command); err != nil {
+				errors = append(errors, err)
+			}
+		}
+	}
+
+	// Start room
+	if startRoom == 0 {
+		for _, room := range world.Rooms {
+			if world.StartRoom == nil || room.VNum < world.StartRoom.VNum {
+				world.StartRoom = room
+			}
+		}
+	} else {
+		world.StartRoom = world.FindRoomByVNum(startRoom)
+	}
+
+	if world.StartRoom == nil {
+		errors = append(errors, location{}.errorf("start room %v does not exist", startRoom))
+	}
+
+	return world, errors
+}
+
+func runZoneCommand(world *absmachine.World, command zoneCommand) *ParseError {
+	args := command.args
+
+	switch command.command {
+	case 'M':
+		prototype := world.MobPrototypes[args[0]]
+		if prototype == nil {
+			return command.errorf("mob %v does not exist", args[0])
+		}
+
+		room := world.FindRoomByVNum(args[2])
+		if room == nil {
+			return command.errorf("room %v does not exist", args[2])
+		}
+
+		mob := absmachine.NewMobFromPrototype(prototype)
+		if lowLevelErr := world.AddMobs([]*absmachine.Mob{mob}); lowLevelErr != nil {
+			return command.errorf("%v", lowLevelErr)
+		}
+
+		if lowLevelErr := mob.RelocateToRoom(room); lowLevelErr != nil {
+			return command.errorf("%v", lowLevelErr)
+		}
+	case 'O':
+		prototype := world.ObjectPrototypes[args[0]]
+		if prototype == nil {
+			return command.errorf("object %v does not exist", args[0])
+		}
+
+		room := world.FindRoomByVNum(args[2])
+		if room == nil {
+			return command.errorf("room %v does not exist", args[2])
+		}
+
+		object := absmachine.NewObjectFromPrototype(prototype)
+		if lowLevelErr := world.AddObjects([]*absmachine.Object{object}); lowLevelErr != nil {
+			return command.errorf("%v", lowLevelErr)
+		}
+
+		if lowLevelErr := object.RelocateToRoom(room); lowLevelErr != nil {
+			return command.errorf("%v", lowLevelErr)
+		}
+	case 'G', 'E', 'P':
+		// No inventories, so these are left out. The objects must exist, though.
+		if world.ObjectPrototypes[args[0]] == nil {
+			return command.errorf("object %v does not exist", args[0])
+		}
+	case 'D':
+		room := world.FindRoomByVNum(args[0])
+		if room == nil {
+			return command.errorf("room %v does not exist", args[0])
+		}
+
+		if args[1] < 0 || args[1] >= len(circleDirections) {
+			return command.errorf("unknown direction %v", args[1])
+		}
+
+		details := room.ExitDetails[circleDirections[args[1]]]
+		if details == nil || !details.Flags.HasFlag(absmachine.EX_DOOR) {
+			return command.errorf("room %v has no door in direction %v", args[0], args[1])
+		}
+
+		// Doors are left open, since they can't be opened (or unlocked) again. The state must be valid, though.
+		if args[2] < 0 || args[2] > 2 {
+			return command.errorf("unknown door state %v", args[2])
+		}
+	case 'R':
+		// Removing objects only matters when a zone is reset, and it's only loaded once
+	}
+
+	return nil
+}
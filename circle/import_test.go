@@ -0,0 +1,263 @@
+package circle
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+)
+
+const testRooms = `#3001
+The Temple Of Midgaard~
+   You are in the southern end of the temple hall in the Temple of Midgaard.
+~
+30 d 0
+D0
+You see the temple altar.
+~
+~
+0 -1 3054
+D2
+The door leads out of the temple.
+~
+door oak~
+1 3099 3005
+E
+altar~
+The altar is made of marble.
+~
+S
+#3005
+The Temple Square~
+   You are standing on the temple square.
+~
+30 0 1
+D0
+~
+door oak~
+1 3099 3001
+S
+#3054
+By The Temple Altar~
+   You are by the temple altar.
+~
+30 8 0
+D2
+~
+~
+0 -1 3001
+S
+$~
+`
+
+const testMobs = `#3000
+wizard~
+the wizard~
+A wizard walks around behind the counter, talking to himself.
+~
+The wizard looks old and senile, and yet he looks like a very powerful
+wizard.  He is dressed in a fine robe.
+~
+abfj 0 900 S
+33 2 2 1d1+30000 2d8+18
+30000 160000
+8 8 1
+#3001
+baker~
+the baker~
+The baker looks at you calmly, wiping flour from his face with one hand.
+~
+A fat, nice looking baker.
+~
+bj 0 900 E
+33 2 2 1d1+30000 2d8+18
+30000 160000
+8 8 1
+BareHandAttack: 12
+E
+$
+`
+
+const testObjects = `#3099
+key oak~
+an oak key~
+An oak key has been left here.~
+~
+18 0 a
+3001 0 0 0
+1 10 0
+#3010
+bread loaf~
+a loaf of bread~
+A loaf of bread has been left here.~
+~
+19 0 a
+24 0 0 0
+1 10 0
+E
+bread loaf~
+It looks delicious.
+~
+A
+1 2
+$
+`
+
+const testZones = `#30
+Northern Midgaard Main City~
+3099 15 2
+* The temple
+M 0 3000 1 3001 	(the wizard)
+G 1 3099 1 			(an oak key)
+O 0 3010 5 3054 	(a loaf of bread)
+D 0 3001 2 2 		(temple door)
+S
+$
+`
+
+func writeAreaFiles(t *testing.T, files map[string]string) string {
+	directory := t.TempDir()
+
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(directory, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("Failed to write area file: %v", err)
+		}
+	}
+
+	return directory
+}
+
+func Test_ImportDirectory(t *testing.T) {
+	// Arrange
+	directory := writeAreaFiles(t, map[string]string{
+		"30.wld": testRooms,
+		"30.mob": testMobs,
+		"30.obj": testObjects,
+		"30.zon": testZones,
+	})
+
+	// Act
+	world, err := ImportDirectory(directory, 3001)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	temple := world.FindRoomByVNum(3001)
+	square := world.FindRoomByVNum(3005)
+	altar := world.FindRoomByVNum(3054)
+	if temple == nil || square == nil || altar == nil || world.StartRoom != temple {
+		t.Fatalf("Rooms were not imported: %+v", world.Rooms)
+	}
+
+	if temple.Title != "The Temple Of Midgaard" || !strings.HasPrefix(temple.Description, "   You are in the southern end") {
+		t.Errorf("Unexpected room: %q, %q", temple.Title, temple.Description)
+	}
+
+	// Circle's D0 is north, D2 is south
+	if temple.AdjacentRooms[absmachine.DIR_NORTH] != altar || temple.AdjacentRooms[absmachine.DIR_SOUTH] != square || square.AdjacentRooms[absmachine.DIR_NORTH] != temple {
+		t.Error("Exits were not imported")
+	}
+
+	if details := temple.ExitDetails[absmachine.DIR_NORTH]; details == nil || details.Description != "You see the temple altar." || details.Flags != 0 {
+		t.Errorf("Unexpected exit details: %+v", details)
+	}
+
+	door := temple.ExitDetails[absmachine.DIR_SOUTH]
+	if door == nil || door.Keywords != "door oak" || door.KeyVNum != 3099 {
+		t.Fatalf("Unexpected door: %+v", door)
+	}
+
+	// The zone locks the door, but doors are left open
+	if door.Flags != absmachine.EX_DOOR {
+		t.Errorf("Unexpected door flags: %v", door.Flags)
+	}
+
+	if altar.ExitDetails[absmachine.DIR_SOUTH] != nil {
+		t.Error("Plain exit was given details")
+	}
+
+	if len(world.MobPrototypes) != 2 || len(world.ObjectPrototypes) != 2 {
+		t.Fatalf("Unexpected prototypes: %v, %v", world.MobPrototypes, world.ObjectPrototypes)
+	}
+
+	if len(temple.Mobs) != 1 || temple.Mobs[0].Name != "the wizard" || temple.Mobs[0].Prototype != world.MobPrototypes[3000] {
+		t.Fatalf("Mob was not loaded: %+v", temple.Mobs)
+	}
+
+	if temple.Mobs[0].RoomDescription != "A wizard walks around behind the counter, talking to himself." {
+		t.Errorf("Unexpected room description: %q", temple.Mobs[0].RoomDescription)
+	}
+
+	if len(altar.Objects) != 1 || altar.Objects[0].Name != "a loaf of bread" || altar.Objects[0].Description != "It looks delicious." {
+		t.Errorf("Object was not loaded: %+v", altar.Objects)
+	}
+
+	if len(world.Objects) != 1 {
+		t.Errorf("Objects given to mobs were loaded: %+v", world.Objects)
+	}
+}
+
+func Test_Import_ParseErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		file          string
+		contents      string
+		expectedLine  int
+		expectedError string
+	}{
+		{"room section", "a.wld", "#1\nRoom~\nDesc~\n0 0 0\nX\nS\n$\n", 5, "unsupported room section"},
+		{"door type", "a.wld", "#1\nRoom~\nDesc~\n0 0 0\nD0\n~\n~\n7 -1 1\nS\n$\n", 8, "unsupported door type"},
+		{"direction", "a.wld", "#1\nRoom~\nDesc~\n0 0 0\nD9\n~\n~\n0 -1 1\nS\n$\n", 5, "unknown direction"},
+		{"room trigger", "a.wld", "#1\nRoom~\nDesc~\n0 0 0\nS\nT 100\n$\n", 6, "triggers"},
+		{"flags", "a.wld", "#1\nRoom~\nDesc~\n0 !! 0\nS\n$\n", 4, "bit vector"},
+		{"reserved vnum", "a.wld", "#0\nRoom~\nDesc~\n0 0 0\nS\n$\n", 1, "reserved"},
+		{"end of file", "a.wld", "#1\nRoom~\n", 2, "end of file"},
+		{"mob type", "a.mob", "#1\ncow~\na cow~\nA cow.\n~\nMoo.\n~\n0 0 0 X\n", 8, "unsupported mob type"},
+		{"object section", "a.obj", "#1\nrock~\na rock~\nA rock.~\n~\n13 0 a\n0 0 0 0\n1 1 1\nQ\n$\n", 9, "unsupported object section"},
+		{"zone command", "a.zon", "#1\nZone~\n99 15 2\nX 0 1 2 3\nS\n$\n", 4, "unsupported zone command"},
+		{"zone arguments", "a.zon", "#1\nZone~\n99 15 2\nM 0 1\nS\n$\n", 4, "arguments"},
+		{"zone mob", "a.zon", "#1\nZone~\n99 15 2\nM 0 1 1 1\nS\n$\n", 4, "mob 1 does not exist"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			directory := writeAreaFiles(t, map[string]string{testCase.file: testCase.contents})
+
+			_, err := ImportDirectory(directory, 0)
+
+			var parseErrors ParseErrors
+			if !errors.As(err, &parseErrors) || len(parseErrors) == 0 {
+				t.Fatalf("Expected parse errors, got: %v", err)
+			}
+
+			if parseErrors[0].Line != testCase.expectedLine || !strings.Contains(parseErrors[0].Message, testCase.expectedError) {
+				t.Errorf("Expected error containing %q on line %v, got: %v", testCase.expectedError, testCase.expectedLine, parseErrors[0])
+			}
+		})
+	}
+}
+
+func Test_Import_CollectsErrorsFromAllRecords(t *testing.T) {
+	// Arrange
+	directory := writeAreaFiles(t, map[string]string{
+		"a.wld": "#1\nOne~\nDesc~\n0 0 0\nX\nS\n#2\nTwo~\nDesc~\n0 0 0\nD0\n~\n~\n0 -1 3\nS\n#3\nThree~\nDesc~\n0 0 0\nY\nS\n$\n",
+	})
+
+	// Act
+	_, err := ImportDirectory(directory, 0)
+
+	// Assert
+	var parseErrors ParseErrors
+	if !errors.As(err, &parseErrors) || len(parseErrors) != 2 {
+		t.Fatalf("Expected two parse errors, got: %v", err)
+	}
+
+	if parseErrors[0].Line != 5 || parseErrors[1].Line != 20 {
+		t.Errorf("Unexpected lines: %v", err)
+	}
+}
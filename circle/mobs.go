@@ -0,0 +1,110 @@
+package circle
+
+import (
+	"io"
+	"strings"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+)
+
+type mobRecord struct {
+	location
+	prototype *absmachine.MobPrototype
+}
+
+// Parses a .mob file
+func parseMobs(file string, input io.Reader) ([]*mobRecord, ParseErrors) {
+	r := newReader(file, input)
+	var records []*mobRecord
+
+	errors := r.parseRecords(func(vnum int, start location) *ParseError {
+		prototype, err := parseMob(r, vnum)
+		if err == nil {
+			records = append(records, &mobRecord{location: start, prototype: prototype})
+		}
+		return err
+	})
+
+	return records, errors
+}
+
+func parseMob(r *reader, vnum int) (*absmachine.MobPrototype, *ParseError) {
+	prototype := &absmachine.MobPrototype{VNum: vnum}
+
+	// Keywords are not used, the short description is what the mob is called
+	if _, err := r.readString(); err != nil {
+		return nil, err
+	}
+
+	var err *ParseError
+	if prototype.Name, err = r.readString(); err != nil {
+		return nil, err
+	}
+
+	if prototype.RoomDescription, err = r.readString(); err != nil {
+		return nil, err
+	}
+
+	if prototype.Description, err = r.readString(); err != nil {
+		return nil, err
+	}
+
+	// Action flags, affection flags, (more flags in some derivatives,) alignment, mob type
+	fields, err := r.readFields(4)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields[:2] {
+		if _, err = r.parseBitVector(field); err != nil {
+			return nil, err
+		}
+	}
+
+	mobType := fields[len(fields)-1]
+	if mobType != "S" && mobType != "E" {
+		return nil, r.errorf("unsupported mob type %q", mobType)
+	}
+
+	// Level, THAC0, armor class, hit points and damage. Our mobs don't fight (yet).
+	if _, err = r.readFields(5); err != nil {
+		return nil, err
+	}
+
+	// Gold, experience
+	if _, err = r.readNumbers(2); err != nil {
+		return nil, err
+	}
+
+	// Load position, default position, sex
+	if _, err = r.readNumbers(3); err != nil {
+		return nil, err
+	}
+
+	if mobType == "E" {
+		if err = skipEnhancedSpecs(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return prototype, checkForTriggers(r)
+}
+
+// Enhanced mobs have "Name: value" lines, ended by "E". We don't have any use for them.
+func skipEnhancedSpecs(r *reader) *ParseError {
+	for {
+		text, err := r.nextNonBlank()
+		if err != nil {
+			return err
+		}
+
+		text = strings.TrimSpace(text)
+		if text == "E" {
+			return nil
+		}
+
+		if !strings.Contains(text, ":") {
+			return r.errorf("unsupported enhanced mob specification %q", text)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package circle
+
+import (
+	"io"
+	"strings"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+)
+
+type objectRecord struct {
+	location
+	prototype *absmachine.ObjectPrototype
+}
+
+// Parses an .obj file
+func parseObjects(file string, input io.Reader) ([]*objectRecord, ParseErrors) {
+	r := newReader(file, input)
+	var records []*objectRecord
+
+	errors := r.parseRecords(func(vnum int, start location) *ParseError {
+		prototype, err := parseObject(r, vnum)
+		if err == nil {
+			records = append(records, &objectRecord{location: start, prototype: prototype})
+		}
+		return err
+	})
+
+	return records, errors
+}
+
+func parseObject(r *reader, vnum int) (*absmachine.ObjectPrototype, *ParseError) {
+	prototype := &absmachine.ObjectPrototype{VNum: vnum}
+
+	// Keywords are not used, the short description is what the object is called
+	if _, err := r.readString(); err != nil {
+		return nil, err
+	}
+
+	var err *ParseError
+	if prototype.Name, err = r.readString(); err != nil {
+		return nil, err
+	}
+
+	if prototype.RoomDescription, err = r.readString(); err != nil {
+		return nil, err
+	}
+
+	// Action description, used when the object is used. We don't use objects (yet).
+	if _, err = r.readString(); err != nil {
+		return nil, err
+	}
+
+	// Type, extra flags, wear flags (and more flags in some derivatives)
+	fields, err := r.readFields(3)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = r.parseNumber(fields[0]); err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields[1:3] {
+		if _, err = r.parseBitVector(field); err != nil {
+			return nil, err
+		}
+	}
+
+	// Values, whose meaning depend on the type
+	if _, err = r.readNumbers(4); err != nil {
+		return nil, err
+	}
+
+	// Weight, cost, rent (and more in some derivatives)
+	if _, err = r.readNumbers(3); err != nil {
+		return nil, err
+	}
+
+	for {
+		text, err := r.peek()
+		if err != nil {
+			return nil, err
+		}
+
+		text = strings.TrimSpace(text)
+		switch {
+		case strings.HasPrefix(text, "#"), strings.HasPrefix(text, "$"):
+			if prototype.Description == "" {
+				prototype.Description = prototype.RoomDescription
+			}
+			return prototype, nil
+		case text == "":
+			r.next()
+		case text == "E":
+			// The first extra description is what is seen when looking at the object
+			r.next()
+			if _, err = r.readString(); err != nil {
+				return nil, err
+			}
+
+			description, err := r.readString()
+			if err != nil {
+				return nil, err
+			}
+
+			if prototype.Description == "" {
+				prototype.Description = description
+			}
+		case text == "A":
+			// Applies (affects on the wearer) are not supported by the world, so they are read and thrown away
+			r.next()
+			if _, err = r.readNumbers(2); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(text, "T "):
+			r.next()
+			return nil, r.errorf("scripts (triggers) are not supported")
+		default:
+			r.next()
+			return nil, r.errorf("unsupported object section %q", text)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package circle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A problem found in a CircleMUD file, with the line it was found on
+type ParseError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	switch {
+	case e.File == "":
+		return e.Message
+	case e.Line == 0:
+		return fmt.Sprintf("%v: %v", e.File, e.Message)
+	default:
+		return fmt.Sprintf("%v:%v: %v", e.File, e.Line, e.Message)
+	}
+}
+
+// All problems found during an import
+type ParseErrors []*ParseError
+
+func (errors ParseErrors) Error() string {
+	messages := make([]string, len(errors))
+	for i, err := range errors {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// Where something was read from, so that problems found later on can be reported
+type location struct {
+	file string
+	line int
+}
+
+func (l location) errorf(format string, args ...interface{}) *ParseError {
+	return &ParseError{File: l.file, Line: l.line, Message: fmt.Sprintf(format, args...)}
+}
+
+// Reads a CircleMUD file line by line, keeping track of line numbers
+type reader struct {
+	file    string
+	scanner *bufio.Scanner
+	line    int    // Number of the line most recently read
+	text    string // Text of the line most recently read
+	peeked  bool   // If true, `text` has been peeked at, and is returned again by the next call to next()
+	eof     bool
+}
+
+func newReader(file string, r io.Reader) *reader {
+	return &reader{file: file, scanner: bufio.NewScanner(r)}
+}
+
+func (r *reader) location() location {
+	return location{file: r.file, line: r.line}
+}
+
+func (r *reader) errorf(format string, args ...interface{}) *ParseError {
+	return r.location().errorf(format, args...)
+}
+
+// Returns the next line, without its line ending
+func (r *reader) next() (string, *ParseError) {
+	if r.peeked {
+		r.peeked = false
+		return r.text, nil
+	}
+
+	if r.eof || !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", r.errorf("%v", err)
+		}
+
+		r.eof = true
+		return "", r.errorf("unexpected end of file")
+	}
+
+	r.line++
+	r.text = strings.TrimRight(r.scanner.Text(), "\r")
+	return r.text, nil
+}
+
+// Returns the next line, but leaves it to be read again
+func (r *reader) peek() (string, *ParseError) {
+	text, err := r.next()
+	if err == nil {
+		r.peeked = true
+	}
+
+	return text, err
+}
+
+// Returns the next line that is not blank
+func (r *reader) nextNonBlank() (string, *ParseError) {
+	for {
+		text, err := r.next()
+		if err != nil || strings.TrimSpace(text) != "" {
+			return text, err
+		}
+	}
+}
+
+// Reads a string terminated by a tilde, which may span several lines. Lines are joined with "\r\n", and
+// trailing line breaks are removed.
+func (r *reader) readString() (string, *ParseError) {
+	var lines []string
+
+	for {
+		text, err := r.next()
+		if err != nil {
+			return "", err
+		}
+
+		if index := strings.IndexByte(text, '~'); index >= 0 {
+			lines = append(lines, text[:index])
+			return strings.TrimRight(strings.Join(lines, "\r\n"), "\r\n"), nil
+		}
+
+		lines = append(lines, text)
+	}
+}
+
+// Reads a line of whitespace separated fields, of which there must be at least `minimum`
+func (r *reader) readFields(minimum int) ([]string, *ParseError) {
+	text, err := r.nextNonBlank()
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) < minimum {
+		return nil, r.errorf("expected at least %v fields, found %v", minimum, len(fields))
+	}
+
+	return fields, nil
+}
+
+// Reads a line of numbers, of which there must be at least `minimum`. Only the first `minimum` numbers are returned.
+func (r *reader) readNumbers(minimum int) ([]int, *ParseError) {
+	fields, err := r.readFields(minimum)
+	if err != nil {
+		return nil, err
+	}
+
+	numbers := make([]int, minimum)
+	for i := range numbers {
+		if numbers[i], err = r.parseNumber(fields[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return numbers, nil
+}
+
+func (r *reader) parseNumber(text string) (int, *ParseError) {
+	number, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, r.errorf("%q is not a number", text)
+	}
+
+	return number, nil
+}
+
+// Parses a bit vector, which is either a number or a string of flag letters (a-z for bits 0-25, A-F for bits 26-31)
+func (r *reader) parseBitVector(text string) (uint32, *ParseError) {
+	if number, err := strconv.ParseUint(text, 10, 32); err == nil {
+		return uint32(number), nil
+	}
+
+	var flags uint32
+	for _, c := range text {
+		switch {
+		case c >= 'a' && c <= 'z':
+			flags |= 1 << (c - 'a')
+		case c >= 'A' && c <= 'F':
+			flags |= 1 << (26 + c - 'A')
+		default:
+			return 0, r.errorf("%q is not a bit vector", text)
+		}
+	}
+
+	return flags, nil
+}
+
+// Reads the "#<vnum>" line that starts a record. Returns false if the end of the file marker ("$") was read instead.
+func (r *reader) readRecordStart() (int, bool, *ParseError) {
+	text, err := r.nextNonBlank()
+	if err != nil {
+		return 0, false, err
+	}
+
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "$") {
+		return 0, false, nil
+	}
+
+	if !strings.HasPrefix(text, "#") {
+		return 0, false, r.errorf("expected a record starting with #, found %q", text)
+	}
+
+	vnum, err := r.parseNumber(strings.TrimSpace(text[1:]))
+	if err != nil {
+		return 0, false, err
+	}
+
+	if vnum <= 0 {
+		return 0, false, r.errorf("virtual number %v is reserved, and can't be imported", vnum)
+	}
+
+	return vnum, true, nil
+}
+
+// After an error, skips to the next line that starts a record, so that further errors in the file can be found
+func (r *reader) skipToNextRecord() {
+	for {
+		text, err := r.next()
+		if err != nil {
+			return
+		}
+
+		if strings.HasPrefix(text, "#") || strings.HasPrefix(text, "$") {
+			r.peeked = true
+			return
+		}
+	}
+}
+
+// Parses all records in a file with `parseRecord`, collecting the errors
+func (r *reader) parseRecords(parseRecord func(vnum int, start location) *ParseError) ParseErrors {
+	var errors ParseErrors
+
+	for {
+		vnum, found, err := r.readRecordStart()
+		if err == nil && !found {
+			return errors
+		}
+
+		if err == nil {
+			err = parseRecord(vnum, r.location())
+		}
+
+		if err != nil {
+			errors = append(errors, err)
+			if r.eof {
+				return errors
+			}
+			r.skipToNextRecord()
+		}
+	}
+}
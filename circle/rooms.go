@@ -0,0 +1,173 @@
+package circle
+
+import (
+	"io"
+	"strings"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+)
+
+// CircleMUD numbers its directions differently from us
+var circleDirections = []absmachine.Direction{
+	absmachine.DIR_NORTH,
+	absmachine.DIR_EAST,
+	absmachine.DIR_SOUTH,
+	absmachine.DIR_WEST,
+	absmachine.DIR_UP,
+	absmachine.DIR_DOWN,
+}
+
+const noWhere = -1 // Circle's virtual number for "no room", and for "no key"
+
+type roomRecord struct {
+	location
+	room  *absmachine.Room
+	exits []exitRecord
+}
+
+// An exit refers to its room by virtual number, since the room may be defined in a file not yet read
+type exitRecord struct {
+	location
+	direction absmachine.Direction
+	toRoom    int
+	details   *absmachine.ExitDetails
+}
+
+// Parses a .wld file
+func parseRooms(file string, input io.Reader) ([]*roomRecord, ParseErrors) {
+	r := newReader(file, input)
+	var records []*roomRecord
+
+	errors := r.parseRecords(func(vnum int, start location) *ParseError {
+		record, err := parseRoom(r, vnum, start)
+		if err == nil {
+			records = append(records, record)
+		}
+		return err
+	})
+
+	return records, errors
+}
+
+func parseRoom(r *reader, vnum int, start location) (*roomRecord, *ParseError) {
+	record := &roomRecord{location: start, room: absmachine.NewRoom()}
+	record.room.VNum = vnum
+
+	var err *ParseError
+	if record.room.Title, err = r.readString(); err != nil {
+		return nil, err
+	}
+
+	if record.room.Description, err = r.readString(); err != nil {
+		return nil, err
+	}
+
+	// Zone number, room flags, (more flags in some derivatives,) sector type. None of them are used.
+	fields, err := r.readFields(3)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = r.parseNumber(fields[0]); err != nil {
+		return nil, err
+	}
+
+	if _, err = r.parseBitVector(fields[1]); err != nil {
+		return nil, err
+	}
+
+	for {
+		text, err := r.nextNonBlank()
+		if err != nil {
+			return nil, err
+		}
+
+		text = strings.TrimSpace(text)
+		switch {
+		case text == "S":
+			return record, checkForTriggers(r)
+		case strings.HasPrefix(text, "D"):
+			exit, err := parseExit(r, text)
+			if err != nil {
+				return nil, err
+			}
+			record.exits = append(record.exits, exit)
+		case text == "E":
+			// Extra descriptions are not supported by the world, so they are read and thrown away
+			if _, err = r.readString(); err != nil {
+				return nil, err
+			}
+			if _, err = r.readString(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, r.errorf("unsupported room section %q", text)
+		}
+	}
+}
+
+// Parses a "D<direction>" section of a room
+func parseExit(r *reader, text string) (exitRecord, *ParseError) {
+	exit := exitRecord{location: r.location()}
+
+	circleDirection, err := r.parseNumber(strings.TrimSpace(text[1:]))
+	if err != nil {
+		return exit, err
+	}
+
+	if circleDirection < 0 || circleDirection >= len(circleDirections) {
+		return exit, r.errorf("unknown direction %v", circleDirection)
+	}
+	exit.direction = circleDirections[circleDirection]
+
+	details := &absmachine.ExitDetails{}
+	if details.Description, err = r.readString(); err != nil {
+		return exit, err
+	}
+
+	if details.Keywords, err = r.readString(); err != nil {
+		return exit, err
+	}
+
+	// Door type, key, room the exit leads to
+	numbers, err := r.readNumbers(3)
+	if err != nil {
+		return exit, err
+	}
+
+	switch numbers[0] {
+	case 0:
+	case 1:
+		details.Flags.SetFlag(absmachine.EX_DOOR)
+	case 2:
+		details.Flags.SetFlag(absmachine.EX_DOOR | absmachine.EX_PICKPROOF)
+	default:
+		return exit, r.errorf("unsupported door type %v", numbers[0])
+	}
+
+	if numbers[1] != noWhere {
+		details.KeyVNum = numbers[1]
+	}
+
+	exit.toRoom = numbers[2]
+	if details.Description != "" || details.Keywords != "" || details.Flags != 0 || details.KeyVNum != 0 {
+		exit.details = details
+	}
+
+	return exit, nil
+}
+
+// Some CircleMUD derivatives attach scripts with "T <vnum>" lines after a record. We don't run scripts.
+func checkForTriggers(r *reader) *ParseError {
+	text, err := r.peek()
+	if err != nil {
+		return nil // End of file is reported by whoever reads next
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(text), "T ") {
+		r.next()
+		return r.errorf("scripts (triggers) are not supported")
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package circle
+
+import (
+	"io"
+	"strings"
+)
+
+// A zone reset command, e.g. "M 0 3010 1 3062" (load mob 3010 into room 3062)
+type zoneCommand struct {
+	location
+	command byte
+	args    []int // Arguments after the "if" flag
+}
+
+type zoneRecord struct {
+	vnum     int
+	name     string
+	commands []zoneCommand
+}
+
+// Number of arguments after the "if" flag, for each supported zone command
+var zoneCommandArgs = map[byte]int{
+	'M': 3, // Load mob: mob vnum, max in world, room vnum
+	'O': 3, // Load object: object vnum, max in world, room vnum
+	'G': 2, // Give object to the last loaded mob: object vnum, max in world
+	'E': 3, // Equip the last loaded mob with an object: object vnum, max in world, wear position
+	'P': 3, // Put object into another object: object vnum, max in world, container vnum
+	'D': 3, // Set door state: room vnum, direction, state
+	'R': 2, // Remove object from room: room vnum, object vnum
+}
+
+// Parses a .zon file
+func parseZones(file string, input io.Reader) ([]*zoneRecord, ParseErrors) {
+	r := newReader(file, input)
+	var records []*zoneRecord
+
+	errors := r.parseRecords(func(vnum int, start location) *ParseError {
+		record, err := parseZone(r, vnum)
+		if err == nil {
+			records = append(records, record)
+		}
+		return err
+	})
+
+	return records, errors
+}
+
+func parseZone(r *reader, vnum int) (*zoneRecord, *ParseError) {
+	record := &zoneRecord{vnum: vnum}
+
+	var err *ParseError
+	if record.name, err = r.readString(); err != nil {
+		return nil, err
+	}
+
+	// Some derivatives have a line with the builders before the name
+	text, err := r.peek()
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.Contains(text, "~") {
+		if record.name, err = r.readString(); err != nil {
+			return nil, err
+		}
+	}
+
+	// (Bottom room,) top room, lifespan, reset mode (and zone flags in some derivatives)
+	if _, err = r.readNumbers(3); err != nil {
+		return nil, err
+	}
+
+	for {
+		text, err := r.nextNonBlank()
+		if err != nil {
+			return nil, err
+		}
+
+		text = strings.TrimSpace(text)
+		switch {
+		case text == "S":
+			return record, nil
+		case strings.HasPrefix(text, "*"):
+			// Comment
+		default:
+			command, err := parseZoneCommand(r, text)
+			if err != nil {
+				return nil, err
+			}
+			record.commands = append(record.commands, command)
+		}
+	}
+}
+
+func parseZoneCommand(r *reader, text string) (zoneCommand, *ParseError) {
+	command := zoneCommand{location: r.location(), command: text[0]}
+
+	if command.command == 'T' || command.command == 'V' {
+		return command, r.errorf("scripts (triggers) are not supported")
+	}
+
+	numArgs, found := zoneCommandArgs[command.command]
+	if !found {
+		return command, r.errorf("unsupported zone command %q", text[:1])
+	}
+
+	// Anything after the arguments is a comment
+	fields := strings.Fields(text[1:])
+	if len(fields) < numArgs+1 {
+		return command, r.errorf("zone command %q needs %v arguments", text[:1], numArgs+1)
+	}
+
+	for i, field := range fields[:numArgs+1] {
+		arg, err := r.parseNumber(field)
+		if err != nil {
+			return command, err
+		}
+
+		if i > 0 {
+			command.args = append(command.args, arg)
+		}
+	}
+
+	return command, nil
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// The server configuration. Values not present in a configuration file keep their defaults.
+type Config struct {
+	Port              int    // TCP port for plain telnet connections
+	TlsPort           int    // TCP port for encrypted (TLS) telnet connections, 0 for none
+	TlsCertificate    string // PEM file with the certificate (chain) of the TLS listener
+	TlsKey            string // PEM file with the private key of the TLS listener
+	TlsSelfSigned     bool   // Generate a self-signed certificate and key if the files don't exist (for development)
+	WebSocketPort     int    // TCP port of the HTTP server where browsers connect with WebSockets, 0 for none
+	SshPort           int    // TCP port for SSH connections, 0 for none
+	SshHostKey        string // PEM file with the private host key of the SSH listener, generated if it doesn't exist
+	AccountsDirectory string // Directory where player accounts are stored
+	MaxLoginAttempts  int    // Number of failed password attempts before a connection is dropped
+	WorldSnapshotPath string // File where the state of the world is saved on shutdown, and loaded from on startup
+	AreasDirectory    string // Directory with area files, which the world is built from on startup
+	AdminLevel        int    // Players of this level and above may use admin commands
+	CopyoverStatePath string // File where connections are handed over to the next process during a copyover
+	MudName           string // The name of the MUD, as reported to MUD listing sites
+
+	MsspVariables map[string]string // Additional variables reported to MUD listing sites (e.g. CONTACT, WEBSITE, GENRE)
+
+	WebSocketAllowedOrigins []string // Origins (e.g. "https://play.example.com") of the web pages that may open browser sessions, by default only those served by the same host
+
+	CircleAreasDirectory string // If set, the world is imported from the CircleMUD area files in this directory instead of built from area files
+	CircleStartRoom      int    // Virtual number of the start room in an imported CircleMUD world, 0 for the lowest numbered room
+}
+
+func Default() *Config {
+	return &Config{
+		Port:              5000,
+		TlsCertificate:    "gomud.crt",
+		TlsKey:            "gomud.key",
+		SshHostKey:        "gomud_ssh_host_key",
+		AccountsDirectory: "players",
+		MaxLoginAttempts:  3,
+		WorldSnapshotPath: "world.json",
+		AreasDirectory:    "areas",
+		AdminLevel:        50,
+		CopyoverStatePath: "copyover.json",
+		MudName:           "Go MUD",
+	}
+}
+
+// Loads a JSON configuration file on top of the default configuration
+func Load(path string) (*Config, error) {
+	config := Default()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
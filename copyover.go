@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net"
+	"os"
+	"sync"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/io"
+	"github.com/jorgensigvardsson/gomud/logging"
+)
+
+// Picks up the listener handed over by the previous process in a copyover
+func recoverListener(state *io.CopyoverState) (net.Listener, error) {
+	file := os.NewFile(state.ListenerFd, "listener")
+	defer file.Close()
+
+	return net.FileListener(file)
+}
+
+// Reattaches the connections handed over by the previous process in a copyover to their players. Players
+// without a connection are removed from the world.
+func reattachSessions(state *io.CopyoverState, world *absmachine.World, logger logging.Logger, commandChannel chan<- *io.PlayerInput, connectionsStopChannel <-chan interface{}, detacher *io.Detacher, wg *sync.WaitGroup) {
+	reattached := make(map[*absmachine.Player]bool)
+
+	for _, session := range state.Sessions {
+		file := os.NewFile(session.Fd, session.PlayerName)
+		conn, err := net.FileConn(file)
+		file.Close()
+
+		if err != nil {
+			logger.Printlnf("Failed to recover connection of %v: %v", session.PlayerName, err)
+			continue
+		}
+
+		player := world.FindPlayerByName(session.PlayerName)
+		if player == nil {
+			logger.Printlnf("Player %v is no longer in the world, dropping connection", session.PlayerName)
+			conn.Close()
+			continue
+		}
+
+		// Commands in progress did not survive the copyover
+		player.State.ClearFlag(absmachine.PS_BUSY)
+		reattached[player] = true
+
+		go io.HandleReattachedConnection(conn, player, session, logger, commandChannel, connectionsStopChannel, detacher, wg)
+	}
+
+	for _, player := range append([]*absmachine.Player(nil), world.Players...) {
+		if !reattached[player] {
+			absmachine.DestroyPlayer(player)
+		}
+	}
+
+	logger.Printlnf("Recovered %v connections after copyover.", len(reattached))
+}
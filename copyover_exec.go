@@ -0,0 +1,49 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/jorgensigvardsson/gomud/config"
+	"github.com/jorgensigvardsson/gomud/io"
+)
+
+// Replaces this process with a fresh copy of the binary, handing over the listener and the detached sessions.
+// Only returns if something went wrong.
+func execCopyover(cfg *config.Config, configPath string, listenerFile *os.File, sessions []*io.DetachedSession, startTime time.Time) error {
+	state := &io.CopyoverState{ListenerFd: listenerFile.Fd(), Sessions: sessions, StartTime: startTime.Unix()}
+	files := []*os.File{listenerFile}
+
+	for _, session := range sessions {
+		session.Fd = session.File.Fd()
+		files = append(files, session.File)
+	}
+
+	// Go opens all files with close-on-exec set, so it must be cleared for the files to be inherited
+	for _, file := range files {
+		if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, file.Fd(), syscall.F_SETFD, 0); errno != 0 {
+			return errno
+		}
+	}
+
+	err := io.SaveCopyoverState(state, cfg.CopyoverStatePath)
+	if err != nil {
+		return err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	err = syscall.Exec(executable, []string{os.Args[0], "-config", configPath, "-copyover", cfg.CopyoverStatePath}, os.Environ())
+
+	// The files must not be closed (by finalizers) before the exec
+	runtime.KeepAlive(files)
+	return err
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/jorgensigvardsson/gomud/config"
+	"github.com/jorgensigvardsson/gomud/io"
+)
+
+func execCopyover(cfg *config.Config, configPath string, listenerFile *os.File, sessions []*io.DetachedSession, startTime time.Time) error {
+	return errors.New("copyover is not supported on Windows")
+}
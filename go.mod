@@ -1,3 +1,7 @@
 module github.com/jorgensigvardsson/gomud
 
-go 1.16
+go 1.26.0
+
+require golang.org/x/crypto v0.57.0
+
+require golang.org/x/sys v0.48.0 // indirect
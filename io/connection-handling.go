@@ -1,6 +1,8 @@
 package io
 
 import (
+	"bufio"
+	"encoding/json"
 	"errors"
 	"net"
 	"strings"
@@ -8,11 +10,12 @@ import (
 
 	"github.com/jorgensigvardsson/gomud/absmachine"
 	"github.com/jorgensigvardsson/gomud/ansi"
+	"github.com/jorgensigvardsson/gomud/charset"
 	"github.com/jorgensigvardsson/gomud/logging"
 	"github.com/jorgensigvardsson/gomud/mudio"
 )
 
-func HandleConnections(listener net.Listener, logger logging.Logger, commandChannel chan<- *PlayerInput, listenerErrorChannel chan<- error, connectionsStopChannel <-chan interface{}, wg *sync.WaitGroup) {
+func HandleConnections(listener net.Listener, logger logging.Logger, commandChannel chan<- *PlayerInput, listenerErrorChannel chan<- error, connectionsStopChannel <-chan interface{}, detach *Detacher, wg *sync.WaitGroup) {
 	wg.Add(1)
 	defer wg.Done()
 
@@ -24,52 +27,176 @@ func HandleConnections(listener net.Listener, logger logging.Logger, commandChan
 			return
 		}
 
-		go handleConnection(conn, logger, commandChannel, connectionsStopChannel, wg)
+		go handleConnection(conn, logger, commandChannel, connectionsStopChannel, detach, wg)
 	}
 }
 
-func handleConnection(tcpConnection net.Conn, logger logging.Logger, commandChannel chan<- *PlayerInput, connectionsStopChannel <-chan interface{}, wg *sync.WaitGroup) {
+func handleConnection(tcpConnection net.Conn, logger logging.Logger, commandChannel chan<- *PlayerInput, connectionsStopChannel <-chan interface{}, detach *Detacher, wg *sync.WaitGroup) {
 	wg.Add(1)
 	defer wg.Done()
 
 	// TODO: Check if connection is allowed to connect (IP blocks, etc), before wasting too many CPU cycles
-	player := absmachine.NewPlayer()
-	errorReturnChannel := make(chan error, 1)
-	lineInputChannel := make(chan LineInput, 1)
-	outputChannel := make(chan *PlayerOutput, 10)
-	telnetConnectionObserver := playerTelnetConnectionObserver{logger: logger, player: player}
+	if !completeTlsHandshake(tcpConnection, logger, connectionsStopChannel, detach) {
+		tcpConnection.Close()
+		return
+	}
+
+	session := newConnectionSession(logger, isSecure(tcpConnection))
 
 	// Whip up a TELNET connection (along with an observer)
 	connection := NewTelnetConnection(
 		tcpConnection,
-		&telnetConnectionObserver,
+		session.observer,
 		logger,
 	)
 
 	// Kick off a terminal query!
 	connection.QueryTerminal()
+	connection.QueryWindowSize()
+	connection.OfferCompression()
+	connection.OfferGmcp()
+	connection.OfferMssp()
+	connection.OfferCharset()
+	connection.OfferEndOfRecord()
+
+	// The bootstrapping command: Login!
+	loginCmd, _ := mudio.NewCommandLogin([]string{})
+	serveConnection(tcpConnection, connection, session, loginCmd, logger, commandChannel, connectionsStopChannel, detach)
+}
+
+// Serves a browser session, which has completed the WebSocket handshake
+func handleWebSocketConnection(tcpConnection net.Conn, reader *bufio.Reader, logger logging.Logger, commandChannel chan<- *PlayerInput, connectionsStopChannel <-chan interface{}, detach *Detacher, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	session := newConnectionSession(logger, isSecure(tcpConnection))
+	session.websocket = true
+
+	// Browser terminals are known to render ANSI and UTF-8, and there is nothing to negotiate
+	session.observer.updateCapabilities(func(capabilities *mudio.ClientCapabilities) {
+		capabilities.ClientName = WEBSOCKET_CLIENT_NAME
+		capabilities.Ansi = true
+		capabilities.Colors256 = true
+		capabilities.Utf8 = true
+	})
+
+	connection := NewWebSocketConnection(tcpConnection, reader, session.observer, logger)
+
+	loginCmd, _ := mudio.NewCommandLogin([]string{})
+	serveConnection(tcpConnection, connection, session, loginCmd, logger, commandChannel, connectionsStopChannel, detach)
+}
+
+func newConnectionSession(logger logging.Logger, secure bool) *connectionSession {
+	player := absmachine.NewPlayer()
+	session := &connectionSession{
+		player:   player,
+		observer: newPlayerTelnetConnectionObserver(player, logger),
+		secure:   secure,
+	}
+
+	if secure {
+		session.observer.capabilities.Secure = true
+		signal(session.observer.capabilitiesChanged)
+	}
+
+	return session
+}
+
+// Takes over a connection that was detached before a copyover, and reattaches it to its player
+func HandleReattachedConnection(tcpConnection net.Conn, player *absmachine.Player, detached *DetachedSession, logger logging.Logger, commandChannel chan<- *PlayerInput, connectionsStopChannel <-chan interface{}, detach *Detacher, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	session := &connectionSession{
+		player:   player,
+		observer: newPlayerTelnetConnectionObserver(player, logger),
+		echoOff:  detached.EchoOff,
+	}
+	session.observer.capabilities = detached.Capabilities
+	signal(session.observer.capabilitiesChanged) // The game loop has not been told about the capabilities yet
+
+	connection := NewTelnetConnection(
+		tcpConnection,
+		session.observer,
+		logger,
+	)
+
+	if detached.EchoOff {
+		// The client was told we echo by the previous process, so this process must not ask it again
+		connection.(*implTelnetConnection).assumeLocalOptionEnabled(ECHO)
+	}
+
+	// The character set was agreed on with the previous process
+	connection.(*implTelnetConnection).charset = detached.Capabilities.Charset
+
+	if detached.Gmcp {
+		connection.(*implTelnetConnection).assumeLocalOptionEnabled(GMCP)
+	}
+
+	if detached.EndOfRecord {
+		connection.(*implTelnetConnection).assumeLocalOptionEnabled(END_OF_RECORD)
+	}
+
+	if detached.SuppressGoAhead {
+		connection.(*implTelnetConnection).assumeLocalOptionEnabled(SUPPRESS_GO_AHEAD)
+	}
+
+	if detached.Compressed {
+		// The previous process ended the compressed stream, but the client still has the option enabled
+		connection.(*implTelnetConnection).assumeLocalOptionEnabled(COMPRESS2)
+		connection.(*implTelnetConnection).startCompression()
+	}
+
+	serveConnection(tcpConnection, connection, session, mudio.NewCommandCopyoverRecovery(), logger, commandChannel, connectionsStopChannel, detach)
+}
+
+// The state of a connection, as seen by the goroutine serving it
+type connectionSession struct {
+	player    *absmachine.Player
+	observer  *playerTelnetConnectionObserver
+	echoOff   bool
+	secure    bool        // The connection is encrypted (TLS)
+	websocket bool        // The connection is a browser session
+	theme     ansi.Theme  // The player's colors of semantic markup
+	screen    splitScreen // The layout of the screen, if the player wants it split
+}
+
+func serveConnection(tcpConnection net.Conn, connection TelnetConnection, session *connectionSession, initialCommand mudio.Command, logger logging.Logger, commandChannel chan<- *PlayerInput, connectionsStopChannel <-chan interface{}, detach *Detacher) {
+	player := session.player
+	telnetConnectionObserver := session.observer
+	errorReturnChannel := make(chan error, 1)
+	lineInputChannel := make(chan LineInput, 1)
+	outputChannel := make(chan *PlayerOutput, 10)
+	jobDoneChannel := make(chan interface{}, 1) // Never closed, since a job may finish after the connection is gone
+
+	// Terminals keep a split screen after the connection is gone, unless they're told otherwise
+	restoreScreen := func() {
+		if restore := session.screen.restore(); restore != "" {
+			connection.WriteString(restore)
+		}
+	}
 
 	wgLineReader := sync.WaitGroup{}
 	defer func() {
+		restoreScreen()
 		connection.Close()
 		// Wait for line reader to exit. When we fall out of scope, the line input channel is closed, which
 		// may cause the line reader to panic!
-		wgLineReader.Wait()
+		stopLineReader(lineInputChannel, &wgLineReader)
 		close(errorReturnChannel)
 		close(outputChannel)
 		close(lineInputChannel)
 	}()
 
-	// The bootstrapping command: Login!
-	loginCmd, _ := mudio.NewCommandLogin([]string{})
 	commandChannel <- NewCommandPlayerInput(
-		loginCmd,
+		initialCommand,
 		player,
 		errorReturnChannel,
 		outputChannel,
 	)
 
 	// Kick off line reader
+	wgLineReader.Add(1)
 	go readLine(connection, lineInputChannel, &wgLineReader)
 
 	finished := false
@@ -77,7 +204,20 @@ func handleConnection(tcpConnection net.Conn, logger logging.Logger, commandChan
 	for !finished && !stopped {
 		select {
 		case lineInput := <-lineInputChannel:
-			if lineInput.err != nil {
+			if lineInput.err == ErrInterrupted || lineInput.err == ErrLineTooLong {
+				// The connection is fine, but the game loop must tell the player what became of the line
+				event := PE_Interrupted
+				if lineInput.err == ErrLineTooLong {
+					event = PE_LineTooLong
+				}
+
+				commandChannel <- NewEventPlayerInput(
+					event,
+					player,
+					errorReturnChannel,
+					outputChannel,
+				)
+			} else if lineInput.err != nil {
 				if errors.Is(lineInput.err, net.ErrClosed) {
 					logger.Println("Disconnecting client")
 				} else {
@@ -93,32 +233,105 @@ func handleConnection(tcpConnection net.Conn, logger logging.Logger, commandChan
 				)
 			}
 		case output := <-outputChannel:
+			if output.display != nil {
+				session.theme = output.display.theme
+				session.screen.wanted = output.display.splitScreen
+			}
+
+			// The screen is split (or made whole) as soon as the player wants it and the terminal can do it. Browsers
+			// are no terminals, and a screen reader would read the status bar over and over.
+			capabilities := telnetConnectionObserver.clientCapabilities()
+			width, height := telnetConnectionObserver.windowSize()
+			terminal := capabilities.Ansi && !capabilities.ScreenReader && !session.websocket
+			if layout := session.screen.layout(terminal, width, height); layout != "" {
+				connection.WriteString(layout)
+			}
+
+			if output.status != "" {
+				if status := session.screen.setStatus(output.status); status != "" {
+					connection.WriteString(status)
+				}
+			}
+
 			if output.text != "" {
 				outputString := output.text
 
 				if output.raw {
 					// Do nothing - outputString has the raw text!
-				} else if !telnetConnectionObserver.isAnsiCapable {
-					// No ANSI capabilities? Then strip away the ANSI markup
-					outputString = ansi.Strip(outputString)
 				} else {
-					// We're not outputing raw text, and the client terminal can do ANSI, so encode the ANSI escape codes!
-					outputString = ansi.Encode(outputString)
+					// Semantic markup is shown in the player's colors
+					outputString = session.theme.Apply(outputString)
+
+					// Wrap long lines at word boundaries, before the markup is turned into escape codes
+					outputString = ansi.Wrap(outputString, telnetConnectionObserver.windowWidth())
+
+					if !capabilities.Ansi {
+						// No ANSI capabilities? Then strip away the ANSI markup
+						outputString = ansi.Strip(outputString)
+					} else {
+						// The client terminal can do ANSI, so encode the ANSI escape codes, in colors it can show!
+						outputString = ansi.EncodeForDepth(outputString, colorDepth(capabilities))
+					}
 				}
-				connection.WriteString(outputString)
 
+				reset := ""
 				if !output.keepAnsiColorState {
-					// Reset color state unless explicitly stated not to!
-					connection.WriteString(ansi.Encode("$fg_white$$bg_black$"))
+					// Reset color state (and bold or underlined text) unless explicitly stated not to!
+					reset = ansi.Encode("$reset$$fg_white$$bg_black$")
+				}
+
+				switch {
+				case !session.screen.active():
+					if output.interruptsPrompt {
+						// Start on a new line, rather than after the prompt
+						outputString = "\n" + outputString
+					}
+					connection.WriteString(outputString + reset)
+				case output.prompt:
+					connection.WriteString(session.screen.drawPrompt(outputString + reset))
+				default:
+					// The colors of the prompt are restored along with the cursor, so there is nothing to reset
+					connection.WriteString(session.screen.scroll(outputString))
+				}
+			}
+
+			if output.prompt {
+				// Let the client know the prompt is complete, even though it doesn't end with a new line
+				connection.MarkPrompt()
+			}
+
+			if output.gmcp != nil && connection.IsLocalOptionEnabled(GMCP) {
+				payload, err := encodeGmcp(output.gmcp)
+				if err != nil {
+					logger.Printlnf("Failed to encode GMCP message %v: %v", output.gmcp.Package, err)
+				} else {
+					connection.WriteSubnegotiation(GMCP, payload)
 				}
 			}
 
+			if output.mssp != nil {
+				connection.WriteSubnegotiation(MSSP, encodeMssp(output.mssp))
+			}
+
 			switch output.echoState {
 			case ES_On:
 				connection.EchoOn()
+				session.echoOff = false
 			case ES_Off:
 				connection.EchoOff()
+				session.echoOff = true
+			}
+
+			if output.job != nil {
+				// Too slow for the game loop, and too slow to hold up a shutdown or a reboot, so it gets a goroutine
+				// of its own. A command has one job at a time, so the result always fits in the channel.
+				job := output.job
+				go func() {
+					jobDoneChannel <- job()
+				}()
 			}
+		case jobResult := <-jobDoneChannel:
+			commandChannel <- NewJobDonePlayerInput(jobResult, player, errorReturnChannel, outputChannel)
 		case err := <-errorReturnChannel:
 			switch err {
 			case ErrPlayerQuit:
@@ -133,10 +346,40 @@ func handleConnection(tcpConnection net.Conn, logger logging.Logger, commandChan
 				logger.Printlnf("Aborting player connection for %v due to error: %v", player.Name, err.Error())
 				finished = true
 			}
+		case <-telnetConnectionObserver.capabilitiesChanged:
+			commandChannel <- NewCapabilitiesPlayerInput(
+				telnetConnectionObserver.clientCapabilities(),
+				player,
+				errorReturnChannel,
+				outputChannel,
+			)
+		case <-telnetConnectionObserver.msspRequested:
+			// The status of the server is known by the game loop
+			commandChannel <- NewEventPlayerInput(
+				PE_MsspRequested,
+				player,
+				errorReturnChannel,
+				outputChannel,
+			)
 		case _, isOpen := <-connectionsStopChannel:
 			// We've been stopped!
+			restoreScreen()
 			connection.WriteLine("Shutting down server...")
 			stopped = !isOpen
+		case <-detach.detachChannel:
+			if !player.State.HasFlag(absmachine.PS_LOGGED_IN) {
+				// Only players in the game survive a copyover
+				restoreScreen()
+				connection.WriteLine("Rebooting, please reconnect in a moment.")
+				stopped = true
+			} else if detach.detachConnection(tcpConnection, connection, session, lineInputChannel, &wgLineReader, logger) {
+				// The connection lives on in the next process, so the player has not exited
+				return
+			} else {
+				restoreScreen()
+				connection.WriteLine("Rebooting failed to keep your connection, please reconnect in a moment.")
+				stopped = true
+			}
 		}
 	}
 
@@ -148,13 +391,22 @@ func handleConnection(tcpConnection net.Conn, logger logging.Logger, commandChan
 	)
 }
 
+// Encodes a GMCP message as "<package> <JSON data>"
+func encodeGmcp(message *mudio.GmcpMessage) ([]byte, error) {
+	data, err := json.Marshal(message.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(message.Package+" "), data...), nil
+}
+
 type LineInput struct {
 	line string
 	err  error
 }
 
 func readLine(connection TelnetConnection, lineInputChannel chan<- LineInput, wg *sync.WaitGroup) {
-	wg.Add(1)
 	defer wg.Done()
 
 	for {
@@ -167,30 +419,150 @@ func readLine(connection TelnetConnection, lineInputChannel chan<- LineInput, wg
 			}
 		}
 
-		if err != nil {
+		if err != nil && err != ErrInterrupted && err != ErrLineTooLong {
 			return
 		}
 	}
 }
 
+// Waits for the line reader to exit, throwing away anything it reads in the meantime
+func stopLineReader(lineInputChannel <-chan LineInput, wg *sync.WaitGroup) {
+	done := make(chan interface{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for {
+		select {
+		case <-lineInputChannel:
+		case <-done:
+			return
+		}
+	}
+}
+
+// Output is wrapped to this width, when the client doesn't tell us the size of its window
+const DEFAULT_WINDOW_WIDTH = 80
+
+// The width to wrap output to
+func windowWidth(capabilities mudio.ClientCapabilities) int {
+	if capabilities.Width == 0 {
+		return DEFAULT_WINDOW_WIDTH
+	}
+	return capabilities.Width
+}
+
 type playerTelnetConnectionObserver struct {
-	player        *absmachine.Player
-	logger        logging.Logger
-	isAnsiCapable bool
+	player              *absmachine.Player
+	logger              logging.Logger
+	lock                sync.Mutex // Protects the capabilities, which change on the line reader's goroutine
+	capabilities        mudio.ClientCapabilities
+	terminalTypes       int // Number of terminal type answers so far
+	msspRequested       chan interface{}
+	capabilitiesChanged chan interface{}
+}
+
+func newPlayerTelnetConnectionObserver(player *absmachine.Player, logger logging.Logger) *playerTelnetConnectionObserver {
+	return &playerTelnetConnectionObserver{
+		player:              player,
+		logger:              logger,
+		msspRequested:       make(chan interface{}, 1),
+		capabilitiesChanged: make(chan interface{}, 1),
+	}
+}
+
+// The game loop is told about the size of the window, like about the capabilities, since it pages long output
+func (observer *playerTelnetConnectionObserver) setWindowSize(width int, height int) {
+	observer.updateCapabilities(func(capabilities *mudio.ClientCapabilities) {
+		capabilities.Width = width
+		capabilities.Height = height
+	})
+}
+
+func (observer *playerTelnetConnectionObserver) windowSize() (width int, height int) {
+	capabilities := observer.clientCapabilities()
+	return capabilities.Width, capabilities.Height
+}
+
+// The width to wrap output to
+func (observer *playerTelnetConnectionObserver) windowWidth() int {
+	return windowWidth(observer.clientCapabilities())
+}
+
+func (observer *playerTelnetConnectionObserver) clientCapabilities() mudio.ClientCapabilities {
+	observer.lock.Lock()
+	defer observer.lock.Unlock()
+
+	return observer.capabilities
+}
+
+// Changes the capabilities, and lets the goroutine serving the connection know, so that it can tell the game loop
+func (observer *playerTelnetConnectionObserver) updateCapabilities(update func(capabilities *mudio.ClientCapabilities)) {
+	observer.lock.Lock()
+	before := observer.capabilities
+	update(&observer.capabilities)
+	changed := observer.capabilities != before
+	observer.lock.Unlock()
+
+	if changed {
+		signal(observer.capabilitiesChanged)
+	}
+}
+
+// Signals on a channel with room for one signal, unless there's already a signal waiting
+func signal(channel chan<- interface{}) {
+	select {
+	case channel <- nil:
+	default:
+	}
 }
 
 func (observer *playerTelnetConnectionObserver) CommandReceived(command []byte) {
-	if len(command) > 4 && command[0] == IAC && command[1] == SB && command[2] == TERMINAL_TYPE && command[3] == TRANSMIT_BINARY {
-		// We got a terminal type! Let's figure out what it is!
-		// Grab string from position 4 (after IAC SB TERMINAL-TYPE BINARY) but before IAC SE
-		tt := strings.ToLower(string(command[4 : len(command)-2]))
+}
+
+func (observer *playerTelnetConnectionObserver) SubnegotiationReceived(subnegotiation Subnegotiation) {
+	if subnegotiation.Option == TERMINAL_TYPE && len(subnegotiation.Payload) > 1 && subnegotiation.Payload[0] == TTYPE_IS {
+		// We got a terminal type (or the next one, see terminal.go)! Let's figure out what it tells us!
+		observer.updateCapabilities(func(capabilities *mudio.ClientCapabilities) {
+			applyTerminalType(capabilities, string(subnegotiation.Payload[1:]), observer.terminalTypes)
+		})
+		observer.terminalTypes++
+	}
 
-		if strings.Contains(tt, "xterm") || strings.Contains(tt, "ansi") {
-			observer.isAnsiCapable = true
+	if subnegotiation.Option == NAWS {
+		// Sent when NAWS is enabled, and again whenever the window is resized
+		width, height, ok := parseWindowSize(subnegotiation.Payload)
+		if !ok {
+			observer.logger.Printlnf("Invalid window size received: %v", subnegotiation.Payload)
+			return
 		}
+		observer.setWindowSize(width, height)
 	}
 }
 
+func (observer *playerTelnetConnectionObserver) CharsetChanged(newCharset charset.Charset) {
+	observer.updateCapabilities(func(capabilities *mudio.ClientCapabilities) {
+		capabilities.Charset = newCharset
+		capabilities.Utf8 = newCharset == charset.UTF8
+	})
+}
+
 func (observer *playerTelnetConnectionObserver) InvalidCommand(data []byte) {
 	observer.logger.Printlnf("Invalid TELNET command received: %v", data)
 }
+
+func (observer *playerTelnetConnectionObserver) OptionChanged(option byte, local bool, enabled bool) {
+	if !local {
+		return
+	}
+
+	switch option {
+	case MSSP:
+		if enabled {
+			signal(observer.msspRequested)
+		}
+	case COMPRESS2:
+		observer.updateCapabilities(func(capabilities *mudio.ClientCapabilities) { capabilities.Mccp = enabled })
+	}
+}
@@ -0,0 +1,55 @@
+package io
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jorgensigvardsson/gomud/logging"
+	"github.com/jorgensigvardsson/gomud/mudio"
+)
+
+func Test_serveConnection_JobRunning_ReturnsWhenStopped(t *testing.T) {
+	// Arrange
+	clientSide, serverSide := net.Pipe()
+	defer clientSide.Close()
+	go io.Copy(io.Discard, clientSide)
+
+	// The game loop hands the first command a job that doesn't finish until the test is over
+	jobRelease := make(chan interface{})
+	defer close(jobRelease)
+	commandChannel := make(chan *PlayerInput)
+	go func() {
+		for input := range commandChannel {
+			if input.command != nil {
+				input.outputChannel <- JobOutput(func() interface{} {
+					<-jobRelease
+					return nil
+				})
+			}
+		}
+	}()
+
+	stopChannel := make(chan interface{})
+	session := newConnectionSession(logging.NewNullLogger(), false)
+	connection := NewTelnetConnection(serverSide, session.observer, logging.NewNullLogger())
+	loginCmd, _ := mudio.NewCommandLogin([]string{})
+
+	done := make(chan interface{})
+	go func() {
+		serveConnection(serverSide, connection, session, loginCmd, logging.NewNullLogger(), commandChannel, stopChannel, NewDetacher(1))
+		close(done)
+	}()
+
+	// Act
+	time.Sleep(50 * time.Millisecond) // Let the job start
+	close(stopChannel)
+
+	// Assert
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("The connection was still waiting for the job after the server stopped")
+	}
+}
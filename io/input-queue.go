@@ -5,17 +5,41 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"time"
 
 	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/ansi"
+	"github.com/jorgensigvardsson/gomud/config"
+	"github.com/jorgensigvardsson/gomud/lang"
 	"github.com/jorgensigvardsson/gomud/logging"
 	"github.com/jorgensigvardsson/gomud/mudio"
+	"github.com/jorgensigvardsson/gomud/persistence"
 )
 
 type PlayerQueue struct {
 	inputs             *list.List
 	currentCommand     mudio.Command
+	prompt             string // The prompt of the current command
 	errorReturnChannel chan<- error
 	outputChannel      chan<- *PlayerOutput
+	gmcp               gmcpState
+	screen             screenState
+	capabilities       mudio.ClientCapabilities
+	heldOutput         []string // Output for the player, held back while the player reads pages
+	jobPending         bool     // The current command waits for its job, and gets no input until it's done
+}
+
+// What a player's client was last told over GMCP, so that packages are only sent again when they change
+type gmcpState struct {
+	vitals interface{} // The data of the last Char.Vitals
+	status interface{} // The data of the last Char.Status
+	room   *absmachine.Room
+}
+
+// What a player's split screen was last told, so that the status bar and prompt are only drawn again when they change
+type screenState struct {
+	status string
+	prompt string
 }
 
 func newPlayerQueue() *PlayerQueue {
@@ -29,38 +53,53 @@ type InputQueue struct {
 	playerQueues             map[*absmachine.Player]*PlayerQueue
 	maxPlayerLimit           int
 	maxPlayerInputQueueLimit int
+	accounts                 persistence.AccountStore
+	config                   *config.Config
 	logger                   logging.Logger
+	copyoverRequested        bool
+	startTime                time.Time
+	tick                     int // The tick of the game loop being run, which prompts may show
 }
 
-func NewInputQueue(maxPlayerLimit int, maxPlayerInputQueueLimit int, logger logging.Logger) *InputQueue {
+func NewInputQueue(maxPlayerLimit int, maxPlayerInputQueueLimit int, accounts persistence.AccountStore, config *config.Config, logger logging.Logger) *InputQueue {
 	return &InputQueue{
 		commandParser:            mudio.ParseCommand,
 		playerQueues:             make(map[*absmachine.Player]*PlayerQueue),
 		maxPlayerLimit:           maxPlayerLimit,
 		maxPlayerInputQueueLimit: maxPlayerInputQueueLimit,
+		accounts:                 accounts,
+		config:                   config,
 		logger:                   logger,
+		startTime:                time.Now(),
 	}
 }
 
 func (q *InputQueue) Execute(world *absmachine.World, tick int) {
+	q.tick = tick
 	runPlayerQueues(q, world)
 	runMobActions(q, world, tick)
 	// TODO: Run player actions (fighting actions, etc)
+	sendGmcpUpdates(q)
+	sendScreenUpdates(q)
 }
 
 func runPlayerQueues(q *InputQueue, world *absmachine.World) {
 	for player, pq := range q.playerQueues {
-		if pq.inputs.Len() == 0 {
+		input := nextInput(pq)
+		if input == nil {
 			continue
 		}
 
-		input := pq.inputs.Front().Value.(*PlayerInput)
-		pq.inputs.Remove(pq.inputs.Front())
-
-		if input.event != PE_Nothing {
+		if input.event == PE_JobDone {
+			if !pq.jobPending {
+				// The command was aborted while the job was done
+				continue
+			}
+			pq.jobPending = false
+		} else if input.event != PE_Nothing {
 			// If it's an event (rather than input/command),
 			// then handle it and go on with the next player queue
-			q.handleEvent(input)
+			q.handleEvent(world, input)
 			continue
 		}
 
@@ -75,29 +114,46 @@ func runPlayerQueues(q *InputQueue, world *absmachine.World) {
 			command, err = q.commandParser(input.text, player)
 
 			if err != nil {
-				pq.outputChannel <- PrintlnfOutput("$fg_bred$%v", err.Error())
+				pq.outputChannel <- PrintlnfOutput("$error$%v", err.Error())
 				// Player typed in something that was not recognized as a command, so just show a prompt and continue
-				pq.outputChannel <- PrintOutput(normalPrompt(player))
+				pq.outputChannel <- PromptOutput(normalPrompt(q, player))
 				continue
 			}
 		} else {
 			// Show the prompt and continue
-			pq.outputChannel <- PrintOutput(normalPrompt(player))
+			pq.outputChannel <- PromptOutput(normalPrompt(q, player))
 			continue
 		}
 
 		commandContext := mudio.CommandContext{
-			World:  world,
-			Player: player,
-			Input:  input.text,
-			Logger: q.logger,
+			World:     world,
+			Player:    player,
+			Input:     input.text,
+			Logger:    q.logger,
+			Accounts:  q.accounts,
+			Config:    q.config,
+			Client:    pq.capabilities,
+			JobResult: input.jobResult,
 		}
 
 		result, err := command.Execute(&commandContext)
 
+		if _, paging := command.(*pager); !paging && result.Prompt == "" && result.Job == nil && !result.TerminatationRequested {
+			// The command is done, but its output may not fit in the player's window
+			if outputPager := newPager(result.Output, player, pq.capabilities); outputPager != nil {
+				command = outputPager
+				result.Output, result.Prompt = outputPager.pages[0], PAGER_PROMPT
+			}
+		}
+
+		if result.DisplayChanged {
+			// Before the output, which may already be shown the new way
+			pq.outputChannel <- DisplayOutput(player)
+		}
+
 		if err != nil {
 			// We had an error, so let's show that to the user!
-			pq.outputChannel <- PrintlnfOutput("$fg_bred$%v", err.Error())
+			pq.outputChannel <- PrintlnfOutput("$error$%v", err.Error())
 		}
 
 		if result.Output != "" {
@@ -109,23 +165,43 @@ func runPlayerQueues(q *InputQueue, world *absmachine.World) {
 			}
 		}
 
+		for _, message := range result.GmcpMessages {
+			pq.outputChannel <- GmcpOutput(message)
+		}
+
+		if result.CopyoverRequested {
+			q.copyoverRequested = true
+		}
+
 		if result.TerminatationRequested {
 			// Termination requested! Let's pass it off to the input handling routine
 			pq.errorReturnChannel <- ErrPlayerQuit
 			// We're done here, so let's make sure the current command is done
 			pq.currentCommand = nil
 		} else {
-			// Command wants to show a prompt? Then do it
-			if result.Prompt != "" {
-				pq.outputChannel <- PrintOutput(result.Prompt)
+			if result.Job != nil {
+				// The command goes on when its job is done, and what the player types meanwhile waits for it
+				pq.currentCommand = command
+				pq.jobPending = true
+				pq.outputChannel <- JobOutput(result.Job)
+			} else if result.Prompt != "" {
+				// Command wants to show a prompt? Then do it
+				pq.outputChannel <- PromptOutput(result.Prompt)
 				// Command wants to continue execution (it is showing a prompt!), so let's save it for the next inputs
 				pq.currentCommand = command
-				player.State.SetFlag(absmachine.PS_BUSY) // If a command wants to continue executing, then the player is busy
+				pq.prompt = result.Prompt
+				if isPaging(pq) {
+					// Reading pages is no reason not to be told things, which are held back until the player is done
+					player.State.ClearFlag(absmachine.PS_BUSY)
+				} else {
+					player.State.SetFlag(absmachine.PS_BUSY) // If a command wants to continue executing, then the player is busy
+				}
 			} else {
 				// We're done here, so let's make sure the current command is done
 				pq.currentCommand = nil
-				pq.outputChannel <- PrintOutput(normalPrompt(player))
 				player.State.ClearFlag(absmachine.PS_BUSY) // If the command is complete, then the player is no longer busy
+				sendHeldOutput(pq)
+				pq.outputChannel <- PromptOutput(normalPrompt(q, player))
 			}
 
 			for _, response := range result.TextMessages {
@@ -134,9 +210,7 @@ func runPlayerQueues(q *InputQueue, world *absmachine.World) {
 				if !found {
 					q.logger.Printlnf("Tried to send text message to player %v from player %v, but receiving player does not have a queue!", response.RecipientPlayer.Name, player.Name)
 				} else {
-					pq.outputChannel <- PrintlnOutput("")                                   // Emit a new line in order to clear the prompt on screen
-					pq.outputChannel <- PrintlnOutput(response.Text)                        // Then the response text
-					pq.outputChannel <- PrintOutput(normalPrompt(response.RecipientPlayer)) // And finally show the prompt again
+					sendInterruptingOutput(pq, response.Text, normalPrompt(q, response.RecipientPlayer))
 				}
 			}
 
@@ -150,15 +224,77 @@ func runPlayerQueues(q *InputQueue, world *absmachine.World) {
 	}
 }
 
-func (q *InputQueue) handleEvent(input *PlayerInput) {
+func (q *InputQueue) handleEvent(world *absmachine.World, input *PlayerInput) {
 	switch input.event {
 	case PE_Exited:
-		// Player exited, so remove it from the world
+		// Player exited, so save it and remove it from the world
+		q.savePlayer(input.player)
 		absmachine.DestroyPlayer(input.player)
 		delete(q.playerQueues, input.player)
+	case PE_MsspRequested:
+		input.outputChannel <- MsspOutput(msspVariables(world, q.config, q.startTime))
+	case PE_Interrupted:
+		if pq, found := q.playerQueues[input.player]; found {
+			q.interruptCommand(input.player, pq)
+		}
+	case PE_LineTooLong:
+		if pq, found := q.playerQueues[input.player]; found {
+			pq.outputChannel <- PrintlnfOutput("$error$Your line was too long (more than %v characters), and was thrown away.", MAX_LINE_LENGTH)
+			pq.outputChannel <- PromptOutput(currentPrompt(q, input.player, pq))
+		}
 	}
 }
 
+// Aborts the command that is showing a prompt. Commands can't be aborted before the player has logged in, since
+// the login has to be completed.
+func (q *InputQueue) interruptCommand(player *absmachine.Player, pq *PlayerQueue) {
+	if pq.currentCommand != nil && !pq.jobPending && player.State.HasFlag(absmachine.PS_LOGGED_IN) {
+		pq.currentCommand = nil
+		pq.prompt = ""
+		player.State.ClearFlag(absmachine.PS_BUSY)
+		pq.outputChannel <- PrintlnOutput("\nAborted.")
+		sendHeldOutput(pq)
+	} else {
+		pq.outputChannel <- PrintlnOutput("")
+	}
+
+	pq.outputChannel <- PromptOutput(currentPrompt(q, player, pq))
+}
+
+func (q *InputQueue) savePlayer(player *absmachine.Player) {
+	if !player.State.HasFlag(absmachine.PS_LOGGED_IN) {
+		// Nothing to save if the player never got past the login
+		return
+	}
+
+	err := persistence.SavePlayer(q.accounts, player)
+	if err != nil {
+		q.logger.Printlnf("Failed to save player %v: %v", player.Name, err)
+	}
+}
+
+// Saves all players that are logged in (used when shutting down)
+func (q *InputQueue) SaveAllPlayers(world *absmachine.World) {
+	for _, player := range world.Players {
+		q.savePlayer(player)
+	}
+}
+
+// When the server was started, which is reported as its uptime
+func (q *InputQueue) StartTime() time.Time {
+	return q.startTime
+}
+
+// Overrides when the server was started, because it was started by an earlier process (before a copyover)
+func (q *InputQueue) SetStartTime(startTime time.Time) {
+	q.startTime = startTime
+}
+
+// Tells if a command has requested a copyover (a reboot that keeps connections alive)
+func (q *InputQueue) CopyoverRequested() bool {
+	return q.copyoverRequested
+}
+
 var ErrPlayerQuit = errors.New("player quit")
 var ErrTooManyPlayers = errors.New("too many players connected")
 var ErrTooMuchInput = errors.New("too many players connected")
@@ -180,19 +316,50 @@ func (q *InputQueue) Append(inputOrCommand *PlayerInput) {
 		q.playerQueues[inputOrCommand.player] = pq
 	}
 
+	// Make sure we remember the communication channels!
+	pq.errorReturnChannel = inputOrCommand.errorReturnChannel
+	pq.outputChannel = inputOrCommand.outputChannel
+
+	if inputOrCommand.event == PE_CapabilitiesChanged {
+		// Nothing the player does, so it takes effect at once, rather than waiting its turn (and taking up room in the
+		// queue, since a window being resized tells us about every size along the way)
+		pq.capabilities = inputOrCommand.capabilities
+		return
+	}
+
 	if pq.inputs.Len()+1 > q.maxPlayerInputQueueLimit { // Would adding one more input go above the limit?
 		inputOrCommand.errorReturnChannel <- ErrTooMuchInput
 		return
 	}
 
-	// Make sure we remember the communication channels!
-	pq.errorReturnChannel = inputOrCommand.errorReturnChannel
-	pq.outputChannel = inputOrCommand.outputChannel
 	pq.inputs.PushBack(inputOrCommand)
 }
 
-func normalPrompt(player *absmachine.Player) string {
-	return fmt.Sprintf("$fg_bcyan$[H:%v] [M:%v] > ", player.Health, player.Mana)
+// Takes the next input off a player's queue, or returns nil if there is none to handle yet. While the current command
+// waits for its job, only events are handled, and what the player types waits too.
+func nextInput(pq *PlayerQueue) *PlayerInput {
+	for element := pq.inputs.Front(); element != nil; element = element.Next() {
+		input := element.Value.(*PlayerInput)
+		if !pq.jobPending || input.event != PE_Nothing {
+			pq.inputs.Remove(element)
+			return input
+		}
+	}
+
+	return nil
+}
+
+// The prompt of the command that is waiting for input, or the normal prompt if there is none
+func currentPrompt(q *InputQueue, player *absmachine.Player, pq *PlayerQueue) string {
+	if pq.currentCommand != nil {
+		return pq.prompt
+	}
+
+	return normalPrompt(q, player)
+}
+
+func normalPrompt(q *InputQueue, player *absmachine.Player) string {
+	return mudio.RenderPrompt(player, q.tick)
 }
 
 func runMobActions(q *InputQueue, world *absmachine.World, tick int) {
@@ -219,9 +386,75 @@ func shouldDoAction(probability float32) bool {
 func sendOutputToPlayersInRoom(q *InputQueue, room *absmachine.Room, output string) {
 	for _, player := range room.Players {
 		if pq, ok := q.playerQueues[player]; ok {
-			pq.outputChannel <- PrintlnOutput("")                     // Emit a new line in order to clear the prompt on screen
-			pq.outputChannel <- PrintlnfOutput("$fg_cyan$%v", output) // Then the response text
-			pq.outputChannel <- PrintOutput(normalPrompt(player))     // And finally show the prompt again
+			sendInterruptingOutput(pq, "$mobaction$"+output, normalPrompt(q, player))
 		}
 	}
 }
+
+// Sends text to a player who is looking at a prompt, and then shows the prompt again, below the text. Text for a
+// player who is reading pages waits until the player is done.
+func sendInterruptingOutput(pq *PlayerQueue, text string, prompt string) {
+	if isPaging(pq) {
+		holdOutput(pq, text)
+		return
+	}
+
+	pq.outputChannel <- InterruptingOutput(text)
+	pq.outputChannel <- PromptOutput(prompt)
+}
+
+// Sends the built-in GMCP packages that have changed since they were last sent (on login, after moving, when the
+// vitals change, etc). Clients that don't support GMCP never see them.
+func sendGmcpUpdates(q *InputQueue) {
+	for player, pq := range q.playerQueues {
+		if !player.State.HasFlag(absmachine.PS_LOGGED_IN) {
+			continue
+		}
+
+		if vitals := mudio.NewGmcpCharVitals(player); vitals.Data != pq.gmcp.vitals {
+			pq.gmcp.vitals = vitals.Data
+			pq.outputChannel <- GmcpOutput(vitals)
+		}
+
+		if status := mudio.NewGmcpCharStatus(player); status.Data != pq.gmcp.status {
+			pq.gmcp.status = status.Data
+			pq.outputChannel <- GmcpOutput(status)
+		}
+
+		if player.Room != nil && player.Room != pq.gmcp.room {
+			pq.gmcp.room = player.Room
+			pq.outputChannel <- GmcpOutput(mudio.NewGmcpRoomInfo(player.Room))
+		}
+	}
+}
+
+// Draws the status bar and the prompt of players with a split screen again, when what they show has changed. The
+// prompt is left alone while a command shows its own.
+func sendScreenUpdates(q *InputQueue) {
+	for player, pq := range q.playerQueues {
+		if !player.State.HasFlag(absmachine.PS_LOGGED_IN) || !player.SplitScreen {
+			continue
+		}
+
+		if status := statusBar(player); status != pq.screen.status {
+			pq.screen.status = status
+			pq.outputChannel <- StatusOutput(status)
+		}
+
+		// The prompt shows the vitals, and whatever else the player wants
+		if prompt := normalPrompt(q, player); prompt != pq.screen.prompt {
+			pq.screen.prompt = prompt
+			if pq.currentCommand == nil {
+				pq.outputChannel <- PromptOutput(prompt)
+			}
+		}
+	}
+}
+
+func statusBar(player *absmachine.Player) string {
+	status := fmt.Sprintf(" %v, level %v %v", player.Name, player.Level, lang.ClassName(player.Class))
+	if player.Room != nil {
+		status += " | " + ansi.Strip(player.Room.Title) // The status bar is drawn as it is, in reverse video
+	}
+	return status
+}
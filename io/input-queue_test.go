@@ -1,11 +1,13 @@
 package io
 
 import (
+	"container/list"
 	"errors"
 	"fmt"
 	"testing"
 
 	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/config"
 	"github.com/jorgensigvardsson/gomud/logging"
 	"github.com/jorgensigvardsson/gomud/mudio"
 )
@@ -16,16 +18,16 @@ func Test_showNormalPrompt(t *testing.T) {
 		Mana:   43,
 	}
 
-	promptText := normalPrompt(&player)
+	promptText := normalPrompt(NewInputQueue(1, 1, nil, config.Default(), logging.NewNullLogger()), &player)
 
-	if promptText != "$fg_bcyan$[H:103] [M:43] > " {
+	if promptText != "$prompt$[H:103] [M:43] > " {
 		t.Errorf("Unexpected prompt: %v", promptText)
 	}
 }
 
 func Test_Append_PanicsIfNoOutputChannel(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(1, 1, logging.NewNullLogger())
+	q := NewInputQueue(1, 1, nil, config.Default(), logging.NewNullLogger())
 	p := absmachine.NewPlayer()
 
 	errorChannel := make(chan error)
@@ -48,7 +50,7 @@ func Test_Append_PanicsIfNoOutputChannel(t *testing.T) {
 
 func Test_Append_PanicsIfNoErrorReturnChannel(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(1, 1, logging.NewNullLogger())
+	q := NewInputQueue(1, 1, nil, config.Default(), logging.NewNullLogger())
 	p := absmachine.NewPlayer()
 
 	outputChannel := make(chan *PlayerOutput)
@@ -70,7 +72,7 @@ func Test_Append_PanicsIfNoErrorReturnChannel(t *testing.T) {
 }
 
 func Test_Append_PlayerLimitIsRespected(t *testing.T) {
-	q := NewInputQueue(1, 1, logging.NewNullLogger())
+	q := NewInputQueue(1, 1, nil, config.Default(), logging.NewNullLogger())
 	p1 := absmachine.NewPlayer()
 	p2 := absmachine.NewPlayer()
 	outputChannel1 := make(chan *PlayerOutput, 10)
@@ -104,7 +106,7 @@ func Test_Append_PlayerLimitIsRespected(t *testing.T) {
 }
 
 func Test_Append_PlayerInputLimitIsRespected(t *testing.T) {
-	q := NewInputQueue(1, 1, logging.NewNullLogger())
+	q := NewInputQueue(1, 1, nil, config.Default(), logging.NewNullLogger())
 	p := absmachine.NewPlayer()
 	outputChannel := make(chan *PlayerOutput, 10)
 	errorChannel := make(chan error, 10)
@@ -134,7 +136,7 @@ func Test_Append_PlayerInputLimitIsRespected(t *testing.T) {
 
 func Test_Execute_NoInput_NoEffect(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 
@@ -155,7 +157,7 @@ func Test_Execute_NoInput_NoEffect(t *testing.T) {
 
 func Test_Execute_PlayersHaveBeenAdded_ButHasNoInput_NoEffect(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 
@@ -177,7 +179,7 @@ func Test_Execute_PlayersHaveBeenAdded_ButHasNoInput_NoEffect(t *testing.T) {
 
 func Test_Execute_PlayerHasEvent_PE_Exited_PlayerIsRemovedFromWorld(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 
@@ -200,7 +202,7 @@ func Test_Execute_PlayerHasEvent_PE_Exited_PlayerIsRemovedFromWorld(t *testing.T
 
 func Test_Execute_PlayerHasEvent_UnknownEvent_NoEffect(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 
@@ -238,7 +240,7 @@ func (cmd *FakeCommand) Execute(context *mudio.CommandContext) (result mudio.Com
 
 func Test_Execute_NoInput_StandardPromptWrittenToConnection(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 	outputChannel := make(chan *PlayerOutput, 10)
@@ -255,12 +257,12 @@ func Test_Execute_NoInput_StandardPromptWrittenToConnection(t *testing.T) {
 	q.Execute(world, 0)
 
 	// Assert
-	testOutput(t, outputChannel, "$fg_bcyan$[H:0] [M:0] > ")
+	testOutput(t, outputChannel, "$prompt$[H:0] [M:0] > ")
 }
 
 func Test_Execute_PlayerHasCurrentCommand_InputIsSentToCurrentCommand_CommandFinished(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 	outputChannel := make(chan *PlayerOutput, 10)
@@ -295,7 +297,7 @@ func Test_Execute_PlayerHasCurrentCommand_InputIsSentToCurrentCommand_CommandFin
 
 func Test_Execute_PlayerHasCurrentCommand_InputIsSentToCurrentCommand_CommandErrorsAreWrittenToConnection(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 	outputChannel := make(chan *PlayerOutput, 10)
@@ -327,12 +329,12 @@ func Test_Execute_PlayerHasCurrentCommand_InputIsSentToCurrentCommand_CommandErr
 		t.Error("Expected current command for player to be cleared!")
 	}
 
-	testOutput(t, outputChannel, fmt.Sprintln("$fg_bred$foo"), "$fg_bcyan$[H:0] [M:0] > ")
+	testOutput(t, outputChannel, fmt.Sprintln("$error$foo"), "$prompt$[H:0] [M:0] > ")
 }
 
 func Test_Execute_PlayerHasCurrentCommand_InputIsSentToCurrentCommand_CommandWantsToContinue(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 	outputChannel := make(chan *PlayerOutput, 10)
@@ -369,7 +371,7 @@ func Test_Execute_PlayerHasCurrentCommand_InputIsSentToCurrentCommand_CommandWan
 
 func Test_Execute_PlayerHasCurrentCommand_InputIsSentToCurrentCommand_CommandWantsToTerminate(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 	outputChannel := make(chan *PlayerOutput, 10)
@@ -409,7 +411,7 @@ func Test_Execute_PlayerHasCurrentCommand_InputIsSentToCurrentCommand_CommandWan
 
 func Test_Execute_PlayerHasNoCurrentCommand_InvalidInput_ErrorAndStandardPromptWrittenToConnection(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 	outputChannel := make(chan *PlayerOutput, 10)
@@ -431,12 +433,12 @@ func Test_Execute_PlayerHasNoCurrentCommand_InvalidInput_ErrorAndStandardPromptW
 	q.Execute(world, 0)
 
 	// Assert
-	testOutput(t, outputChannel, fmt.Sprintln("$fg_bred$foo"), "$fg_bcyan$[H:0] [M:0] > ")
+	testOutput(t, outputChannel, fmt.Sprintln("$error$foo"), "$prompt$[H:0] [M:0] > ")
 }
 
 func Test_Execute_PlayerHasNoCurrentCommand_InputIsSentToParsedCommand_CommandFinished(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 	outputChannel := make(chan *PlayerOutput, 10)
@@ -470,12 +472,12 @@ func Test_Execute_PlayerHasNoCurrentCommand_InputIsSentToParsedCommand_CommandFi
 		t.Error("Expected current command for player to be cleared!")
 	}
 
-	testOutput(t, outputChannel, "$fg_bcyan$[H:0] [M:0] > ")
+	testOutput(t, outputChannel, "$prompt$[H:0] [M:0] > ")
 }
 
 func Test_Execute_PlayerHasNoCurrentCommand_InputIsSentToParsedCommand_CommandErrorsAreWrittenToConnection(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 	outputChannel := make(chan *PlayerOutput, 10)
@@ -509,12 +511,12 @@ func Test_Execute_PlayerHasNoCurrentCommand_InputIsSentToParsedCommand_CommandEr
 		t.Error("Expected current command for player to be cleared!")
 	}
 
-	testOutput(t, outputChannel, fmt.Sprintln("$fg_bred$foo"), "$fg_bcyan$[H:0] [M:0] > ")
+	testOutput(t, outputChannel, fmt.Sprintln("$error$foo"), "$prompt$[H:0] [M:0] > ")
 }
 
 func Test_Execute_PlayerHasNoCurrentCommand_InputIsSentToParsedCommand_CommandWantsToContinue(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 	outputChannel := make(chan *PlayerOutput, 10)
@@ -553,7 +555,7 @@ func Test_Execute_PlayerHasNoCurrentCommand_InputIsSentToParsedCommand_CommandWa
 
 func Test_Execute_PlayerHasNoCurrentCommand_InputIsSentToParsedCommand_CommandWantsToTerminate(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 	outputChannel := make(chan *PlayerOutput, 10)
@@ -595,7 +597,7 @@ func Test_Execute_PlayerHasNoCurrentCommand_InputIsSentToParsedCommand_CommandWa
 
 func Test_Execute_PlayerHasNoCurrentCommand_InputIsCommand_CommandFinished(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 	outputChannel := make(chan *PlayerOutput, 10)
@@ -625,12 +627,12 @@ func Test_Execute_PlayerHasNoCurrentCommand_InputIsCommand_CommandFinished(t *te
 		t.Error("Expected current command for player to be cleared!")
 	}
 
-	testOutput(t, outputChannel, "$fg_bcyan$[H:0] [M:0] > ")
+	testOutput(t, outputChannel, "$prompt$[H:0] [M:0] > ")
 }
 
 func Test_Execute_PlayerHasNoCurrentCommand_InputIsCommand_CommandErrorsAreWrittenToConnection(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 	outputChannel := make(chan *PlayerOutput, 10)
@@ -660,12 +662,12 @@ func Test_Execute_PlayerHasNoCurrentCommand_InputIsCommand_CommandErrorsAreWritt
 		t.Error("Expected current command for player to be cleared!")
 	}
 
-	testOutput(t, outputChannel, fmt.Sprintln("$fg_bred$foo"), "$fg_bcyan$[H:0] [M:0] > ")
+	testOutput(t, outputChannel, fmt.Sprintln("$error$foo"), "$prompt$[H:0] [M:0] > ")
 }
 
 func Test_Execute_PlayerHasNoCurrentCommand_InputIsCommand_CommandWantsToContinue(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 	outputChannel := make(chan *PlayerOutput, 10)
@@ -700,7 +702,7 @@ func Test_Execute_PlayerHasNoCurrentCommand_InputIsCommand_CommandWantsToContinu
 
 func Test_Execute_PlayerHasNoCurrentCommand_InputIsCommand_CommandWantsToTerminate(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 	outputChannel := make(chan *PlayerOutput, 10)
@@ -742,7 +744,7 @@ func Test_Execute_PlayerHasNoCurrentCommand_InputIsCommand_CommandWantsToTermina
 
 func Test_Execute_TextMessagesAreSentToRecipientPlayers(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	player2 := absmachine.NewPlayer()
 	player3 := absmachine.NewPlayer()
@@ -792,13 +794,13 @@ func Test_Execute_TextMessagesAreSentToRecipientPlayers(t *testing.T) {
 	q.Execute(world, 0)
 
 	// Assert
-	testOutput(t, player2OutputChannel, fmt.Sprintln(""), fmt.Sprintln("for player 2"), "$fg_bcyan$[H:123] [M:321] > ")
-	testOutput(t, player3OutputChannel, fmt.Sprintln(""), fmt.Sprintln("for player 3"), "$fg_bcyan$[H:456] [M:654] > ")
+	testOutput(t, player2OutputChannel, fmt.Sprintln("for player 2"), "$prompt$[H:123] [M:321] > ")
+	testOutput(t, player3OutputChannel, fmt.Sprintln("for player 3"), "$prompt$[H:456] [M:654] > ")
 }
 
 func Test_Execute_EchoMaybeTurnedOff(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 	playerOutputChannel := make(chan *PlayerOutput, 10)
@@ -825,14 +827,14 @@ func Test_Execute_EchoMaybeTurnedOff(t *testing.T) {
 
 	// Assert
 	output := getOutput(playerOutputChannel)
-	if len(output) != 2 || output[0].text != "$fg_bcyan$[H:0] [M:0] >" && output[1].echoState != ES_Off {
+	if len(output) != 2 || output[0].text != "$prompt$[H:0] [M:0] >" && output[1].echoState != ES_Off {
 		t.Error("Expected output to be a prompt and a single ES_Off")
 	}
 }
 
 func Test_Execute_EchoMaybeTurnedOn(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 	playerOutputChannel := make(chan *PlayerOutput, 10)
@@ -859,14 +861,14 @@ func Test_Execute_EchoMaybeTurnedOn(t *testing.T) {
 
 	// Assert
 	output := getOutput(playerOutputChannel)
-	if len(output) != 2 || output[0].text != "$fg_bcyan$[H:0] [M:0] >" && output[1].echoState != ES_On {
+	if len(output) != 2 || output[0].text != "$prompt$[H:0] [M:0] >" && output[1].echoState != ES_On {
 		t.Error("Expected output to be a prompt and a single ES_On")
 	}
 }
 
 func Test_Execute_CommandOutputSentToPlayer(t *testing.T) {
 	// Arrange
-	q := NewInputQueue(10, 10, logging.NewNullLogger())
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
 	player := absmachine.NewPlayer()
 	world := absmachine.NewWorld()
 	playerOutputChannel := make(chan *PlayerOutput, 10)
@@ -892,7 +894,286 @@ func Test_Execute_CommandOutputSentToPlayer(t *testing.T) {
 	q.Execute(world, 0)
 
 	// Assert
-	testOutput(t, playerOutputChannel, fmt.Sprintln("Some output"), "$fg_bcyan$[H:0] [M:0] > ")
+	testOutput(t, playerOutputChannel, fmt.Sprintln("Some output"), "$prompt$[H:0] [M:0] > ")
+}
+
+func Test_Execute_CommandRequestsCopyover(t *testing.T) {
+	// Arrange
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
+	player := absmachine.NewPlayer()
+	world := absmachine.NewWorld()
+
+	world.AddPlayers([]*absmachine.Player{player})
+
+	fakeCommand := FakeCommand{
+		returnResult: mudio.CommandResult{CopyoverRequested: true},
+	}
+
+	q.Append(&PlayerInput{
+		player:             player,
+		command:            &fakeCommand,
+		outputChannel:      make(chan *PlayerOutput, 10),
+		errorReturnChannel: make(chan error, 10),
+	})
+
+	if q.CopyoverRequested() {
+		t.Fatal("Copyover requested before any command was executed!")
+	}
+
+	// Act
+	q.Execute(world, 0)
+
+	// Assert
+	if !q.CopyoverRequested() {
+		t.Error("Expected copyover to be requested!")
+	}
+}
+
+func Test_Execute_CommandGmcpMessagesSentToPlayer(t *testing.T) {
+	// Arrange
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
+	player := absmachine.NewPlayer()
+	world := absmachine.NewWorld()
+	playerOutputChannel := make(chan *PlayerOutput, 10)
+
+	world.AddPlayers([]*absmachine.Player{player})
+
+	fakeCommand := FakeCommand{
+		returnResult: mudio.CommandResult{
+			Output:       "Some output",
+			GmcpMessages: []mudio.GmcpMessage{{Package: "Comm.Channel.Text", Data: "hello"}},
+		},
+	}
+
+	q.Append(&PlayerInput{
+		player:             player,
+		command:            &fakeCommand,
+		outputChannel:      playerOutputChannel,
+		errorReturnChannel: make(chan error, 10),
+	})
+
+	// Act
+	q.Execute(world, 0)
+
+	// Assert
+	output := getOutput(playerOutputChannel)
+	if len(output) != 3 || output[1].gmcp == nil || output[1].gmcp.Package != "Comm.Channel.Text" {
+		t.Errorf("Expected output, a GMCP message and a prompt, but got: %v", output)
+	}
+}
+
+func Test_Execute_GmcpPackagesSentWhenChanged(t *testing.T) {
+	// Arrange
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
+	player := absmachine.NewPlayer()
+	world := absmachine.NewWorld()
+	room := absmachine.NewRoom()
+	nextRoom := absmachine.NewRoom()
+	playerOutputChannel := make(chan *PlayerOutput, 10)
+
+	world.AddRooms([]*absmachine.Room{room, nextRoom})
+	room.ConnectDuplex(nextRoom, absmachine.DIR_NORTH)
+	world.AddPlayers([]*absmachine.Player{player})
+	player.RelocateToRoom(room)
+	player.State.SetFlag(absmachine.PS_LOGGED_IN)
+	player.Health = 30
+
+	q.Append(&PlayerInput{
+		player:             player,
+		event:              PE_EventCount, // Unknown event, just to get a player queue
+		outputChannel:      playerOutputChannel,
+		errorReturnChannel: make(chan error, 10),
+	})
+
+	gmcpPackages := func() string {
+		var packages []string
+		for _, output := range getOutput(playerOutputChannel) {
+			if output.gmcp != nil {
+				packages = append(packages, output.gmcp.Package)
+			}
+		}
+		return fmt.Sprint(packages)
+	}
+
+	// Act & Assert
+	q.Execute(world, 0)
+	if packages := gmcpPackages(); packages != "[Char.Vitals Char.Status Room.Info]" {
+		t.Errorf("Expected all packages on login, but got: %v", packages)
+	}
+
+	q.Execute(world, 1)
+	if packages := gmcpPackages(); packages != "[]" {
+		t.Errorf("Expected no packages when nothing changed, but got: %v", packages)
+	}
+
+	player.Health = 25
+	player.Move(absmachine.DIR_NORTH)
+	q.Execute(world, 2)
+	if packages := gmcpPackages(); packages != "[Char.Vitals Room.Info]" {
+		t.Errorf("Expected vitals and room, but got: %v", packages)
+	}
+}
+
+func Test_Execute_PlayerHasEvent_PE_MsspRequested_StatusSentWithoutLogin(t *testing.T) {
+	// Arrange
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
+	player := absmachine.NewPlayer()
+	world := absmachine.NewWorld()
+	playerOutputChannel := make(chan *PlayerOutput, 10)
+
+	q.Append(&PlayerInput{
+		player:             player,
+		event:              PE_MsspRequested,
+		outputChannel:      playerOutputChannel,
+		errorReturnChannel: make(chan error, 10),
+	})
+
+	// Act
+	q.Execute(world, 0)
+
+	// Assert
+	output := getOutput(playerOutputChannel)
+	if len(output) != 1 || len(output[0].mssp) == 0 || output[0].mssp[0] != (MsspVariable{"NAME", "Go MUD"}) {
+		t.Errorf("Expected the server status, but got: %v", output)
+	}
+}
+
+func Test_Execute_PlayerHasEvent_PE_CapabilitiesChanged_CommandsSeeCapabilities(t *testing.T) {
+	// Arrange
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
+	player := absmachine.NewPlayer()
+	world := absmachine.NewWorld()
+	outputChannel := make(chan *PlayerOutput, 10)
+	errorChannel := make(chan error, 10)
+	fakeCommand := FakeCommand{}
+
+	q.Append(NewCapabilitiesPlayerInput(mudio.ClientCapabilities{ClientName: "MUDLET", Utf8: true}, player, errorChannel, outputChannel))
+	q.Append(NewCommandPlayerInput(&fakeCommand, player, errorChannel, outputChannel))
+
+	// Act
+	q.Execute(world, 0)
+	q.Execute(world, 1)
+
+	// Assert
+	if fakeCommand.receivedContext == nil || fakeCommand.receivedContext.Client != (mudio.ClientCapabilities{ClientName: "MUDLET", Utf8: true}) {
+		t.Errorf("Expected the command to see the capabilities, but got: %+v", fakeCommand.receivedContext)
+	}
+}
+
+func Test_Execute_PlayerHasEvent_PE_Interrupted_CurrentCommandAborted(t *testing.T) {
+	// Arrange
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
+	player := absmachine.NewPlayer()
+	world := absmachine.NewWorld()
+	outputChannel := make(chan *PlayerOutput, 10)
+	errorChannel := make(chan error, 10)
+	fakeCommand := FakeCommand{returnResult: mudio.CommandResult{Prompt: "Are you sure? "}}
+
+	player.State.SetFlag(absmachine.PS_LOGGED_IN)
+	q.Append(NewCommandPlayerInput(&fakeCommand, player, errorChannel, outputChannel))
+	q.Execute(world, 0)
+	getOutput(outputChannel)
+
+	q.Append(NewEventPlayerInput(PE_Interrupted, player, errorChannel, outputChannel))
+
+	// Act
+	q.Execute(world, 1)
+
+	// Assert
+	testTextOutput(t, outputChannel, "\nAborted.\n", "$prompt$[H:0] [M:0] > ")
+
+	if q.playerQueues[player].currentCommand != nil {
+		t.Error("Expected current command for player to be aborted!")
+	}
+
+	if player.State.HasFlag(absmachine.PS_BUSY) {
+		t.Error("Expected player to no longer be busy!")
+	}
+}
+
+func Test_Execute_PlayerHasEvent_PE_Interrupted_NotLoggedIn_PromptShownAgain(t *testing.T) {
+	// Arrange
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
+	player := absmachine.NewPlayer()
+	world := absmachine.NewWorld()
+	outputChannel := make(chan *PlayerOutput, 10)
+	errorChannel := make(chan error, 10)
+	fakeCommand := FakeCommand{returnResult: mudio.CommandResult{Prompt: "Password: "}}
+
+	q.Append(NewCommandPlayerInput(&fakeCommand, player, errorChannel, outputChannel))
+	q.Execute(world, 0)
+	getOutput(outputChannel)
+
+	q.Append(NewEventPlayerInput(PE_Interrupted, player, errorChannel, outputChannel))
+
+	// Act
+	q.Execute(world, 1)
+
+	// Assert
+	testTextOutput(t, outputChannel, "\n", "Password: ")
+
+	if q.playerQueues[player].currentCommand != &fakeCommand {
+		t.Error("Expected the login to go on!")
+	}
+}
+
+func Test_Execute_PlayerHasEvent_PE_LineTooLong_ErrorAndCurrentPromptWritten(t *testing.T) {
+	// Arrange
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
+	player := absmachine.NewPlayer()
+	world := absmachine.NewWorld()
+	outputChannel := make(chan *PlayerOutput, 10)
+	errorChannel := make(chan error, 10)
+	fakeCommand := FakeCommand{returnResult: mudio.CommandResult{Prompt: "Name: "}}
+
+	q.Append(NewCommandPlayerInput(&fakeCommand, player, errorChannel, outputChannel))
+	q.Execute(world, 0)
+	getOutput(outputChannel)
+
+	q.Append(NewEventPlayerInput(PE_LineTooLong, player, errorChannel, outputChannel))
+
+	// Act
+	q.Execute(world, 1)
+
+	// Assert
+	testTextOutput(t, outputChannel, fmt.Sprintf("$error$Your line was too long (more than %v characters), and was thrown away.\n", MAX_LINE_LENGTH), "Name: ")
+}
+
+func Test_Execute_PromptsAreMarked(t *testing.T) {
+	// Arrange
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
+	player := absmachine.NewPlayer()
+	world := absmachine.NewWorld()
+	outputChannel := make(chan *PlayerOutput, 10)
+	errorChannel := make(chan error, 10)
+	promptingCommand := FakeCommand{returnResult: mudio.CommandResult{Output: "Some output", Prompt: "Are you sure? "}}
+	finishingCommand := FakeCommand{}
+
+	q.Append(NewCommandPlayerInput(&promptingCommand, player, errorChannel, outputChannel))
+	q.Append(NewTextPlayerInput("yes", player, errorChannel, outputChannel))
+
+	// Act
+	q.Execute(world, 0)
+	q.playerQueues[player].currentCommand = &finishingCommand // The answer finishes the command
+	q.Execute(world, 1)
+
+	// Assert
+	var marked, unmarked []string
+	for _, output := range getOutput(outputChannel) {
+		if output.prompt {
+			marked = append(marked, output.text)
+		} else {
+			unmarked = append(unmarked, output.text)
+		}
+	}
+
+	if len(marked) != 2 || marked[0] != "Are you sure? " || marked[1] != "$prompt$[H:0] [M:0] > " {
+		t.Errorf("Unexpected prompts: %#v", marked)
+	}
+
+	if len(unmarked) != 1 || unmarked[0] != fmt.Sprintln("Some output") {
+		t.Errorf("Unexpected output: %#v", unmarked)
+	}
 }
 
 // Utilities for testing the input queue
@@ -951,6 +1232,18 @@ func testOutput(t *testing.T, outputChannel <-chan *PlayerOutput, expectedValues
 	}
 }
 
+// Like testOutput, but ignores output that has no text (such as GMCP updates)
+func testTextOutput(t *testing.T, outputChannel <-chan *PlayerOutput, expectedValues ...string) {
+	filteredChannel := make(chan *PlayerOutput, len(outputChannel))
+	for _, output := range getOutput(outputChannel) {
+		if output.text != "" {
+			filteredChannel <- output
+		}
+	}
+
+	testOutput(t, filteredChannel, expectedValues...)
+}
+
 func testError(t *testing.T, errorReturnChannel <-chan error, expectedErrors ...error) {
 	errors := getErrors(errorReturnChannel)
 
@@ -978,3 +1271,222 @@ func testError(t *testing.T, errorReturnChannel <-chan error, expectedErrors ...
 		t.Errorf("Expected errors: %#v, but got: %#v", expectedErrorTexts, actualErrorTexts)
 	}
 }
+
+func Test_Execute_DisplayChanged_ThemeSentBeforeOutput(t *testing.T) {
+	// Arrange
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
+	player := absmachine.NewPlayer()
+	player.ColorTheme = map[string]string{"error": "$fg_red$"}
+	player.SplitScreen = true
+	world := absmachine.NewWorld()
+	playerOutputChannel := make(chan *PlayerOutput, 10)
+
+	world.AddPlayers([]*absmachine.Player{player})
+
+	q.Append(&PlayerInput{
+		player:             player,
+		command:            &FakeCommand{returnResult: mudio.CommandResult{Output: "$error$Red", DisplayChanged: true}},
+		outputChannel:      playerOutputChannel,
+		errorReturnChannel: make(chan error, 10),
+	})
+
+	// Act
+	q.Execute(world, 0)
+
+	// Assert
+	output := getOutput(playerOutputChannel)
+	if len(output) < 2 || output[0].display == nil || output[1].text != "$error$Red\n" {
+		t.Fatalf("Expected the display settings before the output, but got %+v", output)
+	}
+
+	if output[0].display.theme["error"] != "$fg_red$" || !output[0].display.splitScreen {
+		t.Errorf("Unexpected display settings: %+v", *output[0].display)
+	}
+
+	// The connection must not see later changes
+	player.ColorTheme["error"] = "$fg_blue$"
+	if output[0].display.theme["error"] != "$fg_red$" {
+		t.Error("The theme was not copied")
+	}
+}
+
+func Test_sendScreenUpdates_StatusAndPromptDrawnWhenChanged(t *testing.T) {
+	// Arrange
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
+	player := absmachine.NewPlayer()
+	player.Name = "Bob"
+	player.Health = 10
+	player.SplitScreen = true
+	player.State.SetFlag(absmachine.PS_LOGGED_IN)
+	playerOutputChannel := make(chan *PlayerOutput, 10)
+	q.playerQueues[player] = &PlayerQueue{inputs: list.New(), outputChannel: playerOutputChannel}
+
+	// Act
+	sendScreenUpdates(q)
+	first := getOutput(playerOutputChannel)
+	sendScreenUpdates(q)
+	second := getOutput(playerOutputChannel)
+	player.Health = 9
+	sendScreenUpdates(q)
+	third := getOutput(playerOutputChannel)
+
+	// Assert
+	if len(first) != 2 || first[0].status != " Bob, level 0 Warrior" || first[1].text != "$prompt$[H:10] [M:0] > " {
+		t.Errorf("Unexpected first update: %+v", first)
+	}
+
+	if len(second) != 0 {
+		t.Errorf("Expected no update when nothing changed, but got %+v", second)
+	}
+
+	if len(third) != 1 || third[0].text != "$prompt$[H:9] [M:0] > " || !third[0].prompt {
+		t.Errorf("Unexpected update when vitals changed: %+v", third)
+	}
+}
+
+func Test_statusBar_RoomTitleMarkup_Stripped(t *testing.T) {
+	player := &absmachine.Player{Name: "Bob", Room: &absmachine.Room{Title: "$fg_red$The $$5 shop$reset$"}}
+
+	if status := statusBar(player); status != " Bob, level 0 Warrior | The $5 shop" {
+		t.Errorf("Unexpected status %q", status)
+	}
+}
+
+func Test_sendScreenUpdates_CommandShowsPrompt_PromptLeftAlone(t *testing.T) {
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
+	player := absmachine.NewPlayer()
+	player.SplitScreen = true
+	player.State.SetFlag(absmachine.PS_LOGGED_IN)
+	playerOutputChannel := make(chan *PlayerOutput, 10)
+	q.playerQueues[player] = &PlayerQueue{inputs: list.New(), outputChannel: playerOutputChannel, currentCommand: &FakeCommand{}}
+	player.Health = 5
+
+	sendScreenUpdates(q)
+
+	for _, output := range getOutput(playerOutputChannel) {
+		if output.prompt {
+			t.Errorf("Unexpected prompt %q", output.text)
+		}
+	}
+}
+
+func Test_sendScreenUpdates_NoSplitScreen_NothingSent(t *testing.T) {
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
+	player := absmachine.NewPlayer()
+	player.State.SetFlag(absmachine.PS_LOGGED_IN)
+	playerOutputChannel := make(chan *PlayerOutput, 10)
+	q.playerQueues[player] = &PlayerQueue{inputs: list.New(), outputChannel: playerOutputChannel}
+
+	sendScreenUpdates(q)
+
+	if output := getOutput(playerOutputChannel); len(output) != 0 {
+		t.Errorf("Unexpected output: %+v", output)
+	}
+}
+
+func Test_Execute_LongOutput_ShownAPageAtATime(t *testing.T) {
+	// Arrange
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
+	player := absmachine.NewPlayer()
+	world := absmachine.NewWorld()
+	outputChannel := make(chan *PlayerOutput, 10)
+	errorChannel := make(chan error, 10)
+	fakeCommand := FakeCommand{returnResult: mudio.CommandResult{Output: "1\n2\n3\n4\n5\n"}}
+
+	q.Append(NewCapabilitiesPlayerInput(mudio.ClientCapabilities{Width: 80, Height: 4}, player, errorChannel, outputChannel))
+	q.Append(NewCommandPlayerInput(&fakeCommand, player, errorChannel, outputChannel))
+
+	// Act
+	q.Execute(world, 0)
+
+	// Assert
+	testTextOutput(t, outputChannel, "1\n2\n3\n", PAGER_PROMPT)
+
+	if player.State.HasFlag(absmachine.PS_BUSY) {
+		t.Error("Expected a player reading pages not to be busy")
+	}
+
+	// Act
+	q.Append(NewTextPlayerInput("", player, errorChannel, outputChannel))
+	q.Execute(world, 1)
+
+	// Assert
+	testTextOutput(t, outputChannel, "4\n5\n", "$prompt$[H:0] [M:0] > ")
+
+	if q.playerQueues[player].currentCommand != nil {
+		t.Error("Expected the pager to be done")
+	}
+}
+
+func Test_Execute_Paging_OutputOfOthersHeldBack(t *testing.T) {
+	// Arrange
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
+	player := absmachine.NewPlayer()
+	player2 := absmachine.NewPlayer()
+	world := absmachine.NewWorld()
+	outputChannel := make(chan *PlayerOutput, 10)
+	output2Channel := make(chan *PlayerOutput, 10)
+	errorChannel := make(chan error, 10)
+
+	q.Append(NewCapabilitiesPlayerInput(mudio.ClientCapabilities{Height: 3}, player, errorChannel, outputChannel))
+	q.Append(NewCommandPlayerInput(&FakeCommand{returnResult: mudio.CommandResult{Output: "1\n2\n3\n"}}, player, errorChannel, outputChannel))
+	q.Execute(world, 0)
+	getOutput(outputChannel)
+
+	tell := FakeCommand{returnResult: mudio.CommandResult{TextMessages: []mudio.TextMessage{{Text: "Psst!", RecipientPlayer: player}}}}
+	q.Append(NewCommandPlayerInput(&tell, player2, errorChannel, output2Channel))
+
+	// Act
+	q.Execute(world, 1)
+
+	// Assert
+	testTextOutput(t, outputChannel)
+
+	// Act
+	q.Append(NewTextPlayerInput("q", player, errorChannel, outputChannel))
+	q.Execute(world, 2)
+
+	// Assert
+	testTextOutput(t, outputChannel, "Psst!\n", "$prompt$[H:0] [M:0] > ")
+}
+
+func Test_Execute_CommandHasJob_InputWaitsUntilJobDone(t *testing.T) {
+	// Arrange
+	q := NewInputQueue(10, 10, nil, config.Default(), logging.NewNullLogger())
+	player := absmachine.NewPlayer()
+	world := absmachine.NewWorld()
+	outputChannel := make(chan *PlayerOutput, 10)
+	errorChannel := make(chan error, 10)
+	fakeCommand := FakeCommand{returnResult: mudio.CommandResult{Job: func() interface{} { return 42 }}}
+
+	q.Append(NewCommandPlayerInput(&fakeCommand, player, errorChannel, outputChannel))
+	q.Execute(world, 0)
+
+	output := getOutput(outputChannel)
+	if len(output) != 1 || output[0].job == nil {
+		t.Fatalf("Expected the job to be sent, but got: %v", output)
+	}
+
+	// Act
+	fakeCommand.returnResult = mudio.CommandResult{Output: "Done"}
+	q.Append(NewTextPlayerInput("look", player, errorChannel, outputChannel))
+	q.Execute(world, 1)
+
+	// Assert
+	testTextOutput(t, outputChannel)
+
+	// Act
+	q.Append(NewJobDonePlayerInput(output[0].job(), player, errorChannel, outputChannel))
+	q.Execute(world, 2)
+
+	// Assert
+	testTextOutput(t, outputChannel, "Done\n", "$prompt$[H:0] [M:0] > ")
+
+	if fakeCommand.receivedContext.JobResult != 42 || fakeCommand.receivedContext.Input != "" {
+		t.Errorf("Expected the command to get the result of the job, but got: %+v", fakeCommand.receivedContext)
+	}
+
+	if q.playerQueues[player].inputs.Len() != 1 {
+		t.Error("Expected the input to wait for the job")
+	}
+}
@@ -0,0 +1,78 @@
+package io
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/config"
+)
+
+// MUD Server Status Protocol (MSSP): MUD listing sites (crawlers) connect, agree to MSSP, and get a list of
+// variables describing the server, without logging in.
+
+const (
+	MSSP_VAR = 1
+	MSSP_VAL = 2
+)
+
+const MSSP_CODEBASE = "go_mud"
+
+type MsspVariable struct {
+	Name  string
+	Value string
+}
+
+// The variables reported to MUD listing sites. The configured variables come last, and may not override the
+// ones that are counted or measured.
+func msspVariables(world *absmachine.World, cfg *config.Config, startTime time.Time) []MsspVariable {
+	variables := []MsspVariable{
+		{"NAME", cfg.MudName},
+		{"PLAYERS", fmt.Sprint(len(world.Players))},
+		{"UPTIME", fmt.Sprint(startTime.Unix())},
+		{"PORT", fmt.Sprint(cfg.Port)},
+		{"CODEBASE", MSSP_CODEBASE},
+		{"ROOMS", fmt.Sprint(len(world.Rooms))},
+		{"MOBILES", fmt.Sprint(len(world.MobPrototypes))},
+		{"OBJECTS", fmt.Sprint(len(world.ObjectPrototypes))},
+		{"ANSI", "1"},
+		{"MCCP", "1"},
+		{"GMCP", "1"},
+	}
+
+	if cfg.TlsPort != 0 {
+		variables = append(variables, MsspVariable{"SSL", fmt.Sprint(cfg.TlsPort)})
+	}
+
+	reported := make(map[string]bool)
+	for _, variable := range variables {
+		reported[variable.Name] = true
+	}
+
+	names := make([]string, 0, len(cfg.MsspVariables))
+	for name := range cfg.MsspVariables {
+		if !reported[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		variables = append(variables, MsspVariable{name, cfg.MsspVariables[name]})
+	}
+
+	return variables
+}
+
+// Encodes variables as the payload of an MSSP subnegotiation: MSSP_VAR <name> MSSP_VAL <value> ...
+func encodeMssp(variables []MsspVariable) []byte {
+	var payload []byte
+	for _, variable := range variables {
+		payload = append(payload, MSSP_VAR)
+		payload = append(payload, variable.Name...)
+		payload = append(payload, MSSP_VAL)
+		payload = append(payload, variable.Value...)
+	}
+	return payload
+}
@@ -0,0 +1,84 @@
+package io
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/config"
+)
+
+func Test_msspVariables(t *testing.T) {
+	// Arrange
+	world := absmachine.NewWorld()
+	world.AddRooms([]*absmachine.Room{absmachine.NewRoom(), absmachine.NewRoom()})
+	world.AddPlayers([]*absmachine.Player{absmachine.NewPlayer()})
+
+	cfg := config.Default()
+	cfg.MsspVariables = map[string]string{"WEBSITE": "https://example.com", "CONTACT": "admin@example.com", "PLAYERS": "1000"}
+
+	// Act
+	variables := msspVariables(world, cfg, time.Unix(1700000000, 0))
+
+	// Assert
+	values := make(map[string]string)
+	for _, variable := range variables {
+		if _, found := values[variable.Name]; found {
+			t.Errorf("Variable %v reported twice", variable.Name)
+		}
+		values[variable.Name] = variable.Value
+	}
+
+	expected := map[string]string{
+		"NAME":     "Go MUD",
+		"PLAYERS":  "1",
+		"UPTIME":   "1700000000",
+		"PORT":     "5000",
+		"ROOMS":    "2",
+		"MOBILES":  "0",
+		"CODEBASE": MSSP_CODEBASE,
+		"CONTACT":  "admin@example.com",
+		"WEBSITE":  "https://example.com",
+	}
+
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("Expected %v to be %q, but it was %q", name, value, values[name])
+		}
+	}
+
+	if last := variables[len(variables)-1]; last.Name != "WEBSITE" {
+		t.Errorf("Expected configured variables last, sorted on name, but the last was %v", last.Name)
+	}
+}
+
+func Test_msspVariables_TlsPortReportedAsSsl(t *testing.T) {
+	cfg := config.Default()
+
+	for _, port := range []int{0, 5001} {
+		cfg.TlsPort = port
+		ssl := ""
+		for _, variable := range msspVariables(absmachine.NewWorld(), cfg, time.Now()) {
+			if variable.Name == "SSL" {
+				ssl = variable.Value
+			}
+		}
+
+		if port == 0 && ssl != "" || port != 0 && ssl != "5001" {
+			t.Errorf("Unexpected SSL variable %q for TLS port %v", ssl, port)
+		}
+	}
+}
+
+func Test_encodeMssp(t *testing.T) {
+	payload := encodeMssp([]MsspVariable{{"NAME", "Go MUD"}, {"PLAYERS", "3"}})
+
+	expected := append(append([]byte{MSSP_VAR}, "NAME"...), MSSP_VAL)
+	expected = append(append(append(expected, "Go MUD"...), MSSP_VAR), "PLAYERS"...)
+	expected = append(append(expected, MSSP_VAL), '3')
+
+	if !bytes.Equal(expected, payload) {
+		t.Errorf("Unexpected payload %q", payload)
+	}
+}
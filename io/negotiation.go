@@ -0,0 +1,145 @@
+package io
+
+// Telnet option negotiation, using the Q method of RFC 1143. Each option has two sides: "us" (enabled by
+// WILL, answered by DO/DONT), and "him" (enabled by DO, answered by WILL/WONT). Each side keeps a state and a
+// queue bit, so that a request to change the state while a negotiation is in progress is remembered rather than
+// sent, and we never answer a request that merely acknowledges our own. That is what avoids negotiation loops.
+
+type qState byte
+
+const (
+	Q_NO qState = iota
+	Q_YES
+	Q_WANTNO
+	Q_WANTYES
+)
+
+type qQueue byte
+
+const (
+	Q_EMPTY qQueue = iota
+	Q_OPPOSITE
+)
+
+// What to send to the other end after a state change
+type qAnswer byte
+
+const (
+	QA_NONE    qAnswer = iota
+	QA_ENABLE          // WILL (us) or DO (him)
+	QA_DISABLE         // WONT (us) or DONT (him)
+)
+
+type qSide struct {
+	state qState
+	queue qQueue
+}
+
+func (side *qSide) enabled() bool {
+	return side.state == Q_YES
+}
+
+// The other end wants the option enabled (WILL for him, DO for us). `agree` tells if we support it.
+func (side *qSide) receivedEnable(agree bool) qAnswer {
+	switch side.state {
+	case Q_NO:
+		if agree {
+			side.state = Q_YES
+			return QA_ENABLE
+		}
+		return QA_DISABLE
+	case Q_WANTNO:
+		// The other end answered our disable request by enabling, which is an error. RFC 1143 says to consider
+		// the option disabled, unless we wanted it enabled again anyway.
+		if side.queue == Q_EMPTY {
+			side.state = Q_NO
+		} else {
+			side.state = Q_YES
+			side.queue = Q_EMPTY
+		}
+	case Q_WANTYES:
+		if side.queue == Q_EMPTY {
+			side.state = Q_YES
+		} else {
+			side.state = Q_WANTNO
+			side.queue = Q_EMPTY
+			return QA_DISABLE
+		}
+	}
+
+	return QA_NONE
+}
+
+// The other end wants the option disabled (WONT for him, DONT for us)
+func (side *qSide) receivedDisable() qAnswer {
+	switch side.state {
+	case Q_YES:
+		side.state = Q_NO
+		return QA_DISABLE
+	case Q_WANTNO:
+		if side.queue == Q_EMPTY {
+			side.state = Q_NO
+		} else {
+			side.state = Q_WANTYES
+			side.queue = Q_EMPTY
+			return QA_ENABLE
+		}
+	case Q_WANTYES:
+		side.state = Q_NO
+		side.queue = Q_EMPTY
+	}
+
+	return QA_NONE
+}
+
+// We want the option enabled
+func (side *qSide) requestEnable() qAnswer {
+	switch side.state {
+	case Q_NO:
+		side.state = Q_WANTYES
+		return QA_ENABLE
+	case Q_WANTNO:
+		side.queue = Q_OPPOSITE
+	case Q_WANTYES:
+		side.queue = Q_EMPTY
+	}
+
+	return QA_NONE
+}
+
+// We want the option disabled
+func (side *qSide) requestDisable() qAnswer {
+	switch side.state {
+	case Q_YES:
+		side.state = Q_WANTNO
+		return QA_DISABLE
+	case Q_WANTNO:
+		side.queue = Q_EMPTY
+	case Q_WANTYES:
+		side.queue = Q_OPPOSITE
+	}
+
+	return QA_NONE
+}
+
+type optionNegotiation struct {
+	us  qSide
+	him qSide
+}
+
+// Options we are willing to enable on our side, when the other end asks us to (DO). ECHO is missing on
+// purpose: we only echo (or rather, pretend to and echo nothing) when we ask for it ourselves.
+var supportedLocalOptions = map[byte]bool{
+	SUPPRESS_GO_AHEAD: true,
+	END_OF_RECORD:     true,
+	COMPRESS2:         true,
+	GMCP:              true,
+	MSSP:              true,
+	CHARSET:           true,
+}
+
+// Options we are willing to let the other end enable (WILL)
+var supportedRemoteOptions = map[byte]bool{
+	TERMINAL_TYPE: true,
+	NAWS:          true,
+}
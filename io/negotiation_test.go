@@ -0,0 +1,46 @@
+package io
+
+import "testing"
+
+func Test_qSide_Transitions(t *testing.T) {
+	testCases := []struct {
+		name           string
+		side           qSide
+		event          func(side *qSide) qAnswer
+		expectedSide   qSide
+		expectedAnswer qAnswer
+	}{
+		{"NO, enable received, agree", qSide{Q_NO, Q_EMPTY}, func(s *qSide) qAnswer { return s.receivedEnable(true) }, qSide{Q_YES, Q_EMPTY}, QA_ENABLE},
+		{"NO, enable received, refuse", qSide{Q_NO, Q_EMPTY}, func(s *qSide) qAnswer { return s.receivedEnable(false) }, qSide{Q_NO, Q_EMPTY}, QA_DISABLE},
+		{"YES, enable received", qSide{Q_YES, Q_EMPTY}, func(s *qSide) qAnswer { return s.receivedEnable(true) }, qSide{Q_YES, Q_EMPTY}, QA_NONE},
+		{"WANTNO empty, enable received", qSide{Q_WANTNO, Q_EMPTY}, func(s *qSide) qAnswer { return s.receivedEnable(true) }, qSide{Q_NO, Q_EMPTY}, QA_NONE},
+		{"WANTNO opposite, enable received", qSide{Q_WANTNO, Q_OPPOSITE}, func(s *qSide) qAnswer { return s.receivedEnable(true) }, qSide{Q_YES, Q_EMPTY}, QA_NONE},
+		{"WANTYES empty, enable received", qSide{Q_WANTYES, Q_EMPTY}, func(s *qSide) qAnswer { return s.receivedEnable(false) }, qSide{Q_YES, Q_EMPTY}, QA_NONE},
+		{"WANTYES opposite, enable received", qSide{Q_WANTYES, Q_OPPOSITE}, func(s *qSide) qAnswer { return s.receivedEnable(true) }, qSide{Q_WANTNO, Q_EMPTY}, QA_DISABLE},
+		{"NO, disable received", qSide{Q_NO, Q_EMPTY}, func(s *qSide) qAnswer { return s.receivedDisable() }, qSide{Q_NO, Q_EMPTY}, QA_NONE},
+		{"YES, disable received", qSide{Q_YES, Q_EMPTY}, func(s *qSide) qAnswer { return s.receivedDisable() }, qSide{Q_NO, Q_EMPTY}, QA_DISABLE},
+		{"WANTNO empty, disable received", qSide{Q_WANTNO, Q_EMPTY}, func(s *qSide) qAnswer { return s.receivedDisable() }, qSide{Q_NO, Q_EMPTY}, QA_NONE},
+		{"WANTNO opposite, disable received", qSide{Q_WANTNO, Q_OPPOSITE}, func(s *qSide) qAnswer { return s.receivedDisable() }, qSide{Q_WANTYES, Q_EMPTY}, QA_ENABLE},
+		{"WANTYES opposite, disable received", qSide{Q_WANTYES, Q_OPPOSITE}, func(s *qSide) qAnswer { return s.receivedDisable() }, qSide{Q_NO, Q_EMPTY}, QA_NONE},
+		{"NO, enable requested", qSide{Q_NO, Q_EMPTY}, func(s *qSide) qAnswer { return s.requestEnable() }, qSide{Q_WANTYES, Q_EMPTY}, QA_ENABLE},
+		{"YES, enable requested", qSide{Q_YES, Q_EMPTY}, func(s *qSide) qAnswer { return s.requestEnable() }, qSide{Q_YES, Q_EMPTY}, QA_NONE},
+		{"WANTNO, enable requested", qSide{Q_WANTNO, Q_EMPTY}, func(s *qSide) qAnswer { return s.requestEnable() }, qSide{Q_WANTNO, Q_OPPOSITE}, QA_NONE},
+		{"WANTYES opposite, enable requested", qSide{Q_WANTYES, Q_OPPOSITE}, func(s *qSide) qAnswer { return s.requestEnable() }, qSide{Q_WANTYES, Q_EMPTY}, QA_NONE},
+		{"YES, disable requested", qSide{Q_YES, Q_EMPTY}, func(s *qSide) qAnswer { return s.requestDisable() }, qSide{Q_WANTNO, Q_EMPTY}, QA_DISABLE},
+		{"NO, disable requested", qSide{Q_NO, Q_EMPTY}, func(s *qSide) qAnswer { return s.requestDisable() }, qSide{Q_NO, Q_EMPTY}, QA_NONE},
+		{"WANTYES, disable requested", qSide{Q_WANTYES, Q_EMPTY}, func(s *qSide) qAnswer { return s.requestDisable() }, qSide{Q_WANTYES, Q_OPPOSITE}, QA_NONE},
+		{"WANTNO opposite, disable requested", qSide{Q_WANTNO, Q_OPPOSITE}, func(s *qSide) qAnswer { return s.requestDisable() }, qSide{Q_WANTNO, Q_EMPTY}, QA_NONE},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			side := testCase.side
+
+			answer := testCase.event(&side)
+
+			if side != testCase.expectedSide || answer != testCase.expectedAnswer {
+				t.Errorf("Expected %+v and answer %v, got %+v and answer %v", testCase.expectedSide, testCase.expectedAnswer, side, answer)
+			}
+		})
+	}
+}
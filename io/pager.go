@@ -0,0 +1,119 @@
+package io
+
+import (
+	"strings"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/ansi"
+	"github.com/jorgensigvardsson/gomud/mudio"
+)
+
+// Output of a command that is longer than the player's window is shown a page at a time. The pager takes over from
+// the command that is done, and shows the next page whenever the player presses return, like a command that asks
+// a question. Meanwhile, what others say and do is held back, so that it doesn't scroll the page away.
+
+const PAGER_PROMPT = "$prompt$[Return to continue, q to quit, r to refresh] "
+
+// At most this much output from others is held back while a player reads a page (the oldest is thrown away)
+const PAGER_MAX_HELD_OUTPUT = 50
+
+type pager struct {
+	pages []string
+	page  int // The page being shown
+}
+
+// Returns a pager for output that doesn't fit in the player's window, or nil if it fits (or the size of the window
+// is unknown)
+func newPager(output string, player *absmachine.Player, capabilities mudio.ClientCapabilities) *pager {
+	pages := paginate(output, windowWidth(capabilities), pageHeight(player, capabilities))
+	if len(pages) < 2 {
+		return nil
+	}
+
+	return &pager{pages: pages}
+}
+
+// The number of lines of output that fit in the window of a player, above the prompt (and the status bar), or 0 if
+// the size of the window is unknown
+func pageHeight(player *absmachine.Player, capabilities mudio.ClientCapabilities) int {
+	height := capabilities.Height
+	if height == 0 {
+		return 0
+	}
+
+	if player.SplitScreen && height >= SPLIT_SCREEN_MIN_HEIGHT {
+		height-- // The status bar
+	}
+
+	// The prompt may take up more than one line, in a narrow window
+	height -= strings.Count(ansi.Wrap(PAGER_PROMPT, windowWidth(capabilities)), "\n") + 1
+	if height < 1 {
+		return 1
+	}
+	return height
+}
+
+// Splits output into pages of `height` lines, as they are wrapped to `width` columns. Output is one page if the
+// height is 0.
+func paginate(output string, width int, height int) []string {
+	lines := strings.Split(strings.TrimSuffix(ansi.Wrap(output, width), "\n"), "\n")
+	if height == 0 || len(lines) <= height {
+		return []string{output}
+	}
+
+	var pages []string
+	for start := 0; start < len(lines); start += height {
+		end := start + height
+		if end > len(lines) {
+			end = len(lines)
+		}
+		pages = append(pages, strings.Join(lines[start:end], "\n"))
+	}
+
+	return pages
+}
+
+// The page being shown, with the pager's prompt unless it's the last page
+func (pager *pager) result() mudio.CommandResult {
+	result := mudio.CommandResult{Output: pager.pages[pager.page]}
+	if pager.page < len(pager.pages)-1 {
+		result.Prompt = PAGER_PROMPT
+	}
+	return result
+}
+
+func (pager *pager) Execute(context *mudio.CommandContext) (mudio.CommandResult, *mudio.CommandError) {
+	switch strings.ToLower(context.Input) {
+	case "":
+		pager.page++
+	case "q":
+		return mudio.CommandResult{}, nil
+	case "r":
+		// Show the same page again, e.g. after the window was cleared
+	default:
+		return mudio.CommandResult{Prompt: PAGER_PROMPT}, nil
+	}
+
+	return pager.result(), nil
+}
+
+// Holds back output for a player who is reading a page, rather than sending it
+func holdOutput(pq *PlayerQueue, text string) {
+	if len(pq.heldOutput) == PAGER_MAX_HELD_OUTPUT {
+		pq.heldOutput = pq.heldOutput[1:]
+	}
+	pq.heldOutput = append(pq.heldOutput, text)
+}
+
+// Sends the output that was held back while the player was reading pages
+func sendHeldOutput(pq *PlayerQueue) {
+	for _, text := range pq.heldOutput {
+		pq.outputChannel <- PrintlnOutput(text)
+	}
+	pq.heldOutput = nil
+}
+
+func isPaging(pq *PlayerQueue) bool {
+	_, paging := pq.currentCommand.(*pager)
+	return paging
+}
@@ -0,0 +1,85 @@
+package io
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/mudio"
+)
+
+func Test_paginate_SplitsWrappedLines(t *testing.T) {
+	pages := paginate("one two three\nfour\nfive\n", 9, 2)
+
+	if !reflect.DeepEqual(pages, []string{"one two\nthree", "four\nfive"}) {
+		t.Errorf("Unexpected pages %q", pages)
+	}
+}
+
+func Test_paginate_Fits_OutputAsItIs(t *testing.T) {
+	pages := paginate("one\ntwo\n", 80, 2)
+
+	if !reflect.DeepEqual(pages, []string{"one\ntwo\n"}) {
+		t.Errorf("Unexpected pages %q", pages)
+	}
+}
+
+func Test_pageHeight(t *testing.T) {
+	player := absmachine.NewPlayer()
+	splitPlayer := absmachine.NewPlayer()
+	splitPlayer.SplitScreen = true
+
+	tests := []struct {
+		player   *absmachine.Player
+		height   int
+		expected int
+	}{
+		{player, 0, 0},
+		{player, 24, 23},
+		{splitPlayer, 24, 22},
+		{splitPlayer, SPLIT_SCREEN_MIN_HEIGHT - 1, SPLIT_SCREEN_MIN_HEIGHT - 2}, // Too low to be split
+		{player, 1, 1},
+	}
+
+	// The prompt takes up two lines in a narrow window
+	if height := pageHeight(player, mudio.ClientCapabilities{Width: 40, Height: 24}); height != 22 {
+		t.Errorf("Expected 22 lines in a narrow window, but got %v", height)
+	}
+
+	for _, test := range tests {
+		if height := pageHeight(test.player, mudio.ClientCapabilities{Height: test.height}); height != test.expected {
+			t.Errorf("Expected %v lines for a height of %v, but got %v", test.expected, test.height, height)
+		}
+	}
+}
+
+func Test_pager_Execute(t *testing.T) {
+	pager := &pager{pages: []string{"one", "two", "three"}}
+
+	tests := []struct {
+		input    string
+		expected mudio.CommandResult
+	}{
+		{"", mudio.CommandResult{Output: "two", Prompt: PAGER_PROMPT}},
+		{"r", mudio.CommandResult{Output: "two", Prompt: PAGER_PROMPT}},
+		{"what?", mudio.CommandResult{Prompt: PAGER_PROMPT}},
+		{"", mudio.CommandResult{Output: "three"}},
+	}
+
+	for _, test := range tests {
+		result, err := pager.Execute(&mudio.CommandContext{Input: test.input})
+		if err != nil || !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("Input %q: unexpected result %+v (%v)", test.input, result, err)
+		}
+	}
+}
+
+func Test_pager_Execute_Quit_Done(t *testing.T) {
+	pager := &pager{pages: []string{"one", "two", "three"}}
+
+	result, _ := pager.Execute(&mudio.CommandContext{Input: "Q"})
+
+	if !reflect.DeepEqual(result, mudio.CommandResult{}) {
+		t.Errorf("Unexpected result %+v", result)
+	}
+}
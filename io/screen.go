@@ -0,0 +1,107 @@
+package io
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// A VT100 split screen: output scrolls in a region at the top of the screen, while the last two lines hold a status
+// bar and the prompt, which stay where they are. The screen is only split for ANSI terminals that tell us their
+// height, when the player has asked for it.
+
+// Screens lower than this are too cramped to give up two lines
+const SPLIT_SCREEN_MIN_HEIGHT = 10
+
+const (
+	VT_SAVE_CURSOR    = "\x1b7"
+	VT_RESTORE_CURSOR = "\x1b8"
+	VT_ERASE_LINE     = "\x1b[2K"
+	VT_RESET_REGION   = "\x1b[r"
+	VT_REVERSE_VIDEO  = "\x1b[7m"
+	VT_RESET          = "\x1b[0m"
+)
+
+type splitScreen struct {
+	wanted bool   // The player has asked for a split screen
+	width  int    // The size of the screen the layout was made for
+	height int    // ...which is 0 while the screen is not split
+	status string // The text of the status bar
+	prompt string // The prompt, with its escape codes, so that it can be drawn again
+}
+
+func (screen *splitScreen) active() bool {
+	return screen.height != 0
+}
+
+// Returns the escape codes that split the screen, lay it out again for a new size, or make it whole again,
+// depending on what the player wants and what the terminal can do
+func (screen *splitScreen) layout(terminal bool, width int, height int) string {
+	if !screen.wanted || !terminal || height < SPLIT_SCREEN_MIN_HEIGHT {
+		return screen.restore()
+	}
+
+	if screen.width == width && screen.height == height {
+		return ""
+	}
+
+	screen.width = width
+	screen.height = height
+
+	return fmt.Sprintf("\x1b[1;%vr", screen.scrollRegionBottom()) + screen.drawStatus() + screen.drawPrompt(screen.prompt)
+}
+
+// Returns the escape codes that make the screen whole again, with the status bar and prompt erased, and the cursor
+// on the last line
+func (screen *splitScreen) restore() string {
+	if !screen.active() {
+		return ""
+	}
+
+	height := screen.height
+	screen.width = 0
+	screen.height = 0
+
+	return fmt.Sprintf("%v\x1b[%v;1H%v\x1b[%v;1H%v", VT_RESET_REGION, height-1, VT_ERASE_LINE, height, VT_ERASE_LINE)
+}
+
+func (screen *splitScreen) scrollRegionBottom() int {
+	return screen.height - 2
+}
+
+// Returns the escape codes that write text at the bottom of the scroll region, and then put the cursor back in
+// the prompt, where the player may be typing
+func (screen *splitScreen) scroll(text string) string {
+	if !strings.HasSuffix(text, "\n") {
+		// The next text starts at the beginning of the bottom line, so this one must end the line
+		text += "\n"
+	}
+
+	return fmt.Sprintf("%v\x1b[%v;1H%v%v", VT_SAVE_CURSOR, screen.scrollRegionBottom(), text, VT_RESTORE_CURSOR)
+}
+
+// Returns the escape codes that draw the prompt on the last line, and leave the cursor after it
+func (screen *splitScreen) drawPrompt(prompt string) string {
+	screen.prompt = prompt
+	return fmt.Sprintf("\x1b[%v;1H%v%v", screen.height, VT_ERASE_LINE, prompt)
+}
+
+func (screen *splitScreen) setStatus(status string) string {
+	screen.status = status
+	if !screen.active() {
+		return ""
+	}
+	return screen.drawStatus()
+}
+
+// Returns the escape codes that draw the status bar, in reverse video across the whole line
+func (screen *splitScreen) drawStatus() string {
+	status := screen.status
+	if length := utf8.RuneCountInString(status); length < screen.width {
+		status += strings.Repeat(" ", screen.width-length)
+	} else {
+		status = string([]rune(status)[:screen.width])
+	}
+
+	return fmt.Sprintf("%v\x1b[%v;1H%v%v%v%v%v", VT_SAVE_CURSOR, screen.height-1, VT_ERASE_LINE, VT_REVERSE_VIDEO, status, VT_RESET, VT_RESTORE_CURSOR)
+}
@@ -0,0 +1,75 @@
+package io
+
+import "testing"
+
+func Test_splitScreen_Layout_RegionStatusAndPrompt(t *testing.T) {
+	screen := splitScreen{wanted: true, status: "Bob", prompt: "> "}
+
+	layout := screen.layout(true, 5, 24)
+
+	expected := "\x1b[1;22r" + "\x1b7\x1b[23;1H\x1b[2K\x1b[7mBob  \x1b[0m\x1b8" + "\x1b[24;1H\x1b[2K> "
+	if layout != expected || !screen.active() {
+		t.Errorf("Unexpected layout %q", layout)
+	}
+
+	if again := screen.layout(true, 5, 24); again != "" {
+		t.Errorf("Expected nothing for the same size, but got %q", again)
+	}
+}
+
+func Test_splitScreen_Layout_NotWantedOrNoTerminal_NotSplit(t *testing.T) {
+	testCases := []struct {
+		wanted   bool
+		terminal bool
+		height   int
+	}{
+		{false, true, 24},
+		{true, false, 24},
+		{true, true, 0},
+		{true, true, SPLIT_SCREEN_MIN_HEIGHT - 1},
+	}
+
+	for _, testCase := range testCases {
+		screen := splitScreen{wanted: testCase.wanted}
+
+		if layout := screen.layout(testCase.terminal, 80, testCase.height); layout != "" || screen.active() {
+			t.Errorf("Expected no split screen for %+v, but got %q", testCase, layout)
+		}
+	}
+}
+
+func Test_splitScreen_NoLongerWanted_Restored(t *testing.T) {
+	screen := splitScreen{wanted: true}
+	screen.layout(true, 80, 24)
+
+	screen.wanted = false
+	layout := screen.layout(true, 80, 24)
+
+	if layout != "\x1b[r\x1b[23;1H\x1b[2K\x1b[24;1H\x1b[2K" || screen.active() {
+		t.Errorf("Unexpected layout %q", layout)
+	}
+}
+
+func Test_splitScreen_Scroll_WrittenAtBottomOfRegion(t *testing.T) {
+	screen := splitScreen{wanted: true}
+	screen.layout(true, 80, 24)
+
+	if text := screen.scroll("Hello\n"); text != "\x1b7\x1b[22;1HHello\n\x1b8" {
+		t.Errorf("Unexpected text %q", text)
+	}
+
+	if text := screen.scroll("No new line"); text != "\x1b7\x1b[22;1HNo new line\n\x1b8" {
+		t.Errorf("Unexpected text %q", text)
+	}
+}
+
+func Test_splitScreen_SetStatus_TruncatedToWidth(t *testing.T) {
+	screen := splitScreen{wanted: true}
+	screen.layout(true, 10, 24)
+
+	status := screen.setStatus("Bob | The peaceful room")
+
+	if status != "\x1b7\x1b[23;1H\x1b[2K\x1b[7mBob | The \x1b[0m\x1b8" {
+		t.Errorf("Unexpected status %q", status)
+	}
+}
@@ -0,0 +1,128 @@
+package io
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jorgensigvardsson/gomud/logging"
+	"github.com/jorgensigvardsson/gomud/mudio"
+)
+
+// A connection that has been detached from the goroutine serving it, so that it can be handed over to the next
+// process in a copyover
+type DetachedSession struct {
+	File            *os.File `json:"-"` // A duplicate of the connection, which survives the goroutine closing the connection
+	Fd              uintptr  // The file descriptor of the connection in the next process
+	PlayerName      string
+	Capabilities    mudio.ClientCapabilities
+	EchoOff         bool
+	Compressed      bool // The client has agreed to compression (MCCP2)
+	Gmcp            bool // The client has agreed to GMCP
+	EndOfRecord     bool // The client has agreed to prompts being marked with IAC EOR
+	SuppressGoAhead bool // The client has agreed to prompts not being marked with IAC GA
+}
+
+// What a process hands over to the next process in a copyover
+type CopyoverState struct {
+	ListenerFd uintptr
+	Sessions   []*DetachedSession
+	StartTime  int64 // When the first process was started (Unix time), since a copyover is not a restart
+}
+
+// Detaches connections from the goroutines serving them
+type Detacher struct {
+	detachChannel chan interface{}
+	sessions      chan *DetachedSession
+}
+
+func NewDetacher(maxSessions int) *Detacher {
+	return &Detacher{
+		detachChannel: make(chan interface{}),
+		sessions:      make(chan *DetachedSession, maxSessions),
+	}
+}
+
+// Asks all goroutines serving connections to detach them, and returns the detached sessions once the goroutines
+// (tracked by `wg`) are done. Connections of players that are not logged in are closed rather than detached.
+func (d *Detacher) Detach(wg *sync.WaitGroup) []*DetachedSession {
+	close(d.detachChannel)
+	wg.Wait()
+	close(d.sessions)
+
+	var sessions []*DetachedSession
+	for session := range d.sessions {
+		sessions = append(sessions, session)
+	}
+
+	return sessions
+}
+
+func (d *Detacher) detachConnection(tcpConnection net.Conn, connection TelnetConnection, session *connectionSession, lineInputChannel <-chan LineInput, wgLineReader *sync.WaitGroup, logger logging.Logger) bool {
+	if session.secure || session.websocket {
+		// The state of the encryption, or of the HTTP server, can't be handed over to the next process
+		logger.Printlnf("Can't detach the encrypted or browser connection of %v", session.player.Name)
+		return false
+	}
+
+	fileConnection, ok := tcpConnection.(interface{ File() (*os.File, error) })
+	if !ok {
+		logger.Printlnf("Can't detach connection of %v, it has no file descriptor", session.player.Name)
+		return false
+	}
+
+	// Stop the line reader without closing the connection. Input that has been read, but not handled, is lost.
+	tcpConnection.SetReadDeadline(time.Now())
+	stopLineReader(lineInputChannel, wgLineReader)
+
+	// The next process can't pick up a compressed stream where this one left off, so end it here
+	compressed := connection.IsLocalOptionEnabled(COMPRESS2)
+	if compressed {
+		connection.(*implTelnetConnection).endCompression()
+	}
+
+	file, err := fileConnection.File()
+	if err != nil {
+		logger.Printlnf("Can't detach connection of %v: %v", session.player.Name, err)
+		return false
+	}
+
+	d.sessions <- &DetachedSession{
+		File:            file,
+		PlayerName:      session.player.Name,
+		Capabilities:    session.observer.clientCapabilities(),
+		EchoOff:         session.echoOff,
+		Compressed:      compressed,
+		Gmcp:            connection.IsLocalOptionEnabled(GMCP),
+		EndOfRecord:     connection.IsLocalOptionEnabled(END_OF_RECORD),
+		SuppressGoAhead: connection.IsLocalOptionEnabled(SUPPRESS_GO_AHEAD),
+	}
+	return true
+}
+
+func SaveCopyoverState(state *CopyoverState, path string) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
+
+func LoadCopyoverState(path string) (*CopyoverState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &CopyoverState{}
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, fmt.Errorf("invalid copyover state in %v: %w", path, err)
+	}
+
+	return state, nil
+}
@@ -0,0 +1,36 @@
+package io
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jorgensigvardsson/gomud/mudio"
+)
+
+func Test_SaveCopyoverState_LoadCopyoverState_RoundTrip(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "copyover.json")
+	original := &CopyoverState{
+		ListenerFd: 3,
+		Sessions: []*DetachedSession{
+			{Fd: 7, PlayerName: "Bob", Capabilities: mudio.ClientCapabilities{ClientName: "MUDLET", Ansi: true, Width: 120, Height: 40}, EchoOff: true},
+		},
+	}
+
+	// Act
+	err := SaveCopyoverState(original, path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	state, err := LoadCopyoverState(path)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if state.ListenerFd != 3 || len(state.Sessions) != 1 || *state.Sessions[0] != *original.Sessions[0] {
+		t.Errorf("Unexpected state: %+v", state)
+	}
+}
@@ -0,0 +1,478 @@
+package io
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jorgensigvardsson/gomud/charset"
+	"github.com/jorgensigvardsson/gomud/logging"
+	"github.com/jorgensigvardsson/gomud/mudio"
+	"github.com/jorgensigvardsson/gomud/persistence"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSH, as an encrypted alternative to telnet that players already have a client for. The SSH user name is the name
+// of the character. Players who have added a public key to their account (with the sshkey command) log in with it,
+// and everybody else is let in without SSH authentication, to log in with the password as usual.
+
+// The client name of SSH sessions
+const SSH_CLIENT_NAME = "SSH"
+
+// Set in the permissions of an SSH connection that was authenticated with a public key of the account
+const SSH_PUBLIC_KEY_EXTENSION = "gomud-public-key"
+
+// Clients that haven't completed the SSH handshake by then are disconnected
+const SSH_HANDSHAKE_TIMEOUT = 30 * time.Second
+
+var ErrSshKeyNotAuthorized = errors.New("public key not authorized")
+
+// Creates the configuration of the SSH server. The host key is generated if it doesn't exist. Public keys are
+// looked up in `accounts` from the goroutines of the connections, as the AccountStore contract allows for Load.
+func NewSshServerConfig(hostKeyPath string, accounts persistence.AccountStore, logger logging.Logger) (*ssh.ServerConfig, error) {
+	if !fileExists(hostKeyPath) {
+		logger.Printlnf("Generating SSH host key %v", hostKeyPath)
+
+		err := generateSshHostKey(hostKeyPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := os.ReadFile(hostKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	hostKey, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			account, err := accounts.Load(meta.User())
+			if err != nil || !account.IsAuthorizedKey(key) {
+				return nil, ErrSshKeyNotAuthorized
+			}
+
+			return &ssh.Permissions{Extensions: map[string]string{SSH_PUBLIC_KEY_EXTENSION: ssh.FingerprintSHA256(key)}}, nil
+		},
+		// Clients try this after their public keys. No questions are asked, since the password is asked for in
+		// the game.
+		KeyboardInteractiveCallback: func(meta ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	return config, nil
+}
+
+func generateSshHostKey(path string) error {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	return writePem(path, "PRIVATE KEY", encoded, 0600)
+}
+
+func HandleSshConnections(listener net.Listener, config *ssh.ServerConfig, logger logging.Logger, commandChannel chan<- *PlayerInput, listenerErrorChannel chan<- error, connectionsStopChannel <-chan interface{}, detach *Detacher, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	for {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			listenerErrorChannel <- err
+			return
+		}
+
+		go handleSshConnection(conn, config, logger, commandChannel, connectionsStopChannel, detach, wg)
+	}
+}
+
+// Completes the SSH handshake, and serves the first session channel the client opens
+func handleSshConnection(tcpConnection net.Conn, config *ssh.ServerConfig, logger logging.Logger, commandChannel chan<- *PlayerInput, connectionsStopChannel <-chan interface{}, detach *Detacher, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	tcpConnection.SetDeadline(time.Now().Add(SSH_HANDSHAKE_TIMEOUT))
+	serverConn, channels, requests, err := ssh.NewServerConn(tcpConnection, config)
+	if err != nil {
+		logger.Printlnf("SSH handshake with %v failed: %v", tcpConnection.RemoteAddr(), err)
+		tcpConnection.Close()
+		return
+	}
+	defer serverConn.Close()
+	tcpConnection.SetDeadline(time.Time{})
+
+	go ssh.DiscardRequests(requests)
+
+	for {
+		var newChannel ssh.NewChannel
+		var isOpen bool
+
+		// Nobody is logged in yet, so there's nothing to wait for when the server stops or reboots
+		select {
+		case newChannel, isOpen = <-channels:
+			if !isOpen {
+				return
+			}
+		case <-connectionsStopChannel:
+			return
+		case <-detach.detachChannel:
+			return
+		}
+
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			logger.Printlnf("Failed to accept SSH session of %v: %v", serverConn.User(), err)
+			return
+		}
+
+		// Only one session per connection, so refuse the rest
+		go func() {
+			for newChannel := range channels {
+				newChannel.Reject(ssh.Prohibited, "only one session per connection")
+			}
+		}()
+
+		serveSshSession(tcpConnection, serverConn, channel, channelRequests, logger, commandChannel, connectionsStopChannel, detach)
+		return
+	}
+}
+
+func serveSshSession(tcpConnection net.Conn, serverConn *ssh.ServerConn, channel ssh.Channel, requests <-chan *ssh.Request, logger logging.Logger, commandChannel chan<- *PlayerInput, connectionsStopChannel <-chan interface{}, detach *Detacher) {
+	session := newConnectionSession(logger, true)
+	connection := newSshConnection(serverConn, channel)
+
+	session.observer.updateCapabilities(func(capabilities *mudio.ClientCapabilities) {
+		capabilities.ClientName = SSH_CLIENT_NAME
+		capabilities.Utf8 = true
+	})
+
+	// The client asks for a terminal, and then for a shell, before the game starts. Window size changes come
+	// later, while the game is going on.
+	shellStarted := make(chan bool, 1)
+	go func() {
+		for request := range requests {
+			ok := connection.requestReceived(request, session.observer)
+			if request.Type == "shell" {
+				signalShell(shellStarted, ok)
+			}
+
+			if request.WantReply {
+				request.Reply(ok, nil)
+			}
+		}
+
+		// The client closed the session without starting a shell
+		signalShell(shellStarted, false)
+	}()
+
+	select {
+	case ok := <-shellStarted:
+		if !ok {
+			connection.Close()
+			return
+		}
+	case <-connectionsStopChannel:
+		connection.Close()
+		return
+	case <-detach.detachChannel:
+		connection.Close()
+		return
+	}
+
+	authenticated := false
+	if serverConn.Permissions != nil {
+		_, authenticated = serverConn.Permissions.Extensions[SSH_PUBLIC_KEY_EXTENSION]
+	}
+
+	loginCmd := mudio.NewCommandLoginAs(serverConn.User(), authenticated)
+	serveConnection(tcpConnection, connection, session, loginCmd, logger, commandChannel, connectionsStopChannel, detach)
+}
+
+func signalShell(shellStarted chan<- bool, ok bool) {
+	select {
+	case shellStarted <- ok:
+	default:
+	}
+}
+
+// An SSH session channel, adapted to the TelnetConnection interface. When the client has asked for a terminal
+// (a PTY), the terminal sends every key as it is typed, so we echo it and handle line editing ourselves.
+type implSshConnection struct {
+	serverConn *ssh.ServerConn
+	channel    ssh.Channel
+	reader     io.Reader
+	lock       sync.Mutex // Protects writes, and the state below
+	pty        bool
+	echoOff    bool
+	lineLength int  // The number of characters echoed on the current line, which backspace may erase
+	lastCr     bool // The last byte was a CR, so that a LF right after it is not another line
+	closed     bool
+}
+
+func newSshConnection(serverConn *ssh.ServerConn, channel ssh.Channel) *implSshConnection {
+	return &implSshConnection{
+		serverConn: serverConn,
+		channel:    channel,
+		reader:     channel,
+	}
+}
+
+// Handles a request on the session channel, and tells if it was accepted
+func (sshconn *implSshConnection) requestReceived(request *ssh.Request, observer *playerTelnetConnectionObserver) bool {
+	switch request.Type {
+	case "pty-req":
+		terminalType, width, height, ok := parsePtyRequest(request.Payload)
+		if !ok {
+			return false
+		}
+
+		sshconn.lock.Lock()
+		sshconn.pty = true
+		sshconn.lock.Unlock()
+
+		observer.updateCapabilities(func(capabilities *mudio.ClientCapabilities) {
+			applyTerminalType(capabilities, terminalType, 1)
+		})
+		observer.setWindowSize(width, height)
+		return true
+	case "window-change":
+		width, height, ok := parseWindowChange(request.Payload)
+		if ok {
+			observer.setWindowSize(width, height)
+		}
+		return ok
+	case "shell", "env":
+		return true
+	default:
+		// No exec or subsystems, this is a game
+		return false
+	}
+}
+
+// Parses the payload of a "pty-req" request: TERM, width and height in characters, width and height in pixels,
+// and the terminal modes
+func parsePtyRequest(payload []byte) (terminalType string, width int, height int, ok bool) {
+	if len(payload) < 4 {
+		return "", 0, 0, false
+	}
+
+	length := binary.BigEndian.Uint32(payload)
+	if uint64(len(payload)) < 4+uint64(length)+8 {
+		return "", 0, 0, false
+	}
+
+	terminalType = string(payload[4 : 4+length])
+	width, height, ok = parseWindowChange(payload[4+length:])
+	return terminalType, width, height, ok
+}
+
+// Parses the payload of a "window-change" request, which starts with the width and height in characters
+func parseWindowChange(payload []byte) (width int, height int, ok bool) {
+	if len(payload) < 8 {
+		return 0, 0, false
+	}
+
+	return int(binary.BigEndian.Uint32(payload)), int(binary.BigEndian.Uint32(payload[4:])), true
+}
+
+func (sshconn *implSshConnection) ReadLine() (line string, err error) {
+	return readEditedLine(sshconn.readByte, func() charset.Charset { return charset.UTF8 })
+}
+
+func (sshconn *implSshConnection) readByte() (byte, error) {
+	var buf [1]byte
+
+	for {
+		if _, err := io.ReadFull(sshconn.reader, buf[:]); err != nil {
+			return 0, err
+		}
+
+		b := buf[0]
+
+		sshconn.lock.Lock()
+		lastCr := sshconn.lastCr
+		sshconn.lastCr = b == '\r'
+		sshconn.lock.Unlock()
+
+		switch {
+		case b == '\n' && lastCr:
+			continue // The end of the line was already seen
+		case b == '\r':
+			b = '\n' // Terminals send CR for the enter key
+		}
+
+		return b, sshconn.echo(b)
+	}
+}
+
+// Echoes what the player types, when the terminal leaves it to us
+func (sshconn *implSshConnection) echo(b byte) error {
+	sshconn.lock.Lock()
+	defer sshconn.lock.Unlock()
+
+	if !sshconn.pty {
+		return nil
+	}
+
+	var echo []byte
+	switch {
+	case b == '\n':
+		echo = []byte("\r\n")
+		sshconn.lineLength = 0
+	case b == CTRL_C:
+		echo = []byte("^C\r\n")
+		sshconn.lineLength = 0
+	case b == BACKSPACE || b == DELETE:
+		if sshconn.lineLength > 0 {
+			echo = []byte("\b \b")
+			sshconn.lineLength--
+		}
+	case b == CTRL_U:
+		echo = []byte(strings.Repeat("\b \b", sshconn.lineLength))
+		sshconn.lineLength = 0
+	case b < ' ':
+		// Not stored, so not echoed
+	case b&0xc0 == 0x80:
+		// A continuation byte of a UTF-8 character, which was counted by its first byte
+		echo = []byte{b}
+	default:
+		echo = []byte{b}
+		sshconn.lineLength++
+	}
+
+	if sshconn.echoOff {
+		// Passwords are not shown, but the end of the line is
+		if b != '\n' && b != CTRL_C {
+			return nil
+		}
+	}
+
+	if len(echo) == 0 {
+		return nil
+	}
+
+	_, err := sshconn.channel.Write(echo)
+	return err
+}
+
+func (sshconn *implSshConnection) WriteLine(line string) error {
+	return sshconn.WriteString(line + "\n")
+}
+
+func (sshconn *implSshConnection) WriteLinef(line string, args ...interface{}) error {
+	if len(args) == 0 {
+		return sshconn.WriteLine(line)
+	}
+
+	return sshconn.WriteLine(fmt.Sprintf(line, args...))
+}
+
+// Writes text, with new lines sent as CR LF, since the terminal of the client is in raw mode
+func (sshconn *implSshConnection) WriteString(text string) error {
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n")
+
+	sshconn.lock.Lock()
+	defer sshconn.lock.Unlock()
+
+	if sshconn.closed {
+		return net.ErrClosed
+	}
+
+	// Output ends up after the line being typed, so backspace can't erase beyond it
+	sshconn.lineLength = 0
+
+	_, err := sshconn.channel.Write([]byte(text))
+	return err
+}
+
+func (sshconn *implSshConnection) WriteStringf(text string, args ...interface{}) error {
+	if len(args) == 0 {
+		return sshconn.WriteString(text)
+	}
+
+	return sshconn.WriteString(fmt.Sprintf(text, args...))
+}
+
+func (sshconn *implSshConnection) EchoOff() error {
+	sshconn.lock.Lock()
+	defer sshconn.lock.Unlock()
+
+	sshconn.echoOff = true
+	return nil
+}
+
+func (sshconn *implSshConnection) EchoOn() error {
+	sshconn.lock.Lock()
+	defer sshconn.lock.Unlock()
+
+	sshconn.echoOff = false
+	return nil
+}
+
+func (sshconn *implSshConnection) Close() error {
+	sshconn.lock.Lock()
+	defer sshconn.lock.Unlock()
+
+	if sshconn.closed {
+		return nil
+	}
+	sshconn.closed = true
+
+	// Let the client exit cleanly, with exit status 0
+	sshconn.channel.SendRequest("exit-status", false, []byte{0, 0, 0, 0})
+	sshconn.channel.Close()
+	return sshconn.serverConn.Close()
+}
+
+// The client told us about its terminal in the PTY request, and everything else is known up front, so there is
+// nothing to negotiate
+func (sshconn *implSshConnection) QueryTerminal() error    { return nil }
+func (sshconn *implSshConnection) QueryWindowSize() error  { return nil }
+func (sshconn *implSshConnection) OfferCompression() error { return nil }
+func (sshconn *implSshConnection) OfferGmcp() error        { return nil }
+func (sshconn *implSshConnection) OfferMssp() error        { return nil }
+func (sshconn *implSshConnection) OfferCharset() error     { return nil }
+func (sshconn *implSshConnection) OfferEndOfRecord() error { return nil }
+
+// Terminals have no way to be told where a prompt ends
+func (sshconn *implSshConnection) MarkPrompt() error { return nil }
+
+func (sshconn *implSshConnection) WriteSubnegotiation(option byte, payload []byte) error { return nil }
+
+func (sshconn *implSshConnection) IsLocalOptionEnabled(option byte) bool {
+	sshconn.lock.Lock()
+	defer sshconn.lock.Unlock()
+
+	return option == ECHO && sshconn.echoOff
+}
+
+func (sshconn *implSshConnection) IsRemoteOptionEnabled(option byte) bool {
+	return false
+}
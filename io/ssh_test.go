@@ -0,0 +1,276 @@
+package io
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jorgensigvardsson/gomud/logging"
+	"github.com/jorgensigvardsson/gomud/persistence"
+	"golang.org/x/crypto/ssh"
+)
+
+// A session channel that reads from a buffer, and records what is written to it
+type fakeSshChannel struct {
+	ssh.Channel
+	input   *bytes.Reader
+	written bytes.Buffer
+}
+
+func (channel *fakeSshChannel) Read(b []byte) (int, error) {
+	return channel.input.Read(b)
+}
+
+func (channel *fakeSshChannel) Write(b []byte) (int, error) {
+	return channel.written.Write(b)
+}
+
+func newTestSshConnection(input string, pty bool) (*implSshConnection, *fakeSshChannel) {
+	channel := &fakeSshChannel{input: bytes.NewReader([]byte(input))}
+	sshconn := newSshConnection(nil, channel)
+	sshconn.pty = pty
+	return sshconn, channel
+}
+
+func Test_parsePtyRequest(t *testing.T) {
+	payload := []byte{0, 0, 0, 5}
+	payload = append(payload, "xterm"...)
+	payload = append(payload, 0, 0, 0, 100, 0, 0, 0, 30, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+
+	terminalType, width, height, ok := parsePtyRequest(payload)
+
+	if !ok || terminalType != "xterm" || width != 100 || height != 30 {
+		t.Errorf("Unexpected terminal %q, size %vx%v (%v)", terminalType, width, height, ok)
+	}
+
+	if _, _, _, ok := parsePtyRequest(payload[:12]); ok {
+		t.Error("Expected a truncated request to be invalid")
+	}
+}
+
+func Test_SshConnection_ReadLine_CrEndsLineAndEdits(t *testing.T) {
+	sshconn, channel := newTestSshConnection("lookk\x7f\r\nsay hi\r", true)
+
+	first, err1 := sshconn.ReadLine()
+	second, err2 := sshconn.ReadLine()
+
+	if first != "look" || second != "say hi" || err1 != nil || err2 != nil {
+		t.Errorf("Unexpected lines %q (%v) and %q (%v)", first, err1, second, err2)
+	}
+
+	if channel.written.String() != "lookk\b \b\r\nsay hi\r\n" {
+		t.Errorf("Unexpected echo %q", channel.written.String())
+	}
+}
+
+func Test_SshConnection_ReadLine_Utf8_ErasedAsOneCharacter(t *testing.T) {
+	sshconn, channel := newTestSshConnection("så\x7f\x7f\x7fa\r", true)
+
+	line, _ := sshconn.ReadLine()
+
+	if line != "a" {
+		t.Errorf("Unexpected line %q", line)
+	}
+
+	if channel.written.String() != "så\b \b\b \ba\r\n" {
+		t.Errorf("Unexpected echo %q", channel.written.String())
+	}
+}
+
+func Test_SshConnection_EchoOff_OnlyEndOfLineEchoed(t *testing.T) {
+	sshconn, channel := newTestSshConnection("secret\r", true)
+
+	sshconn.EchoOff()
+	line, _ := sshconn.ReadLine()
+
+	if line != "secret" || channel.written.String() != "\r\n" {
+		t.Errorf("Unexpected line %q and echo %q", line, channel.written.String())
+	}
+
+	if !sshconn.IsLocalOptionEnabled(ECHO) {
+		t.Error("Expected echo to be on our side")
+	}
+}
+
+func Test_SshConnection_NoPty_NothingEchoed(t *testing.T) {
+	sshconn, channel := newTestSshConnection("look\n", false)
+
+	line, _ := sshconn.ReadLine()
+
+	if line != "look" || channel.written.Len() != 0 {
+		t.Errorf("Unexpected line %q and echo %q", line, channel.written.String())
+	}
+}
+
+func Test_SshConnection_WriteLine_CrLf(t *testing.T) {
+	sshconn, channel := newTestSshConnection("", true)
+
+	sshconn.WriteLine("Hello\nWorld")
+
+	if channel.written.String() != "Hello\r\nWorld\r\n" {
+		t.Errorf("Unexpected output %q", channel.written.String())
+	}
+}
+
+func Test_SshConnection_WindowChange_ToldAsWindowSize(t *testing.T) {
+	sshconn, _ := newTestSshConnection("", true)
+	observer := newPlayerTelnetConnectionObserver(nil, logging.NewNullLogger())
+	payload := make([]byte, 16)
+	binary.BigEndian.PutUint32(payload, 132)
+	binary.BigEndian.PutUint32(payload[4:], 43)
+
+	ok := sshconn.requestReceived(&ssh.Request{Type: "window-change", Payload: payload}, observer)
+
+	if width, height := observer.windowSize(); !ok || width != 132 || height != 43 {
+		t.Errorf("Unexpected window size %vx%v (%v)", width, height, ok)
+	}
+}
+
+// Authenticates a client with `signer` against a server for the accounts in `store`, and returns the permissions
+// the server gave the client
+func sshHandshake(t *testing.T, store persistence.AccountStore, user string, signer ssh.Signer) *ssh.Permissions {
+	config, err := NewSshServerConfig(filepath.Join(t.TempDir(), "host_key"), store, logging.NewNullLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Both sides write their version first, which an unbuffered net.Pipe can't take
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer listener.Close()
+
+	permissions := make(chan *ssh.Permissions, 1)
+	go func() {
+		serverSide, err := listener.Accept()
+		if err != nil {
+			permissions <- nil
+			return
+		}
+		defer serverSide.Close()
+
+		serverConn, _, _, err := ssh.NewServerConn(serverSide, config)
+		if err != nil {
+			permissions <- nil
+			return
+		}
+		permissions <- serverConn.Permissions
+	}()
+
+	clientSide, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer clientSide.Close()
+
+	clientConfig := &ssh.ClientConfig{
+		User: user,
+		Auth: []ssh.AuthMethod{
+			ssh.PublicKeys(signer),
+			ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				return nil, nil
+			}),
+		},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+
+	_, _, _, err = ssh.NewClientConn(clientSide, "gomud", clientConfig)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return <-permissions
+}
+
+func Test_NewSshServerConfig_AuthorizedKey_LoggedInWithKey(t *testing.T) {
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := ssh.NewSignerFromKey(privateKey)
+	store, _ := persistence.NewFileAccountStore(t.TempDir())
+	account := &persistence.Account{Name: "Bob"}
+	account.AddAuthorizedKey(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	store.Save(account)
+
+	permissions := sshHandshake(t, store, "bob", signer)
+
+	if permissions == nil || permissions.Extensions[SSH_PUBLIC_KEY_EXTENSION] == "" {
+		t.Errorf("Expected the connection to be authenticated with the key, but got %+v", permissions)
+	}
+}
+
+func Test_NewSshServerConfig_UnknownKey_LetInWithoutKey(t *testing.T) {
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := ssh.NewSignerFromKey(privateKey)
+	store, _ := persistence.NewFileAccountStore(t.TempDir())
+	store.Save(&persistence.Account{Name: "Bob"})
+
+	permissions := sshHandshake(t, store, "bob", signer)
+
+	if permissions != nil && permissions.Extensions[SSH_PUBLIC_KEY_EXTENSION] != "" {
+		t.Errorf("Expected the connection not to be authenticated with a key, but got %+v", permissions)
+	}
+}
+
+func Test_HandleSshConnection_NoShellYet_ReturnsWhenStopped(t *testing.T) {
+	// Arrange
+	store, _ := persistence.NewFileAccountStore(t.TempDir())
+	config, err := NewSshServerConfig(filepath.Join(t.TempDir(), "host_key"), store, logging.NewNullLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer listener.Close()
+
+	stopChannel := make(chan interface{})
+	var wg sync.WaitGroup
+	done := make(chan interface{})
+	go func() {
+		serverSide, err := listener.Accept()
+		if err == nil {
+			handleSshConnection(serverSide, config, logging.NewNullLogger(), nil, stopChannel, NewDetacher(1), &wg)
+		}
+		close(done)
+	}()
+
+	clientSide, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer clientSide.Close()
+
+	clientConfig := &ssh.ClientConfig{
+		User:            "bob",
+		Auth:            []ssh.AuthMethod{ssh.KeyboardInteractive(func(string, string, []string, []bool) ([]string, error) { return nil, nil })},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+
+	clientConn, _, _, err := ssh.NewClientConn(clientSide, "gomud", clientConfig)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, _, err = clientConn.OpenChannel("session", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	close(stopChannel)
+
+	// Assert
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("The connection was still waiting for a shell after the server stopped")
+	}
+}
@@ -2,15 +2,24 @@ package io
 
 import (
 	"bufio"
+	"compress/zlib"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/jorgensigvardsson/gomud/charset"
 	"github.com/jorgensigvardsson/gomud/logging"
 )
 
 const (
 	// Telnet commands - see telnet protocol
-	FIRST_COMMAND = 240
+	FIRST_COMMAND = 239
+	EOR           = 239 // End of record, marks the end of a prompt
 	SE            = 240
 	NOP           = 241
 	DATA_MARK     = 242
@@ -50,26 +59,90 @@ const (
 	NAOLFD              = 16 // Output Linefeed disposition
 	EXTEND_ASCII        = 17
 	TERMINAL_TYPE       = 24
+	END_OF_RECORD       = 25 // RFC 885
 	NAWS                = 31 // Negotiate about window size
 	TERMINAL_SPEED      = 32
 	TOGGLE_FLOW_CONTROL = 33
 	LINE_MODE           = 34
+	CHARSET             = 42 // RFC 2066
 	AUTH                = 37
+	MSSP                = 70  // MUD Server Status Protocol
+	COMPRESS2           = 86  // MUD Client Compression Protocol v2 (MCCP2)
+	MXP                 = 91  // MUD eXtension Protocol
+	GMCP                = 201 // Generic MUD Communication Protocol
+
+	// Terminal type subnegotiation commands
+	TTYPE_IS   = 0
+	TTYPE_SEND = 1
+
+	// Charset subnegotiation commands
+	CHARSET_REQUEST  = 1
+	CHARSET_ACCEPTED = 2
+	CHARSET_REJECTED = 3
+	TTABLE_IS        = 4
+	TTABLE_REJECTED  = 5
+
+	// Control characters used for line editing
+	CTRL_C    = 0x03 // Interrupt, what IAC IP and IAC BREAK are read as
+	BACKSPACE = 0x08 // Erase the last character, what IAC EC is read as
+	TAB       = 0x09
+	CTRL_U    = 0x15 // Erase the line, what IAC EL is read as
+	DELETE    = 0x7f // Sent instead of backspace by many terminals
 )
 
+// Longest input line kept (in bytes); longer ones are thrown away
+const MAX_LINE_LENGTH = 1024
+
+// The player interrupted the line (IAC IP, IAC BREAK or Ctrl-C)
+var ErrInterrupted = errors.New("line interrupted")
+
+// The line was longer than MAX_LINE_LENGTH, and was thrown away
+var ErrLineTooLong = errors.New("line too long")
+
+// The character sets we offer, most preferred first
+var offeredCharsets = []charset.Charset{charset.UTF8, charset.Latin1, charset.ASCII}
+
 type TelnetConnectionObserver interface {
 	// TODO: Extend this interface
 	CommandReceived(command []byte)
 	InvalidCommand(data []byte)
+	SubnegotiationReceived(subnegotiation Subnegotiation)
+	// The character set of the connection was changed by a CHARSET negotiation
+	CharsetChanged(newCharset charset.Charset)
+	// An option was enabled or disabled, on our side (`local`), or on the other end
+	OptionChanged(option byte, local bool, enabled bool)
 }
 
 const (
 	STATE_NOTHING        = 0
 	STATE_IAC            = 1
 	STATE_OPTION_COMMAND = 2
-	STATE_SUBNEG         = 3
+	STATE_SUBNEG_OPTION  = 3 // After IAC SB, waiting for the option
+	STATE_SUBNEG         = 4 // Reading the payload of a subnegotiation
+	STATE_SUBNEG_IAC     = 5 // Got IAC inside a subnegotiation payload
 )
 
+// Longest subnegotiation payload kept (in bytes); longer ones are thrown away
+const MAX_SUBNEGOTIATION_PAYLOAD = 8192
+
+// An IAC SB <option> <payload> IAC SE sequence
+type Subnegotiation struct {
+	Option  byte
+	Payload []byte // With escaped IACs (IAC IAC) unescaped
+}
+
+// Parses the payload of a NAWS subnegotiation: the width and height of the window, 16 bits each. 0 means that
+// the other end doesn't know.
+func parseWindowSize(payload []byte) (width int, height int, ok bool) {
+	if len(payload) != 4 {
+		return 0, 0, false
+	}
+
+	width = int(payload[0])<<8 | int(payload[1])
+	height = int(payload[2])<<8 | int(payload[3])
+	return width, height, true
+}
+
 type TelnetConnection interface {
 	ReadLine() (line string, err error)
 	WriteLine(line string) error
@@ -80,16 +153,34 @@ type TelnetConnection interface {
 	EchoOn() error
 	Close() error
 	QueryTerminal() error
+	QueryWindowSize() error
+	OfferCompression() error
+	OfferGmcp() error
+	OfferMssp() error
+	OfferCharset() error
+	OfferEndOfRecord() error
+	MarkPrompt() error
+	WriteSubnegotiation(option byte, payload []byte) error
+	IsLocalOptionEnabled(option byte) bool
+	IsRemoteOptionEnabled(option byte) bool
 }
 
-// The telnet connection is INHERENTLY unsafe for concurrent use!
+// Reading from a telnet connection is unsafe for concurrent use, but writing to it is safe, even while reading,
+// since reading answers option negotiations.
 type implTelnetConnection struct {
-	connection      net.Conn
-	reader          *bufio.Reader
-	writer          *bufio.Writer
-	observer        TelnetConnectionObserver
-	logger          logging.Logger
-	lastWrittenRune rune // This is used by write, and forces the telnet connection to be unsafe for concurrent use! (but who would use it concurrently anyway!?)
+	connection        net.Conn
+	reader            *bufio.Reader
+	writer            *bufio.Writer
+	observer          TelnetConnectionObserver
+	logger            logging.Logger
+	lastWrittenRune   rune       // This is used by write
+	lock              sync.Mutex // Protects the writer, the compressor and the options
+	options           [256]optionNegotiation
+	rawWriter         io.Writer    // What the writer writes to when output is not compressed
+	compressor        *zlib.Writer // What the writer writes to when output is compressed (MCCP2), otherwise nil
+	terminalTypes     []string     // The different terminal types the other end has answered with, so far
+	charset           charset.Charset
+	charsetNegotiated bool // The character set was agreed on by a CHARSET negotiation, rather than guessed
 }
 
 func NewTelnetConnection(connection net.Conn, observer TelnetConnectionObserver, logger logging.Logger) TelnetConnection {
@@ -97,6 +188,7 @@ func NewTelnetConnection(connection net.Conn, observer TelnetConnectionObserver,
 		connection:      connection,
 		reader:          bufio.NewReader(connection),
 		writer:          bufio.NewWriter(connection),
+		rawWriter:       connection,
 		observer:        observer,
 		logger:          logger,
 		lastWrittenRune: '\x00',
@@ -106,6 +198,15 @@ func NewTelnetConnection(connection net.Conn, observer TelnetConnectionObserver,
 func (tconn *implTelnetConnection) readByte() (b byte, err error) {
 	state := STATE_NOTHING
 	buf := make([]byte, 0, 3)
+	var subnegotiation Subnegotiation
+	overflow := false // Set if the payload of the current subnegotiation is too long
+	appendPayload := func(b byte) {
+		if len(subnegotiation.Payload) < MAX_SUBNEGOTIATION_PAYLOAD {
+			subnegotiation.Payload = append(subnegotiation.Payload, b)
+		} else {
+			overflow = true
+		}
+	}
 
 	for {
 		b, err := tconn.reader.ReadByte()
@@ -127,8 +228,14 @@ func (tconn *implTelnetConnection) readByte() (b byte, err error) {
 			case b == IAC:
 				return b, nil // IAC + IAC -> IAC! An escaped IAC code
 			case b == SB:
-				state = STATE_SUBNEG
+				state = STATE_SUBNEG_OPTION
 				buf = append(buf, b)
+			case b == EC:
+				return BACKSPACE, nil // Line editing commands are read as the control characters terminals send
+			case b == EL:
+				return CTRL_U, nil
+			case b == IP || b == BREAK:
+				return CTRL_C, nil
 			case b >= FIRST_COMMAND && b <= LAST_COMMAND:
 				state = STATE_NOTHING
 				// Let observer know we have a command!
@@ -144,60 +251,242 @@ func (tconn *implTelnetConnection) readByte() (b byte, err error) {
 				state = STATE_NOTHING
 			}
 		case STATE_OPTION_COMMAND:
-			// Option command is IAC <command> <option> <value>, and b = <value>
+			// Option command is IAC <command> <option>, and b = <option>
+			tconn.receiveOptionCommand(buf[1], b)
 			tconn.observer.CommandReceived(append(buf, b))
 			buf = buf[:0]
 			state = STATE_NOTHING
+		case STATE_SUBNEG_OPTION:
+			subnegotiation = Subnegotiation{Option: b}
+			overflow = false
+			state = STATE_SUBNEG
 		case STATE_SUBNEG:
-			// Swallow everything until we reach SE (this is probably wrong, we
-			// should most likely look for IAC SE really... this may be a source of bugs!)
+			if b == IAC {
+				state = STATE_SUBNEG_IAC
+			} else {
+				appendPayload(b)
+			}
+		case STATE_SUBNEG_IAC:
 			switch b {
+			case IAC:
+				// Escaped IAC, part of the payload
+				appendPayload(b)
+				state = STATE_SUBNEG
 			case SE:
-				tconn.observer.CommandReceived(append(buf, b))
+				if overflow {
+					tconn.observer.InvalidCommand([]byte{IAC, SB, subnegotiation.Option})
+				} else {
+					tconn.subnegotiationReceived(subnegotiation)
+				}
+				buf = buf[:0]
 				state = STATE_NOTHING
 			default:
-				buf = append(buf, b)
+				// Only IAC IAC and IAC SE are allowed inside a subnegotiation, so the subnegotiation is broken
+				tconn.observer.InvalidCommand(append([]byte{IAC, SB, subnegotiation.Option}, IAC, b))
+				buf = buf[:0]
+				state = STATE_NOTHING
 			}
 		}
 	}
 }
 
+func (tconn *implTelnetConnection) subnegotiationReceived(subnegotiation Subnegotiation) {
+	if subnegotiation.Option == TERMINAL_TYPE && len(subnegotiation.Payload) > 0 && subnegotiation.Payload[0] == TTYPE_IS {
+		terminalType := string(subnegotiation.Payload[1:])
+		tconn.cycleTerminalType(terminalType)
+
+		if bits, ok := parseMtts(terminalType); ok {
+			tconn.mttsReceived(bits)
+		}
+	}
+
+	if subnegotiation.Option == CHARSET && len(subnegotiation.Payload) > 0 {
+		tconn.charsetSubnegotiationReceived(subnegotiation.Payload[0], subnegotiation.Payload[1:])
+	}
+
+	tconn.observer.SubnegotiationReceived(subnegotiation)
+}
+
+// Asks for the next terminal type, until the other end repeats itself (see terminal.go)
+func (tconn *implTelnetConnection) cycleTerminalType(terminalType string) {
+	n := len(tconn.terminalTypes)
+	if n > 0 && tconn.terminalTypes[n-1] == terminalType {
+		return
+	}
+
+	tconn.terminalTypes = append(tconn.terminalTypes, terminalType)
+	if len(tconn.terminalTypes) >= MAX_TERMINAL_TYPES {
+		return
+	}
+
+	tconn.lock.Lock()
+	defer tconn.lock.Unlock()
+
+	tconn.writeCommandNoLock(IAC, SB, TERMINAL_TYPE, TTYPE_SEND, IAC, SE)
+}
+
+// Handles the other end's part of a CHARSET negotiation
+func (tconn *implTelnetConnection) charsetSubnegotiationReceived(command byte, data []byte) {
+	switch command {
+	case CHARSET_ACCEPTED:
+		if accepted, found := charset.Parse(string(data)); found {
+			tconn.setCharset(accepted)
+		}
+	case CHARSET_REJECTED:
+		// None of our character sets will do, so play it safe
+		tconn.setCharset(charset.ASCII)
+	case CHARSET_REQUEST:
+		// The other end offers character sets: ";UTF-8;ISO-8859-1", with the separator first
+		if strings.HasPrefix(string(data), "[TTABLE]") && len(data) > len("[TTABLE]") {
+			data = data[len("[TTABLE]")+1:] // Skip the version, we don't do translation tables
+		}
+
+		if len(data) > 1 {
+			for _, name := range strings.Split(string(data[1:]), string(data[0])) {
+				if requested, found := charset.Parse(name); found {
+					tconn.WriteSubnegotiation(CHARSET, append([]byte{CHARSET_ACCEPTED}, name...))
+					tconn.setCharset(requested)
+					return
+				}
+			}
+		}
+
+		tconn.WriteSubnegotiation(CHARSET, []byte{CHARSET_REJECTED})
+	case TTABLE_IS:
+		tconn.WriteSubnegotiation(CHARSET, []byte{TTABLE_REJECTED})
+	}
+}
+
+func (tconn *implTelnetConnection) setCharset(newCharset charset.Charset) {
+	tconn.lock.Lock()
+	tconn.charset = newCharset
+	tconn.charsetNegotiated = true
+	tconn.lock.Unlock()
+
+	tconn.observer.CharsetChanged(newCharset)
+}
+
+// A client that tells by MTTS that it can't do UTF-8 gets ASCII, unless a character set has been agreed on
+func (tconn *implTelnetConnection) mttsReceived(bits int) {
+	if bits&MTTS_UTF8 != 0 {
+		return
+	}
+
+	tconn.lock.Lock()
+	if tconn.charsetNegotiated || tconn.charset == charset.ASCII {
+		tconn.lock.Unlock()
+		return
+	}
+	tconn.charset = charset.ASCII
+	tconn.lock.Unlock()
+
+	tconn.observer.CharsetChanged(charset.ASCII)
+}
+
+func (tconn *implTelnetConnection) currentCharset() charset.Charset {
+	tconn.lock.Lock()
+	defer tconn.lock.Unlock()
+
+	return tconn.charset
+}
+
+// Writes a rune in the character set of the connection. The lock must be held by the caller.
 func (tconn *implTelnetConnection) writeRune(r rune) error {
 	if r == '\n' && tconn.lastWrittenRune != '\r' {
 		// Inject a CR if it hasn't already been written
-		tconn.writer.WriteRune('\r')
+		tconn.writer.WriteByte('\r')
+	}
+
+	var encoded [8]byte
+	for _, b := range tconn.charset.AppendRune(encoded[:0], r) {
+		if b == IAC {
+			// Only Latin-1 has IAC (ÿ) in it, and it must be escaped
+			tconn.writer.WriteByte(IAC)
+		}
+
+		if err := tconn.writer.WriteByte(b); err != nil {
+			return err
+		}
 	}
 
-	_, err := tconn.writer.WriteRune(r)
 	tconn.lastWrittenRune = r
-	return err
+	return nil
 }
 
 /* net.Conn, io.Reader and io.Writer implementations for TelnetConnection */
 func (tconn *implTelnetConnection) ReadLine() (line string, err error) {
+	return readEditedLine(tconn.readByte, tconn.currentCharset)
+}
+
+// Reads a line a byte at a time, applying the line editing the client has left to us: backspace (and DEL) erases
+// the last character, Ctrl-U erases the whole line, and Ctrl-C interrupts it (ErrInterrupted). Other control
+// characters are stripped, and lines longer than MAX_LINE_LENGTH are thrown away (ErrLineTooLong).
+func readEditedLine(readByte func() (byte, error), currentCharset func() charset.Charset) (string, error) {
 	buf := make([]byte, 0, 50)
-	done := false
+	tooLong := false
 
-	for !done {
-		b, err := tconn.readByte()
+	for {
+		b, err := readByte()
 
 		if err != nil {
-			return string(buf), err // TODO: Do we need proper UTF-8 parsing?
+			return decodeLine(buf, currentCharset()), err
 		}
 
-		if b != '\r' && b != '\n' {
+		switch {
+		case b == '\n':
+			if tooLong {
+				return "", ErrLineTooLong
+			}
+			return decodeLine(buf, currentCharset()), nil
+		case b == CTRL_C:
+			return "", ErrInterrupted
+		case tooLong:
+			// Throw away the rest of the line
+		case b == BACKSPACE || b == DELETE:
+			buf = eraseLastCharacter(buf, currentCharset())
+		case b == CTRL_U:
+			buf = buf[:0]
+		case b == TAB:
+			buf = append(buf, ' ')
+		case b < ' ':
+			// Don't store \r, or any other control character
+		case len(buf) >= MAX_LINE_LENGTH:
+			tooLong = true
+		default:
 			buf = append(buf, b)
-		} else if b == '\r' {
-			continue // Don't store \r in string
-		} else {
-			done = true // Must be \n, so we're done!
 		}
 	}
+}
 
-	return string(buf), nil // buffer is assumed to be UTF-8! (Bad codes are converted into the � rune)
+// Removes the last character from a line buffer, which in UTF-8 may be more than one byte
+func eraseLastCharacter(buf []byte, cs charset.Charset) []byte {
+	if len(buf) == 0 {
+		return buf
+	}
+
+	if cs != charset.UTF8 {
+		return buf[:len(buf)-1]
+	}
+
+	_, size := utf8.DecodeLastRune(buf)
+	return buf[:len(buf)-size]
+}
+
+// Decodes a line, and strips the control characters that are left (such as C1 controls in Latin-1)
+func decodeLine(buf []byte, cs charset.Charset) string {
+	// Bad UTF-8 codes are converted into the � rune
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, cs.Decode(buf))
 }
 
 func (tconn *implTelnetConnection) WriteLine(line string) error {
+	tconn.lock.Lock()
+	defer tconn.lock.Unlock()
+
 	err := tconn.writeStringNoFlush(line)
 	if err != nil {
 		return err
@@ -213,7 +502,7 @@ func (tconn *implTelnetConnection) WriteLine(line string) error {
 		return err
 	}
 
-	return tconn.writer.Flush()
+	return tconn.flushNoLock()
 }
 
 func (tconn *implTelnetConnection) WriteLinef(line string, args ...interface{}) error {
@@ -236,12 +525,15 @@ func (tconn *implTelnetConnection) writeStringNoFlush(text string) error {
 }
 
 func (tconn *implTelnetConnection) WriteString(text string) error {
+	tconn.lock.Lock()
+	defer tconn.lock.Unlock()
+
 	err := tconn.writeStringNoFlush(text)
 	if err != nil {
 		return err
 	}
 
-	return tconn.writer.Flush()
+	return tconn.flushNoLock()
 }
 
 func (tconn *implTelnetConnection) WriteStringf(text string, args ...interface{}) error {
@@ -252,7 +544,21 @@ func (tconn *implTelnetConnection) WriteStringf(text string, args ...interface{}
 	return tconn.WriteString(fmt.Sprintf(text, args...))
 }
 
+// Flushes the writer, and the compressor, so that everything written reaches the other end. The lock must be held
+// by the caller.
+func (tconn *implTelnetConnection) flushNoLock() error {
+	err := tconn.writer.Flush()
+	if err == nil && tconn.compressor != nil {
+		err = tconn.compressor.Flush()
+	}
+	return err
+}
+
 func (tconn *implTelnetConnection) Close() error {
+	tconn.lock.Lock()
+	tconn.endCompressionNoLock() // The client must see the end of the compressed stream
+	tconn.lock.Unlock()
+
 	return tconn.connection.Close()
 }
 
@@ -265,34 +571,252 @@ func (tconn *implTelnetConnection) RemoteAddr() net.Addr {
 }
 
 func (tconn *implTelnetConnection) EchoOn() error {
-	_, err := tconn.writer.Write([]byte{IAC, WONT, ECHO, 0})
-	if err == nil {
-		err = tconn.writer.Flush()
-	}
-	return err
+	return tconn.requestLocalOption(ECHO, false)
 }
 
 func (tconn *implTelnetConnection) EchoOff() error {
-	_, err := tconn.writer.Write([]byte{IAC, WILL, ECHO, 0})
-	if err == nil {
-		err = tconn.writer.Flush()
-	}
-	return err
+	return tconn.requestLocalOption(ECHO, true)
 }
 
+// Asks the other end to enable terminal type, and once it has, asks for the terminal type
 func (tconn *implTelnetConnection) QueryTerminal() error {
-	_, err := tconn.writer.Write([]byte{IAC, DO, TERMINAL_TYPE})
-	if err != nil {
-		err = tconn.writer.Flush()
+	return tconn.requestRemoteOption(TERMINAL_TYPE, true)
+}
+
+// Asks the other end to tell us the size of its window, which it does now and whenever the window is resized
+func (tconn *implTelnetConnection) QueryWindowSize() error {
+	return tconn.requestRemoteOption(NAWS, true)
+}
+
+// Offers the other end to compress output (MCCP2). Compression starts once the other end agrees, and if it
+// refuses, output is simply not compressed.
+func (tconn *implTelnetConnection) OfferCompression() error {
+	return tconn.requestLocalOption(COMPRESS2, true)
+}
+
+// Offers the other end to exchange GMCP messages (out-of-band data)
+func (tconn *implTelnetConnection) OfferGmcp() error {
+	return tconn.requestLocalOption(GMCP, true)
+}
+
+// Offers the other end (a MUD listing site) to tell it the status of the server. Once it agrees, the observer is
+// told, and the status is sent by WriteSubnegotiation.
+func (tconn *implTelnetConnection) OfferMssp() error {
+	return tconn.requestLocalOption(MSSP, true)
+}
+
+// Offers the other end to agree on a character set. Until it does, UTF-8 is used (or ASCII, if MTTS tells that the
+// other end can't do UTF-8).
+func (tconn *implTelnetConnection) OfferCharset() error {
+	return tconn.requestLocalOption(CHARSET, true)
+}
+
+// Offers the other end to mark the end of prompts with IAC EOR rather than IAC GA
+func (tconn *implTelnetConnection) OfferEndOfRecord() error {
+	return tconn.requestLocalOption(END_OF_RECORD, true)
+}
+
+// Marks the end of a prompt, so that the other end can tell it from output that is not yet complete: IAC EOR if
+// the other end has agreed to it, otherwise IAC GA, unless it has agreed to suppress go-aheads
+func (tconn *implTelnetConnection) MarkPrompt() error {
+	tconn.lock.Lock()
+	defer tconn.lock.Unlock()
+
+	switch {
+	case tconn.options[END_OF_RECORD].us.enabled():
+		return tconn.writeCommandNoLock(IAC, EOR)
+	case tconn.options[SUPPRESS_GO_AHEAD].us.enabled():
+		return nil
+	default:
+		return tconn.writeCommandNoLock(IAC, GA)
 	}
+}
+
+// Writes IAC SB <option> <payload> IAC SE, escaping IACs in the payload
+func (tconn *implTelnetConnection) WriteSubnegotiation(option byte, payload []byte) error {
+	command := make([]byte, 0, len(payload)+5)
+	command = append(command, IAC, SB, option)
+	for _, b := range payload {
+		if b == IAC {
+			command = append(command, IAC)
+		}
+		command = append(command, b)
+	}
+	command = append(command, IAC, SE)
+
+	tconn.lock.Lock()
+	defer tconn.lock.Unlock()
 
+	return tconn.writeCommandNoLock(command...)
+}
+
+// Tells the other end that all output from now on is compressed, and starts compressing it
+func (tconn *implTelnetConnection) startCompression() error {
+	tconn.lock.Lock()
+	defer tconn.lock.Unlock()
+
+	if tconn.compressor != nil {
+		return nil
+	}
+
+	err := tconn.writeCommandNoLock(IAC, SB, COMPRESS2, IAC, SE)
 	if err != nil {
 		return err
 	}
 
-	_, err = tconn.writer.Write([]byte{IAC, SB, TERMINAL_TYPE, ECHO, IAC, SE})
+	tconn.compressor = zlib.NewWriter(tconn.rawWriter)
+	tconn.writer.Reset(tconn.compressor)
+	return nil
+}
+
+// Ends the compressed stream cleanly, so that the other end goes back to reading uncompressed output.
+// The option stays enabled, so compression can be started again without negotiating.
+func (tconn *implTelnetConnection) endCompression() error {
+	tconn.lock.Lock()
+	defer tconn.lock.Unlock()
+
+	return tconn.endCompressionNoLock()
+}
+
+func (tconn *implTelnetConnection) endCompressionNoLock() error {
+	if tconn.compressor == nil {
+		return nil
+	}
+
+	err := tconn.writer.Flush()
+	if closeErr := tconn.compressor.Close(); err == nil {
+		err = closeErr
+	}
+
+	tconn.compressor = nil
+	tconn.writer.Reset(tconn.rawWriter)
+	return err
+}
+
+func (tconn *implTelnetConnection) IsLocalOptionEnabled(option byte) bool {
+	tconn.lock.Lock()
+	defer tconn.lock.Unlock()
+
+	return tconn.options[option].us.enabled()
+}
+
+func (tconn *implTelnetConnection) IsRemoteOptionEnabled(option byte) bool {
+	tconn.lock.Lock()
+	defer tconn.lock.Unlock()
+
+	return tconn.options[option].him.enabled()
+}
+
+// Marks an option on our side as enabled without negotiating, because it was negotiated by somebody else (the
+// process before a copyover)
+func (tconn *implTelnetConnection) assumeLocalOptionEnabled(option byte) {
+	tconn.lock.Lock()
+	defer tconn.lock.Unlock()
+
+	tconn.options[option].us = qSide{state: Q_YES}
+}
+
+// Asks for an option to be enabled or disabled on our side (WILL/WONT)
+func (tconn *implTelnetConnection) requestLocalOption(option byte, enable bool) error {
+	return tconn.negotiate(option, true, func(side *qSide) qAnswer {
+		if enable {
+			return side.requestEnable()
+		}
+		return side.requestDisable()
+	})
+}
+
+// Asks the other end to enable or disable an option on its side (DO/DONT)
+func (tconn *implTelnetConnection) requestRemoteOption(option byte, enable bool) error {
+	return tconn.negotiate(option, false, func(side *qSide) qAnswer {
+		if enable {
+			return side.requestEnable()
+		}
+		return side.requestDisable()
+	})
+}
+
+// Handles WILL, WONT, DO and DONT from the other end
+func (tconn *implTelnetConnection) receiveOptionCommand(command byte, option byte) error {
+	switch command {
+	case WILL:
+		return tconn.negotiate(option, false, func(side *qSide) qAnswer { return side.receivedEnable(supportedRemoteOptions[option]) })
+	case WONT:
+		return tconn.negotiate(option, false, func(side *qSide) qAnswer { return side.receivedDisable() })
+	case DO:
+		return tconn.negotiate(option, true, func(side *qSide) qAnswer { return side.receivedEnable(supportedLocalOptions[option]) })
+	default: // DONT
+		return tconn.negotiate(option, true, func(side *qSide) qAnswer { return side.receivedDisable() })
+	}
+}
+
+// Moves one side of an option to a new state, sends what the state change calls for, and tells the observer if
+// the option was enabled or disabled
+func (tconn *implTelnetConnection) negotiate(option byte, local bool, transition func(side *qSide) qAnswer) error {
+	tconn.lock.Lock()
+
+	side := &tconn.options[option].him
+	enableCommand, disableCommand := byte(DO), byte(DONT)
+	if local {
+		side = &tconn.options[option].us
+		enableCommand, disableCommand = WILL, WONT
+	}
+
+	wasEnabled := side.enabled()
+	answer := transition(side)
+	isEnabled := side.enabled()
+
+	var err error
+	switch answer {
+	case QA_ENABLE:
+		err = tconn.writeCommandNoLock(IAC, enableCommand, option)
+	case QA_DISABLE:
+		err = tconn.writeCommandNoLock(IAC, disableCommand, option)
+	}
+
+	tconn.lock.Unlock()
+
+	if wasEnabled != isEnabled {
+		tconn.optionChanged(option, local, isEnabled)
+	}
+
+	return err
+}
+
+func (tconn *implTelnetConnection) optionChanged(option byte, local bool, enabled bool) {
+	if option == TERMINAL_TYPE && !local && enabled {
+		tconn.lock.Lock()
+		tconn.writeCommandNoLock(IAC, SB, TERMINAL_TYPE, TTYPE_SEND, IAC, SE)
+		tconn.lock.Unlock()
+	}
+
+	if option == CHARSET && local && enabled {
+		// ";UTF-8;ISO-8859-1;US-ASCII"
+		request := []byte{CHARSET_REQUEST}
+		for _, offered := range offeredCharsets {
+			request = append(append(request, ';'), offered.Name()...)
+		}
+		tconn.WriteSubnegotiation(CHARSET, request)
+	}
+
+	if option == COMPRESS2 && local {
+		if enabled {
+			tconn.startCompression()
+		} else {
+			tconn.endCompression()
+		}
+	}
+
+	if tconn.observer != nil {
+		tconn.observer.OptionChanged(option, local, enabled)
+	}
+}
+
+// Writes a telnet command, and flushes it. The lock must be held by the caller.
+func (tconn *implTelnetConnection) writeCommandNoLock(command ...byte) error {
+	_, err := tconn.writer.Write(command)
 	if err == nil {
-		err = tconn.writer.Flush()
+		err = tconn.flushNoLock()
 	}
 	return err
 }
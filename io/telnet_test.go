@@ -3,13 +3,25 @@ package io
 import (
 	"bufio"
 	"bytes"
+	"compress/zlib"
 	"io"
 	"testing"
+
+	"github.com/jorgensigvardsson/gomud/charset"
 )
 
+type optionChange struct {
+	option  byte
+	local   bool
+	enabled bool
+}
+
 type SpyingTelnetObserver struct {
 	commandsSeen        [][]byte
 	invalidCommandsSeen [][]byte
+	subnegotiationsSeen []Subnegotiation
+	optionChangesSeen   []optionChange
+	charsetsSeen        []charset.Charset
 }
 
 func (observer *SpyingTelnetObserver) CommandReceived(command []byte) {
@@ -20,6 +32,18 @@ func (observer *SpyingTelnetObserver) InvalidCommand(data []byte) {
 	observer.invalidCommandsSeen = append(observer.invalidCommandsSeen, data)
 }
 
+func (observer *SpyingTelnetObserver) SubnegotiationReceived(subnegotiation Subnegotiation) {
+	observer.subnegotiationsSeen = append(observer.subnegotiationsSeen, subnegotiation)
+}
+
+func (observer *SpyingTelnetObserver) CharsetChanged(newCharset charset.Charset) {
+	observer.charsetsSeen = append(observer.charsetsSeen, newCharset)
+}
+
+func (observer *SpyingTelnetObserver) OptionChanged(option byte, local bool, enabled bool) {
+	observer.optionChangesSeen = append(observer.optionChangesSeen, optionChange{option, local, enabled})
+}
+
 /*** readByte tests ***/
 
 func Test_readByte_SingleDataByte(t *testing.T) {
@@ -71,7 +95,7 @@ func Test_readByte_IACIsLastByte(t *testing.T) {
 
 func Test_readByte_CommandFirstThenByte(t *testing.T) {
 	spyingObserver := SpyingTelnetObserver{}
-	readBuffer := []byte{IAC, IP, 1}
+	readBuffer := []byte{IAC, AYT, 1}
 	conn := &implTelnetConnection{
 		reader:   bufio.NewReader(bytes.NewReader(readBuffer)),
 		observer: &spyingObserver,
@@ -89,8 +113,8 @@ func Test_readByte_CommandFirstThenByte(t *testing.T) {
 
 	if len(spyingObserver.commandsSeen) != 1 {
 		t.Errorf("Observer expected to have seen one command, but saw %v", len(spyingObserver.commandsSeen))
-	} else if !bytes.Equal(spyingObserver.commandsSeen[0], []byte{IAC, IP}) {
-		t.Errorf("Observer expected to have seen command [IAC, IP], but saw %v", spyingObserver.commandsSeen[0])
+	} else if !bytes.Equal(spyingObserver.commandsSeen[0], []byte{IAC, AYT}) {
+		t.Errorf("Observer expected to have seen command [IAC, AYT], but saw %v", spyingObserver.commandsSeen[0])
 	}
 
 	if len(spyingObserver.invalidCommandsSeen) != 0 {
@@ -101,8 +125,10 @@ func Test_readByte_CommandFirstThenByte(t *testing.T) {
 func Test_readByte_OptionCommandFirstThenByte(t *testing.T) {
 	spyingObserver := SpyingTelnetObserver{}
 	readBuffer := []byte{IAC, WILL, IP, 1}
+	writeBuffer := bytes.NewBuffer([]byte{})
 	conn := &implTelnetConnection{
 		reader:   bufio.NewReader(bytes.NewReader(readBuffer)),
+		writer:   bufio.NewWriter(writeBuffer),
 		observer: &spyingObserver,
 	}
 
@@ -122,6 +148,10 @@ func Test_readByte_OptionCommandFirstThenByte(t *testing.T) {
 		t.Errorf("Observer expected to have seen command [IAC, WILL, IP], but saw %v", spyingObserver.commandsSeen[0])
 	}
 
+	if !bytes.Equal([]byte{IAC, DONT, IP}, writeBuffer.Bytes()) {
+		t.Errorf("Expected unsupported option to be refused, but wrote %v", writeBuffer.Bytes())
+	}
+
 	if len(spyingObserver.invalidCommandsSeen) != 0 {
 		t.Errorf("Observer not expected to have seen any invalid command, but saw %v", len(spyingObserver.invalidCommandsSeen))
 	}
@@ -145,10 +175,10 @@ func Test_readByte_SubnegotiationCommandFirstThenByte(t *testing.T) {
 		t.Errorf("Unexpected data byte: %v", b)
 	}
 
-	if len(spyingObserver.commandsSeen) != 1 {
-		t.Errorf("Observer expected to have seen one command, but saw %v", len(spyingObserver.commandsSeen))
-	} else if !bytes.Equal(spyingObserver.commandsSeen[0], []byte{IAC, SB, TERMINAL_TYPE, 'V', 'T', '1', '0', '0', IAC, SE}) {
-		t.Errorf("Observer expected to have seen command [IAC, SB, TERMINAL_TYPE, 'V', 'T', '1', '0', '0', IAC, SE], but saw %v", spyingObserver.commandsSeen[0])
+	if len(spyingObserver.subnegotiationsSeen) != 1 {
+		t.Errorf("Observer expected to have seen one subnegotiation, but saw %v", len(spyingObserver.subnegotiationsSeen))
+	} else if spyingObserver.subnegotiationsSeen[0].Option != TERMINAL_TYPE || string(spyingObserver.subnegotiationsSeen[0].Payload) != "VT100" {
+		t.Errorf("Observer expected to have seen subnegotiation TERMINAL_TYPE \"VT100\", but saw %v", spyingObserver.subnegotiationsSeen[0])
 	}
 
 	if len(spyingObserver.invalidCommandsSeen) != 0 {
@@ -185,6 +215,68 @@ func Test_readByte_InvalidCommandThenDataByte(t *testing.T) {
 	}
 }
 
+func Test_readByte_Subnegotiation_SEInPayload_EscapedIACUnescaped(t *testing.T) {
+	spyingObserver := SpyingTelnetObserver{}
+	readBuffer := []byte{IAC, SB, NAWS, 0, SE, IAC, IAC, 24, IAC, SE, 1}
+	conn := &implTelnetConnection{
+		reader:   bufio.NewReader(bytes.NewReader(readBuffer)),
+		observer: &spyingObserver,
+	}
+
+	b, err := conn.readByte()
+
+	if err != nil || b != 1 {
+		t.Errorf("Unexpected data byte %v or error: %v", b, err)
+	}
+
+	if len(spyingObserver.subnegotiationsSeen) != 1 {
+		t.Fatalf("Observer expected to have seen one subnegotiation, but saw %v", len(spyingObserver.subnegotiationsSeen))
+	}
+
+	if payload := spyingObserver.subnegotiationsSeen[0].Payload; !bytes.Equal(payload, []byte{0, SE, IAC, 24}) {
+		t.Errorf("Unexpected payload %v", payload)
+	}
+}
+
+func Test_readByte_Subnegotiation_TooLong_Discarded(t *testing.T) {
+	spyingObserver := SpyingTelnetObserver{}
+	readBuffer := append([]byte{IAC, SB, TERMINAL_TYPE}, bytes.Repeat([]byte{'x'}, MAX_SUBNEGOTIATION_PAYLOAD+1)...)
+	readBuffer = append(readBuffer, IAC, SE, 1)
+	conn := &implTelnetConnection{
+		reader:   bufio.NewReader(bytes.NewReader(readBuffer)),
+		observer: &spyingObserver,
+	}
+
+	b, err := conn.readByte()
+
+	if err != nil || b != 1 {
+		t.Errorf("Unexpected data byte %v or error: %v", b, err)
+	}
+
+	if len(spyingObserver.subnegotiationsSeen) != 0 || len(spyingObserver.invalidCommandsSeen) != 1 {
+		t.Errorf("Expected the subnegotiation to be reported as invalid, but saw %v subnegotiations", len(spyingObserver.subnegotiationsSeen))
+	}
+}
+
+func Test_readByte_Subnegotiation_BrokenByOtherCommand(t *testing.T) {
+	spyingObserver := SpyingTelnetObserver{}
+	readBuffer := []byte{IAC, SB, TERMINAL_TYPE, 'x', IAC, NOP, 1}
+	conn := &implTelnetConnection{
+		reader:   bufio.NewReader(bytes.NewReader(readBuffer)),
+		observer: &spyingObserver,
+	}
+
+	b, err := conn.readByte()
+
+	if err != nil || b != 1 {
+		t.Errorf("Unexpected data byte %v or error: %v", b, err)
+	}
+
+	if len(spyingObserver.subnegotiationsSeen) != 0 || len(spyingObserver.invalidCommandsSeen) != 1 {
+		t.Errorf("Expected the subnegotiation to be reported as invalid: %v", spyingObserver.invalidCommandsSeen)
+	}
+}
+
 /*** writeRune tests ***/
 func Test_writeByte_OneDataByte(t *testing.T) {
 	writeBuffer := bytes.NewBuffer([]byte{})
@@ -280,6 +372,146 @@ func Test_ReadLine_ReadsUntilError(t *testing.T) {
 	}
 }
 
+func readLineFrom(readBuffer []byte) (string, error) {
+	conn := &implTelnetConnection{
+		reader: bufio.NewReader(bytes.NewReader(readBuffer)),
+	}
+
+	return conn.ReadLine()
+}
+
+func Test_ReadLine_BackspaceAndDeleteEraseLastCharacter(t *testing.T) {
+	line, err := readLineFrom([]byte("Helpp\x08\x7fo\r\n"))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if line != "Helo" {
+		t.Errorf("Unexpected line: %q", line)
+	}
+}
+
+func Test_ReadLine_BackspaceErasesWholeUtf8Character(t *testing.T) {
+	line, err := readLineFrom([]byte("Åsa\x08\x08\x08A\r\n"))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if line != "A" {
+		t.Errorf("Unexpected line: %q", line)
+	}
+}
+
+func Test_ReadLine_BackspaceOnEmptyLine_Ignored(t *testing.T) {
+	line, err := readLineFrom([]byte("\x08\x08Hi\r\n"))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if line != "Hi" {
+		t.Errorf("Unexpected line: %q", line)
+	}
+}
+
+func Test_ReadLine_TelnetEraseCharacterAndEraseLine(t *testing.T) {
+	line, err := readLineFrom([]byte{'f', 'o', 'o', IAC, EL, 'b', 'a', 'r', 'r', IAC, EC, '\r', '\n'})
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if line != "bar" {
+		t.Errorf("Unexpected line: %q", line)
+	}
+}
+
+func Test_ReadLine_CtrlUErasesLine(t *testing.T) {
+	line, err := readLineFrom([]byte("foo\x15bar\r\n"))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if line != "bar" {
+		t.Errorf("Unexpected line: %q", line)
+	}
+}
+
+func Test_ReadLine_ControlCharactersStripped(t *testing.T) {
+	line, err := readLineFrom([]byte("a\x00b\x1b[Ac\x07\td\r\n"))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if line != "ab[Ac d" {
+		t.Errorf("Unexpected line: %q", line)
+	}
+}
+
+func Test_ReadLine_InterruptAndBreak_Interrupted(t *testing.T) {
+	for _, command := range []byte{IP, BREAK} {
+		conn := &implTelnetConnection{
+			reader: bufio.NewReader(bytes.NewReader([]byte{'f', 'o', 'o', IAC, command, 'b', 'a', 'r', '\r', '\n'})),
+		}
+
+		line, err := conn.ReadLine()
+
+		if err != ErrInterrupted {
+			t.Errorf("Expected ErrInterrupted for command %v, but got %v", command, err)
+		}
+
+		if line != "" {
+			t.Errorf("Unexpected line: %q", line)
+		}
+
+		// The connection is still usable after an interrupt
+		line, err = conn.ReadLine()
+
+		if err != nil || line != "bar" {
+			t.Errorf("Unexpected line after interrupt: %q, %v", line, err)
+		}
+	}
+}
+
+func Test_ReadLine_TooLong_ThrownAwayUntilNewLine(t *testing.T) {
+	readBuffer := append(bytes.Repeat([]byte{'x'}, MAX_LINE_LENGTH+10), "\r\nok\r\n"...)
+	conn := &implTelnetConnection{
+		reader: bufio.NewReader(bytes.NewReader(readBuffer)),
+	}
+
+	line, err := conn.ReadLine()
+
+	if err != ErrLineTooLong {
+		t.Errorf("Expected ErrLineTooLong, but got %v", err)
+	}
+
+	if line != "" {
+		t.Errorf("Unexpected line: %q", line)
+	}
+
+	line, err = conn.ReadLine()
+
+	if err != nil || line != "ok" {
+		t.Errorf("Unexpected line after too long line: %q, %v", line, err)
+	}
+}
+
+func Test_ReadLine_MaxLength_Accepted(t *testing.T) {
+	line, err := readLineFrom(append(bytes.Repeat([]byte{'x'}, MAX_LINE_LENGTH), '\n'))
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if len(line) != MAX_LINE_LENGTH {
+		t.Errorf("Unexpected line length: %v", len(line))
+	}
+}
+
 /*** WriteLine tests ***/
 func Test_WriteLine_AppendsCrAndLf(t *testing.T) {
 	writeBuffer := bytes.NewBuffer([]byte{})
@@ -340,13 +572,15 @@ func Test_EchoOn(t *testing.T) {
 		writer: bufio.NewWriter(writeBuffer),
 	}
 
+	conn.assumeLocalOptionEnabled(ECHO)
+
 	err := conn.EchoOn()
 
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
 
-	if !bytes.Equal([]byte{IAC, WONT, ECHO, 0}, writeBuffer.Bytes()) {
+	if !bytes.Equal([]byte{IAC, WONT, ECHO}, writeBuffer.Bytes()) {
 		t.Errorf("Unexpected write buffer %v", writeBuffer.Bytes())
 	}
 }
@@ -364,7 +598,388 @@ func Test_EchoOff(t *testing.T) {
 		t.Errorf("Unexpected error: %v", err)
 	}
 
-	if !bytes.Equal([]byte{IAC, WILL, ECHO, 0}, writeBuffer.Bytes()) {
+	if !bytes.Equal([]byte{IAC, WILL, ECHO}, writeBuffer.Bytes()) {
 		t.Errorf("Unexpected write buffer %v", writeBuffer.Bytes())
 	}
 }
+
+func Test_EchoOn_AlreadyOn_NothingWritten(t *testing.T) {
+	writeBuffer := bytes.NewBuffer([]byte{})
+	conn := &implTelnetConnection{
+		writer: bufio.NewWriter(writeBuffer),
+	}
+
+	err := conn.EchoOn()
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if writeBuffer.Len() != 0 {
+		t.Errorf("Unexpected write buffer %v", writeBuffer.Bytes())
+	}
+}
+
+/*** Option negotiation tests ***/
+func newNegotiatingConnection(readBuffer []byte) (*implTelnetConnection, *bytes.Buffer, *SpyingTelnetObserver) {
+	writeBuffer := bytes.NewBuffer([]byte{})
+	observer := &SpyingTelnetObserver{}
+	conn := &implTelnetConnection{
+		reader:    bufio.NewReader(bytes.NewReader(readBuffer)),
+		writer:    bufio.NewWriter(writeBuffer),
+		rawWriter: writeBuffer,
+		observer:  observer,
+	}
+
+	return conn, writeBuffer, observer
+}
+
+func Test_Negotiation_UnsupportedOptions_Refused(t *testing.T) {
+	conn, writeBuffer, observer := newNegotiatingConnection([]byte{IAC, DO, LINE_MODE, IAC, WILL, AUTH, 1})
+
+	conn.readByte()
+
+	if !bytes.Equal([]byte{IAC, WONT, LINE_MODE, IAC, DONT, AUTH}, writeBuffer.Bytes()) {
+		t.Errorf("Unexpected write buffer %v", writeBuffer.Bytes())
+	}
+
+	if len(observer.optionChangesSeen) != 0 || conn.IsLocalOptionEnabled(LINE_MODE) || conn.IsRemoteOptionEnabled(AUTH) {
+		t.Errorf("Unsupported options were enabled: %v", observer.optionChangesSeen)
+	}
+}
+
+func Test_Negotiation_SupportedOption_Accepted(t *testing.T) {
+	conn, writeBuffer, observer := newNegotiatingConnection([]byte{IAC, DO, SUPPRESS_GO_AHEAD, 1})
+
+	conn.readByte()
+
+	if !bytes.Equal([]byte{IAC, WILL, SUPPRESS_GO_AHEAD}, writeBuffer.Bytes()) {
+		t.Errorf("Unexpected write buffer %v", writeBuffer.Bytes())
+	}
+
+	if !conn.IsLocalOptionEnabled(SUPPRESS_GO_AHEAD) || len(observer.optionChangesSeen) != 1 || observer.optionChangesSeen[0] != (optionChange{SUPPRESS_GO_AHEAD, true, true}) {
+		t.Errorf("Option was not enabled: %v", observer.optionChangesSeen)
+	}
+}
+
+func Test_Negotiation_AcknowledgementIsNotAnswered(t *testing.T) {
+	// We ask for echo, the client agrees, and repeats itself (which a broken client might). No answers, no loop!
+	conn, writeBuffer, _ := newNegotiatingConnection([]byte{IAC, DO, ECHO, IAC, DO, ECHO, 1})
+
+	conn.EchoOff()
+	conn.readByte()
+
+	if !bytes.Equal([]byte{IAC, WILL, ECHO}, writeBuffer.Bytes()) {
+		t.Errorf("Unexpected write buffer %v", writeBuffer.Bytes())
+	}
+
+	if !conn.IsLocalOptionEnabled(ECHO) {
+		t.Error("Echo option was not enabled")
+	}
+}
+
+func Test_Negotiation_RequestWhileNegotiating_IsQueued(t *testing.T) {
+	// Echo off, then on again before the client has answered: the second request waits for the answer
+	conn, writeBuffer, _ := newNegotiatingConnection([]byte{IAC, DO, ECHO, IAC, DONT, ECHO, 1})
+
+	conn.EchoOff()
+	conn.EchoOn()
+
+	if !bytes.Equal([]byte{IAC, WILL, ECHO}, writeBuffer.Bytes()) {
+		t.Fatalf("Unexpected write buffer %v", writeBuffer.Bytes())
+	}
+
+	conn.readByte()
+
+	if !bytes.Equal([]byte{IAC, WILL, ECHO, IAC, WONT, ECHO}, writeBuffer.Bytes()) {
+		t.Errorf("Unexpected write buffer %v", writeBuffer.Bytes())
+	}
+
+	if conn.IsLocalOptionEnabled(ECHO) {
+		t.Error("Echo option was left enabled")
+	}
+}
+
+func Test_Negotiation_UnsolicitedDoEcho_Refused(t *testing.T) {
+	conn, writeBuffer, _ := newNegotiatingConnection([]byte{IAC, DO, ECHO, 1})
+
+	conn.readByte()
+
+	if !bytes.Equal([]byte{IAC, WONT, ECHO}, writeBuffer.Bytes()) {
+		t.Errorf("Unexpected write buffer %v", writeBuffer.Bytes())
+	}
+}
+
+func Test_QueryTerminal_AsksForTerminalTypeOnceEnabled(t *testing.T) {
+	conn, writeBuffer, _ := newNegotiatingConnection([]byte{IAC, WILL, TERMINAL_TYPE, 1})
+
+	conn.QueryTerminal()
+
+	if !bytes.Equal([]byte{IAC, DO, TERMINAL_TYPE}, writeBuffer.Bytes()) {
+		t.Fatalf("Unexpected write buffer %v", writeBuffer.Bytes())
+	}
+
+	conn.readByte()
+
+	if !bytes.Equal([]byte{IAC, DO, TERMINAL_TYPE, IAC, SB, TERMINAL_TYPE, TTYPE_SEND, IAC, SE}, writeBuffer.Bytes()) {
+		t.Errorf("Unexpected write buffer %v", writeBuffer.Bytes())
+	}
+}
+
+func Test_QueryWindowSize_ReceivesSizeAndResizes(t *testing.T) {
+	conn, writeBuffer, observer := newNegotiatingConnection([]byte{
+		IAC, WILL, NAWS,
+		IAC, SB, NAWS, 0, 80, 0, 24, IAC, SE,
+		IAC, SB, NAWS, 1, 0, 0, 50, IAC, SE,
+		1,
+	})
+
+	conn.QueryWindowSize()
+	conn.readByte()
+
+	if !bytes.Equal([]byte{IAC, DO, NAWS}, writeBuffer.Bytes()) {
+		t.Errorf("Unexpected write buffer %v", writeBuffer.Bytes())
+	}
+
+	if !conn.IsRemoteOptionEnabled(NAWS) || len(observer.subnegotiationsSeen) != 2 {
+		t.Fatalf("Expected NAWS to be enabled and two window sizes, but saw %v", observer.subnegotiationsSeen)
+	}
+
+	for i, expected := range [][2]int{{80, 24}, {256, 50}} {
+		width, height, ok := parseWindowSize(observer.subnegotiationsSeen[i].Payload)
+		if !ok || width != expected[0] || height != expected[1] {
+			t.Errorf("Expected window size %v, but got %v x %v", expected, width, height)
+		}
+	}
+}
+
+func Test_parseWindowSize_InvalidPayload(t *testing.T) {
+	_, _, ok := parseWindowSize([]byte{0, 80, 0})
+
+	if ok {
+		t.Error("Expected a payload of three bytes to be invalid")
+	}
+}
+
+func Test_OfferCompression_Accepted_OutputIsCompressed(t *testing.T) {
+	conn, writeBuffer, _ := newNegotiatingConnection([]byte{IAC, DO, COMPRESS2, 1})
+
+	conn.OfferCompression()
+	conn.readByte()
+
+	start := []byte{IAC, WILL, COMPRESS2, IAC, SB, COMPRESS2, IAC, SE}
+	if !bytes.HasPrefix(writeBuffer.Bytes(), start) {
+		t.Fatalf("Unexpected write buffer %v", writeBuffer.Bytes())
+	}
+
+	conn.WriteLine("Hello, world!")
+	conn.endCompression()
+	conn.WriteString("plain")
+
+	// The compressed stream ends cleanly, and what follows it is not compressed
+	rest := bytes.NewReader(writeBuffer.Bytes()[len(start):])
+	decompressor, err := zlib.NewReader(rest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	output, err := io.ReadAll(decompressor)
+	if err != nil || string(output) != "Hello, world!\r\n" {
+		t.Errorf("Unexpected output %q, error: %v", output, err)
+	}
+
+	plain, _ := io.ReadAll(rest)
+	if string(plain) != "plain" {
+		t.Errorf("Unexpected output after the compressed stream %q", plain)
+	}
+}
+
+func Test_OfferCompression_Refused_OutputIsNotCompressed(t *testing.T) {
+	conn, writeBuffer, _ := newNegotiatingConnection([]byte{IAC, DONT, COMPRESS2, 1})
+
+	conn.OfferCompression()
+	conn.readByte()
+	conn.WriteString("plain")
+
+	if !bytes.Equal(append([]byte{IAC, WILL, COMPRESS2}, "plain"...), writeBuffer.Bytes()) {
+		t.Errorf("Unexpected write buffer %v", writeBuffer.Bytes())
+	}
+}
+
+func Test_MarkPrompt_EndOfRecordAccepted_EorWritten(t *testing.T) {
+	conn, writeBuffer, _ := newNegotiatingConnection([]byte{IAC, DO, END_OF_RECORD, 1})
+
+	conn.OfferEndOfRecord()
+	conn.readByte()
+	writeBuffer.Reset()
+	conn.MarkPrompt()
+
+	if !bytes.Equal([]byte{IAC, EOR}, writeBuffer.Bytes()) {
+		t.Errorf("Unexpected write buffer %v", writeBuffer.Bytes())
+	}
+}
+
+func Test_MarkPrompt_EndOfRecordRefused_GoAheadWritten(t *testing.T) {
+	conn, writeBuffer, _ := newNegotiatingConnection([]byte{IAC, DONT, END_OF_RECORD, 1})
+
+	conn.OfferEndOfRecord()
+	conn.readByte()
+	writeBuffer.Reset()
+	conn.MarkPrompt()
+
+	if !bytes.Equal([]byte{IAC, GA}, writeBuffer.Bytes()) {
+		t.Errorf("Unexpected write buffer %v", writeBuffer.Bytes())
+	}
+}
+
+func Test_MarkPrompt_GoAheadsSuppressed_NothingWritten(t *testing.T) {
+	conn, writeBuffer, _ := newNegotiatingConnection([]byte{IAC, DO, SUPPRESS_GO_AHEAD, 1})
+
+	conn.readByte()
+	writeBuffer.Reset()
+	conn.MarkPrompt()
+
+	if writeBuffer.Len() != 0 {
+		t.Errorf("Unexpected write buffer %v", writeBuffer.Bytes())
+	}
+}
+
+func Test_readByte_EndOfRecordFromClient_IsCommand(t *testing.T) {
+	conn, _, observer := newNegotiatingConnection([]byte{IAC, EOR, 1})
+
+	b, err := conn.readByte()
+
+	if err != nil || b != 1 {
+		t.Errorf("Unexpected data byte %v, error %v", b, err)
+	}
+
+	if len(observer.commandsSeen) != 1 || len(observer.invalidCommandsSeen) != 0 {
+		t.Errorf("Expected one command, but saw %v (and invalid commands %v)", observer.commandsSeen, observer.invalidCommandsSeen)
+	}
+}
+
+func Test_WriteSubnegotiation_EscapesIAC(t *testing.T) {
+	conn, writeBuffer, _ := newNegotiatingConnection([]byte{})
+
+	conn.WriteSubnegotiation(GMCP, []byte{'a', IAC, 'b'})
+
+	if !bytes.Equal([]byte{IAC, SB, GMCP, 'a', IAC, IAC, 'b', IAC, SE}, writeBuffer.Bytes()) {
+		t.Errorf("Unexpected write buffer %v", writeBuffer.Bytes())
+	}
+}
+
+func Test_TerminalType_CycledUntilRepeated(t *testing.T) {
+	terminalType := func(name string) []byte {
+		return append(append([]byte{IAC, SB, TERMINAL_TYPE, TTYPE_IS}, name...), IAC, SE)
+	}
+
+	var readBuffer []byte
+	for _, name := range []string{"MUDLET", "XTERM", "MTTS 137", "MTTS 137"} {
+		readBuffer = append(readBuffer, terminalType(name)...)
+	}
+	conn, writeBuffer, observer := newNegotiatingConnection(append(readBuffer, 1))
+
+	conn.readByte()
+
+	send := []byte{IAC, SB, TERMINAL_TYPE, TTYPE_SEND, IAC, SE}
+	if !bytes.Equal(bytes.Repeat(send, 3), writeBuffer.Bytes()) {
+		t.Errorf("Expected the terminal type to be asked for three times, but got %v", writeBuffer.Bytes())
+	}
+
+	if len(observer.subnegotiationsSeen) != 4 {
+		t.Errorf("Expected the observer to see all answers, but saw %v", len(observer.subnegotiationsSeen))
+	}
+}
+
+func Test_Charset_OfferedAndAccepted_Latin1UsedForInputAndOutput(t *testing.T) {
+	readBuffer := append([]byte{IAC, DO, CHARSET, IAC, SB, CHARSET, CHARSET_ACCEPTED}, "ISO-8859-1"...)
+	readBuffer = append(readBuffer, IAC, SE, 0xc5, 's', 'a', '\r', '\n')
+	conn, writeBuffer, observer := newNegotiatingConnection(readBuffer)
+
+	conn.OfferCharset()
+	line, err := conn.ReadLine()
+
+	request := append([]byte{IAC, WILL, CHARSET, IAC, SB, CHARSET, CHARSET_REQUEST}, ";UTF-8;ISO-8859-1;US-ASCII"...)
+	if !bytes.Equal(append(request, IAC, SE), writeBuffer.Bytes()) {
+		t.Errorf("Unexpected write buffer %q", writeBuffer.Bytes())
+	}
+
+	if err != nil || line != "Åsa" {
+		t.Errorf("Unexpected line %q, error: %v", line, err)
+	}
+
+	if len(observer.charsetsSeen) != 1 || observer.charsetsSeen[0] != charset.Latin1 {
+		t.Errorf("Unexpected charsets seen %v", observer.charsetsSeen)
+	}
+
+	writeBuffer.Reset()
+	conn.WriteString("åÿł")
+
+	if !bytes.Equal([]byte{0xe5, IAC, IAC, 'l'}, writeBuffer.Bytes()) {
+		t.Errorf("Unexpected write buffer %v", writeBuffer.Bytes())
+	}
+}
+
+func Test_Charset_Rejected_AsciiUsed(t *testing.T) {
+	conn, writeBuffer, _ := newNegotiatingConnection([]byte{IAC, DO, CHARSET, IAC, SB, CHARSET, CHARSET_REJECTED, IAC, SE, 1})
+
+	conn.OfferCharset()
+	conn.readByte()
+	writeBuffer.Reset()
+	conn.WriteString("Räksmörgås “x”")
+
+	if writeBuffer.String() != "Raksmorgas \"x\"" {
+		t.Errorf("Unexpected write buffer %q", writeBuffer.Bytes())
+	}
+}
+
+func Test_Charset_MttsWithoutUtf8_AsciiUsed(t *testing.T) {
+	readBuffer := append([]byte{IAC, SB, TERMINAL_TYPE, TTYPE_IS}, "MTTS 9"...)
+	conn, writeBuffer, observer := newNegotiatingConnection(append(readBuffer, IAC, SE, 1))
+
+	conn.readByte()
+	writeBuffer.Reset()
+	conn.WriteString("Räksmörgås")
+
+	if writeBuffer.String() != "Raksmorgas" {
+		t.Errorf("Unexpected write buffer %q", writeBuffer.Bytes())
+	}
+
+	if len(observer.charsetsSeen) != 1 || observer.charsetsSeen[0] != charset.ASCII {
+		t.Errorf("Unexpected charsets seen %v", observer.charsetsSeen)
+	}
+}
+
+func Test_Charset_MttsAfterNegotiation_NegotiatedCharsetKept(t *testing.T) {
+	readBuffer := append([]byte{IAC, SB, CHARSET, CHARSET_REQUEST}, ";ISO-8859-1"...)
+	readBuffer = append(append(readBuffer, IAC, SE, IAC, SB, TERMINAL_TYPE, TTYPE_IS), "MTTS 9"...)
+	conn, writeBuffer, observer := newNegotiatingConnection(append(readBuffer, IAC, SE, 1))
+
+	conn.readByte()
+	writeBuffer.Reset()
+	conn.WriteString("å")
+
+	if !bytes.Equal([]byte{0xe5}, writeBuffer.Bytes()) {
+		t.Errorf("Unexpected write buffer %v", writeBuffer.Bytes())
+	}
+
+	if len(observer.charsetsSeen) != 1 || observer.charsetsSeen[0] != charset.Latin1 {
+		t.Errorf("Unexpected charsets seen %v", observer.charsetsSeen)
+	}
+}
+
+func Test_Charset_RequestedByClient_FirstSupportedAccepted(t *testing.T) {
+	readBuffer := append([]byte{IAC, SB, CHARSET, CHARSET_REQUEST}, " KOI8-R latin1 UTF-8"...)
+	conn, writeBuffer, observer := newNegotiatingConnection(append(readBuffer, IAC, SE, 1))
+
+	conn.readByte()
+
+	expected := append([]byte{IAC, SB, CHARSET, CHARSET_ACCEPTED}, "latin1"...)
+	if !bytes.Equal(append(expected, IAC, SE), writeBuffer.Bytes()) {
+		t.Errorf("Unexpected write buffer %q", writeBuffer.Bytes())
+	}
+
+	if len(observer.charsetsSeen) != 1 || observer.charsetsSeen[0] != charset.Latin1 {
+		t.Errorf("Unexpected charsets seen %v", observer.charsetsSeen)
+	}
+}
@@ -0,0 +1,113 @@
+package io
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/jorgensigvardsson/gomud/ansi"
+	"github.com/jorgensigvardsson/gomud/mudio"
+)
+
+// Terminal type cycling, as described by the Mud Terminal Type Standard (MTTS): every time we ask for the terminal
+// type, the client answers with the next one in its list. The first answer is the name of the client, the second
+// its terminal type, and the third "MTTS <bit vector>". The list has ended when the client repeats its answer.
+// Clients that don't cycle give the same answer every time.
+
+// Bits of the MTTS bit vector
+const (
+	MTTS_ANSI           = 1
+	MTTS_VT100          = 2
+	MTTS_UTF8           = 4
+	MTTS_256_COLORS     = 8
+	MTTS_MOUSE_TRACKING = 16
+	MTTS_OSC_COLORS     = 32
+	MTTS_SCREEN_READER  = 64
+	MTTS_PROXY          = 128
+	MTTS_TRUECOLOR      = 256
+	MTTS_MNES           = 512
+	MTTS_MSLP           = 1024
+	MTTS_SSL            = 2048
+)
+
+// Clients known to understand MXP, by the name they give in their first answer. MXP has no MTTS bit, and agreeing to
+// the MXP option would promise MXP mode, which we don't speak.
+var mxpClients = []string{"MUDLET", "MUSHCLIENT", "CMUD", "ZMUD", "TINTIN++", "BEIP"}
+
+// We stop asking after this many answers, in case a client never repeats itself
+const MAX_TERMINAL_TYPES = 8
+
+// Records what a terminal type answer tells about the client. `index` is 0 for the first answer.
+func applyTerminalType(capabilities *mudio.ClientCapabilities, terminalType string, index int) {
+	if bits, ok := parseMtts(terminalType); ok {
+		applyMtts(capabilities, bits)
+		return
+	}
+
+	if index == 0 {
+		capabilities.ClientName = terminalType
+		capabilities.Mxp = isMxpClient(terminalType)
+	}
+	capabilities.TerminalType = terminalType
+
+	// Clients that don't know MTTS may still tell what they can do by their terminal type
+	tt := strings.ToLower(terminalType)
+	if strings.Contains(tt, "xterm") || strings.Contains(tt, "ansi") {
+		capabilities.Ansi = true
+	}
+
+	if strings.Contains(tt, "256color") {
+		capabilities.Ansi = true
+		capabilities.Colors256 = true
+	}
+
+	if strings.Contains(tt, "truecolor") || strings.Contains(tt, "24bit") {
+		capabilities.Ansi = true
+		capabilities.Colors256 = true
+		capabilities.TrueColor = true
+	}
+}
+
+// Parses an "MTTS <bit vector>" answer
+func parseMtts(terminalType string) (bits int, ok bool) {
+	fields := strings.Fields(terminalType)
+	if len(fields) != 2 || !strings.EqualFold(fields[0], "MTTS") {
+		return 0, false
+	}
+
+	bits, err := strconv.Atoi(fields[1])
+	return bits, err == nil
+}
+
+func isMxpClient(clientName string) bool {
+	fields := strings.Fields(clientName)
+	if len(fields) == 0 {
+		return false
+	}
+
+	for _, name := range mxpClients {
+		if strings.EqualFold(fields[0], name) {
+			return true
+		}
+	}
+	return false
+}
+
+func applyMtts(capabilities *mudio.ClientCapabilities, bits int) {
+	capabilities.Ansi = bits&MTTS_ANSI != 0
+	capabilities.Utf8 = bits&MTTS_UTF8 != 0
+	capabilities.Colors256 = bits&MTTS_256_COLORS != 0
+	capabilities.ScreenReader = bits&MTTS_SCREEN_READER != 0
+	capabilities.TrueColor = bits&MTTS_TRUECOLOR != 0
+}
+
+// How many colors the client can show, so that colors it can't are replaced by ones it can
+func colorDepth(capabilities mudio.ClientCapabilities) ansi.ColorDepth {
+	switch {
+	case capabilities.TrueColor:
+		return ansi.TRUE_COLOR
+	case capabilities.Colors256:
+		return ansi.COLORS_256
+	default:
+		return ansi.COLORS_16
+	}
+}
@@ -0,0 +1,70 @@
+package io
+
+import (
+	"testing"
+
+	"github.com/jorgensigvardsson/gomud/ansi"
+	"github.com/jorgensigvardsson/gomud/mudio"
+)
+
+func Test_applyTerminalType_Mtts(t *testing.T) {
+	capabilities := mudio.ClientCapabilities{}
+
+	for i, terminalType := range []string{"MUDLET", "XTERM", "MTTS 325"} {
+		applyTerminalType(&capabilities, terminalType, i)
+	}
+
+	expected := mudio.ClientCapabilities{
+		ClientName:   "MUDLET",
+		TerminalType: "XTERM",
+		Mxp:          true,
+		Ansi:         true,
+		Utf8:         true,
+		ScreenReader: true,
+		TrueColor:    true,
+	}
+
+	if capabilities != expected {
+		t.Errorf("Expected %+v, but got %+v", expected, capabilities)
+	}
+}
+
+func Test_applyTerminalType_NoMtts(t *testing.T) {
+	testCases := []struct {
+		terminalType string
+		expected     mudio.ClientCapabilities
+	}{
+		{"vt100", mudio.ClientCapabilities{ClientName: "vt100", TerminalType: "vt100"}},
+		{"ANSI", mudio.ClientCapabilities{ClientName: "ANSI", TerminalType: "ANSI", Ansi: true}},
+		{"xterm-256color", mudio.ClientCapabilities{ClientName: "xterm-256color", TerminalType: "xterm-256color", Ansi: true, Colors256: true}},
+		{"xterm-truecolor", mudio.ClientCapabilities{ClientName: "xterm-truecolor", TerminalType: "xterm-truecolor", Ansi: true, Colors256: true, TrueColor: true}},
+		{"MUSHclient 5.07", mudio.ClientCapabilities{ClientName: "MUSHclient 5.07", TerminalType: "MUSHclient 5.07", Mxp: true}},
+	}
+
+	for _, testCase := range testCases {
+		capabilities := mudio.ClientCapabilities{}
+
+		applyTerminalType(&capabilities, testCase.terminalType, 0)
+
+		if capabilities != testCase.expected {
+			t.Errorf("Expected %+v, but got %+v", testCase.expected, capabilities)
+		}
+	}
+}
+
+func Test_colorDepth(t *testing.T) {
+	testCases := []struct {
+		capabilities mudio.ClientCapabilities
+		expected     ansi.ColorDepth
+	}{
+		{mudio.ClientCapabilities{Ansi: true}, ansi.COLORS_16},
+		{mudio.ClientCapabilities{Ansi: true, Colors256: true}, ansi.COLORS_256},
+		{mudio.ClientCapabilities{Ansi: true, Colors256: true, TrueColor: true}, ansi.TRUE_COLOR},
+	}
+
+	for _, testCase := range testCases {
+		if depth := colorDepth(testCase.capabilities); depth != testCase.expected {
+			t.Errorf("Unexpected depth %v for %+v", depth, testCase.capabilities)
+		}
+	}
+}
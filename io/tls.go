@@ -0,0 +1,141 @@
+package io
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+
+	"github.com/jorgensigvardsson/gomud/logging"
+)
+
+// How long a generated self-signed certificate is valid
+const SELF_SIGNED_CERTIFICATE_VALIDITY = 365 * 24 * time.Hour
+
+// Clients that haven't completed the TLS handshake by then are disconnected
+const TLS_HANDSHAKE_TIMEOUT = 30 * time.Second
+
+// Opens a listener for encrypted (TLS) telnet connections. If the certificate or key doesn't exist, and
+// `selfSigned` is set, a self-signed certificate is generated first, which is good enough for development but
+// makes clients warn about it.
+func ListenTls(port int, certificatePath string, keyPath string, selfSigned bool, logger logging.Logger) (net.Listener, error) {
+	if selfSigned && (!fileExists(certificatePath) || !fileExists(keyPath)) {
+		logger.Printlnf("Generating a self-signed certificate %v and key %v", certificatePath, keyPath)
+
+		err := generateSelfSignedCertificate(certificatePath, keyPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	certificate, err := tls.LoadX509KeyPair(certificatePath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return tls.Listen("tcp", fmt.Sprintf(":%v", port), &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	})
+}
+
+// Tells if a connection is encrypted
+func isSecure(connection net.Conn) bool {
+	_, secure := connection.(*tls.Conn)
+	return secure
+}
+
+// Completes the TLS handshake of an encrypted connection, which would otherwise happen on the first write, without a
+// deadline. Gives up if the client takes too long, or if the server stops or reboots meanwhile. Plain connections have
+// no handshake to complete.
+func completeTlsHandshake(connection net.Conn, logger logging.Logger, connectionsStopChannel <-chan interface{}, detach *Detacher) bool {
+	tlsConnection, secure := connection.(*tls.Conn)
+	if !secure {
+		return true
+	}
+
+	tlsConnection.SetDeadline(time.Now().Add(TLS_HANDSHAKE_TIMEOUT))
+	handshakeDone := make(chan error, 1)
+	go func() {
+		handshakeDone <- tlsConnection.Handshake()
+	}()
+
+	select {
+	case err := <-handshakeDone:
+		if err != nil {
+			logger.Printlnf("TLS handshake with %v failed: %v", connection.RemoteAddr(), err)
+			return false
+		}
+	case <-connectionsStopChannel:
+		// Nobody is logged in yet, so there's nothing to wait for
+		tlsConnection.Close()
+		<-handshakeDone
+		return false
+	case <-detach.detachChannel:
+		tlsConnection.Close()
+		<-handshakeDone
+		return false
+	}
+
+	tlsConnection.SetDeadline(time.Time{})
+	return true
+}
+
+func generateSelfSignedCertificate(certificatePath string, keyPath string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: "localhost", Organization: []string{"Go MUD"}},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    now.Add(-time.Hour), // In case the clock of the client is a bit behind
+		NotAfter:     now.Add(SELF_SIGNED_CERTIFICATE_VALIDITY),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	certificate, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	encodedKey, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	err = writePem(keyPath, "PRIVATE KEY", encodedKey, 0600)
+	if err != nil {
+		return err
+	}
+
+	return writePem(certificatePath, "CERTIFICATE", certificate, 0644)
+}
+
+func writePem(path string, blockType string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data}), perm)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return !errors.Is(err, os.ErrNotExist)
+}
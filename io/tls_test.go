@@ -0,0 +1,128 @@
+package io
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jorgensigvardsson/gomud/logging"
+)
+
+func Test_ListenTls_SelfSigned_CertificateGeneratedAndConnectionsSecure(t *testing.T) {
+	// Arrange
+	directory := t.TempDir()
+	certificatePath := filepath.Join(directory, "gomud.crt")
+	keyPath := filepath.Join(directory, "gomud.key")
+
+	// Act
+	listener, err := ListenTls(0, certificatePath, keyPath, true, logging.NewNullLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.(*tls.Conn).Handshake() // The client waits for the handshake to complete
+		}
+		accepted <- conn
+	}()
+
+	client, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%v", listener.Addr().(*net.TCPAddr).Port), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	server := <-accepted
+	defer server.Close()
+
+	// Assert
+	if !fileExists(certificatePath) || !fileExists(keyPath) {
+		t.Error("Expected the certificate and key to be generated")
+	}
+
+	if !isSecure(server) {
+		t.Error("Expected the connection to be secure")
+	}
+
+	if len(client.ConnectionState().PeerCertificates) != 1 || client.ConnectionState().PeerCertificates[0].Subject.CommonName != "localhost" {
+		t.Errorf("Unexpected certificates: %v", client.ConnectionState().PeerCertificates)
+	}
+}
+
+func Test_ListenTls_MissingCertificate_NotGenerated_Error(t *testing.T) {
+	directory := t.TempDir()
+
+	listener, err := ListenTls(0, filepath.Join(directory, "gomud.crt"), filepath.Join(directory, "gomud.key"), false, logging.NewNullLogger())
+
+	if err == nil {
+		listener.Close()
+		t.Error("Expected an error, since there is no certificate")
+	}
+}
+
+func Test_isSecure_PlainConnection_NotSecure(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	if isSecure(server) {
+		t.Error("Expected a plain connection not to be secure")
+	}
+}
+
+func Test_handleConnection_NoClientHello_ReturnsWhenStopped(t *testing.T) {
+	// Arrange
+	directory := t.TempDir()
+	listener, err := ListenTls(0, filepath.Join(directory, "gomud.crt"), filepath.Join(directory, "gomud.key"), true, logging.NewNullLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer listener.Close()
+
+	stopChannel := make(chan interface{})
+	var wg sync.WaitGroup
+	accepted := make(chan interface{})
+	go func() {
+		serverSide, err := listener.Accept()
+		if err == nil {
+			wg.Add(1) // Like HandleConnections, which is tracked until it returns
+			go func() {
+				defer wg.Done()
+				handleConnection(serverSide, logging.NewNullLogger(), nil, stopChannel, NewDetacher(1), &wg)
+			}()
+		}
+		close(accepted)
+	}()
+
+	// The client connects, but never starts the handshake
+	clientSide, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer clientSide.Close()
+	<-accepted
+
+	// Act
+	close(stopChannel)
+
+	// Assert
+	done := make(chan interface{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the connection to be given up when the server stops")
+	}
+}
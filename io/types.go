@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/ansi"
 	"github.com/jorgensigvardsson/gomud/mudio"
 )
 
@@ -12,6 +13,11 @@ type PlayerEvent int
 const (
 	PE_Nothing PlayerEvent = iota
 	PE_Exited
+	PE_MsspRequested       // The client (a MUD listing site) wants the status of the server
+	PE_CapabilitiesChanged // The client has told us more about what it can do, or the size of its window
+	PE_Interrupted         // The player interrupted the line (Ctrl-C), which aborts the command showing a prompt
+	PE_LineTooLong         // The player sent a line that was too long, and it was thrown away
+	PE_JobDone             // The job of the player's current command is done
 	PE_EventCount
 )
 
@@ -30,13 +36,28 @@ type PlayerInput struct {
 	outputChannel      chan<- *PlayerOutput
 	errorReturnChannel chan<- error
 	event              PlayerEvent
+	capabilities       mudio.ClientCapabilities // For PE_CapabilitiesChanged
+	jobResult          interface{}              // For PE_JobDone
 }
 
 type PlayerOutput struct {
 	text               string
 	echoState          EchoState
 	raw                bool
-	keepAnsiColorState bool // if true, I/O routine will end all transmissions to client with resetting ANSI color state
+	prompt             bool               // The text is a prompt, and is marked as such (IAC EOR or IAC GA) after it is written
+	keepAnsiColorState bool               // if true, I/O routine will end all transmissions to client with resetting ANSI color state
+	gmcp               *mudio.GmcpMessage // Sent out-of-band, and only if the client supports GMCP
+	mssp               []MsspVariable     // Sent as an MSSP subnegotiation
+	display            *displaySettings   // If not nil, how output is shown from now on
+	status             string             // If not empty, the new text of the status bar of a split screen
+	interruptsPrompt   bool               // The text arrives while a prompt is shown, so it must not end up after it
+	job                mudio.Job          // If not nil, done by the goroutine serving the connection, which hands back the result
+}
+
+// The player's settings for how output is shown, which the goroutine serving the connection keeps a copy of
+type displaySettings struct {
+	theme       ansi.Theme
+	splitScreen bool
 }
 
 func NewCommandPlayerInput(command mudio.Command, player *absmachine.Player, errorReturnChannel chan<- error, outputChannel chan<- *PlayerOutput) *PlayerInput {
@@ -57,6 +78,26 @@ func NewEventPlayerInput(event PlayerEvent, player *absmachine.Player, errorRetu
 	}
 }
 
+func NewCapabilitiesPlayerInput(capabilities mudio.ClientCapabilities, player *absmachine.Player, errorReturnChannel chan<- error, outputChannel chan<- *PlayerOutput) *PlayerInput {
+	return &PlayerInput{
+		player:             player,
+		event:              PE_CapabilitiesChanged,
+		capabilities:       capabilities,
+		errorReturnChannel: errorReturnChannel,
+		outputChannel:      outputChannel,
+	}
+}
+
+func NewJobDonePlayerInput(jobResult interface{}, player *absmachine.Player, errorReturnChannel chan<- error, outputChannel chan<- *PlayerOutput) *PlayerInput {
+	return &PlayerInput{
+		player:             player,
+		event:              PE_JobDone,
+		jobResult:          jobResult,
+		errorReturnChannel: errorReturnChannel,
+		outputChannel:      outputChannel,
+	}
+}
+
 func NewTextPlayerInput(text string, player *absmachine.Player, errorReturnChannel chan<- error, outputChannel chan<- *PlayerOutput) *PlayerInput {
 	return &PlayerInput{
 		player:             player,
@@ -90,6 +131,13 @@ func PrintOutput(text string) *PlayerOutput {
 	}
 }
 
+func PromptOutput(prompt string) *PlayerOutput {
+	return &PlayerOutput{
+		text:   prompt,
+		prompt: true,
+	}
+}
+
 func EchoOnOutput() *PlayerOutput {
 	return &PlayerOutput{
 		echoState: ES_On,
@@ -101,3 +149,45 @@ func EchoOffOutput() *PlayerOutput {
 		echoState: ES_Off,
 	}
 }
+
+func GmcpOutput(message mudio.GmcpMessage) *PlayerOutput {
+	return &PlayerOutput{
+		gmcp: &message,
+	}
+}
+
+// The theme is copied, since the player may change it while the connection uses it
+func DisplayOutput(player *absmachine.Player) *PlayerOutput {
+	return &PlayerOutput{
+		display: &displaySettings{
+			theme:       ansi.Theme(player.ColorTheme).Copy(),
+			splitScreen: player.SplitScreen,
+		},
+	}
+}
+
+// Text that isn't the answer to a command, e.g. a tell, which shows up while the player looks at a prompt
+func InterruptingOutput(text string) *PlayerOutput {
+	return &PlayerOutput{
+		text:             fmt.Sprintln(text),
+		interruptsPrompt: true,
+	}
+}
+
+func StatusOutput(status string) *PlayerOutput {
+	return &PlayerOutput{
+		status: status,
+	}
+}
+
+func JobOutput(job mudio.Job) *PlayerOutput {
+	return &PlayerOutput{
+		job: job,
+	}
+}
+
+func MsspOutput(variables []MsspVariable) *PlayerOutput {
+	return &PlayerOutput{
+		mssp: variables,
+	}
+}
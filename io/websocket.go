@@ -0,0 +1,532 @@
+package io
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/jorgensigvardsson/gomud/charset"
+	"github.com/jorgensigvardsson/gomud/logging"
+)
+
+// WebSockets (RFC 6455), so that players can play from a browser. A WebSocket connection is adapted to the
+// TelnetConnection interface: text frames carry lines (from the browser) and output (ANSI encoded, to the
+// browser), and binary frames carry JSON messages on a side channel, in both directions:
+//
+//	{"type": "echo", "on": false}                       Server: stop echoing what the player types (passwords)
+//	{"type": "prompt"}                                  Server: the output so far ends with a prompt
+//	{"type": "gmcp", "package": "Char.Vitals", "data": {...}}  Server: out-of-band data (GMCP)
+//	{"type": "size", "width": 80, "height": 24}         Browser: the size of the terminal
+//	{"type": "interrupt"}                               Browser: abort the command showing a prompt
+//	{"type": "gmcp", "package": "...", "data": {...}}   Browser: out-of-band data (GMCP)
+
+// The path of the WebSocket endpoint
+const WEBSOCKET_PATH = "/ws"
+
+// The client name of browser sessions, since browsers don't tell
+const WEBSOCKET_CLIENT_NAME = "WEBSOCKET"
+
+// Largest WebSocket message accepted from a browser (in bytes)
+const MAX_WEBSOCKET_MESSAGE = 16 * 1024
+
+// Appended to the key of the browser, and hashed, to prove that we speak WebSocket
+const WEBSOCKET_GUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Frame opcodes
+const (
+	WS_CONTINUATION = 0x0
+	WS_TEXT         = 0x1
+	WS_BINARY       = 0x2
+	WS_CLOSE        = 0x8
+	WS_PING         = 0x9
+	WS_PONG         = 0xa
+)
+
+// Close status codes
+const (
+	WS_CLOSE_NORMAL   = 1000
+	WS_CLOSE_PROTOCOL = 1002
+	WS_CLOSE_TOO_BIG  = 1009
+)
+
+// Frame header fields
+const (
+	WS_FIN_BIT            = 0x80
+	WS_RSV_BITS           = 0x70 // Reserved for extensions, and no extensions are negotiated
+	WS_MASK_BIT           = 0x80
+	WS_OPCODE_MASK        = 0x0f
+	WS_PAYLOAD_LENGTH_16  = 126 // The length follows in 16 bits
+	WS_PAYLOAD_LENGTH_64  = 127 // The length follows in 64 bits
+	WS_MAX_CONTROL_LENGTH = 125
+)
+
+var ErrWebSocketProtocol = errors.New("WebSocket protocol error")
+var ErrWebSocketMessageTooBig = errors.New("WebSocket message too big")
+var ErrWebSocketOriginNotAllowed = errors.New("WebSocket origin not allowed")
+
+// A message on the JSON side channel
+type webSocketMessage struct {
+	Type    string          `json:"type"`
+	On      *bool           `json:"on,omitempty"`
+	Package string          `json:"package,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Width   int             `json:"width,omitempty"`
+	Height  int             `json:"height,omitempty"`
+}
+
+// Serves browser sessions on an HTTP listener, until the listener is closed. Only web pages from `allowedOrigins`
+// (e.g. "https://play.example.com") may open sessions, or, if there are none, only pages served by the same host.
+func HandleWebSocketConnections(listener net.Listener, allowedOrigins []string, logger logging.Logger, commandChannel chan<- *PlayerInput, listenerErrorChannel chan<- error, connectionsStopChannel <-chan interface{}, detach *Detacher, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(WEBSOCKET_PATH, func(w http.ResponseWriter, r *http.Request) {
+		conn, reader, err := upgradeWebSocket(w, r, allowedOrigins)
+		if err != nil {
+			logger.Printlnf("Refused WebSocket connection from %v: %v", r.RemoteAddr, err)
+			return
+		}
+
+		handleWebSocketConnection(conn, reader, logger, commandChannel, connectionsStopChannel, detach, wg)
+	})
+
+	listenerErrorChannel <- http.Serve(listener, mux)
+}
+
+// Completes the WebSocket handshake, and takes over the connection from the HTTP server
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, allowedOrigins []string) (net.Conn, *bufio.Reader, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" ||
+		key == "" {
+		http.Error(w, "Expected a WebSocket handshake", http.StatusBadRequest)
+		return nil, nil, ErrWebSocketProtocol
+	}
+
+	// Otherwise any web page could open a session on behalf of a player, with their browser
+	if !isOriginAllowed(r.Header.Get("Origin"), r.Host, allowedOrigins) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return nil, nil, ErrWebSocketOriginNotAllowed
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSockets are not supported", http.StatusInternalServerError)
+		return nil, nil, errors.New("connection can't be hijacked")
+	}
+
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %v\r\n\r\n", webSocketAccept(key))
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	// The HTTP server may already have read the first frames
+	return conn, buffered.Reader, nil
+}
+
+// Tells if a web page from `origin` may open a session. Clients that aren't browsers don't tell their origin, and
+// aren't web pages anyone could be lured to.
+func isOriginAllowed(origin string, host string, allowedOrigins []string) bool {
+	if origin == "" {
+		return true
+	}
+
+	if len(allowedOrigins) == 0 {
+		originUrl, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(originUrl.Host, host)
+	}
+
+	for _, allowedOrigin := range allowedOrigins {
+		if strings.EqualFold(origin, allowedOrigin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tells if a comma separated header has a token, regardless of case
+func headerContains(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func webSocketAccept(key string) string {
+	hash := sha1.Sum([]byte(key + WEBSOCKET_GUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+type implWebSocketConnection struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	observer TelnetConnectionObserver
+	logger   logging.Logger
+	lock     sync.Mutex // Protects writes, and the echo state
+	echoOff  bool
+	pending  []byte // What is left of the last text message, read a byte at a time
+	closed   bool
+}
+
+func NewWebSocketConnection(conn net.Conn, reader *bufio.Reader, observer TelnetConnectionObserver, logger logging.Logger) TelnetConnection {
+	return &implWebSocketConnection{
+		conn:     conn,
+		reader:   reader,
+		observer: observer,
+		logger:   logger,
+	}
+}
+
+func (wsconn *implWebSocketConnection) ReadLine() (line string, err error) {
+	return readEditedLine(wsconn.readByte, func() charset.Charset { return charset.UTF8 })
+}
+
+// Reads the next byte of a line. Every text message ends a line, and messages on the side channel are handled
+// in between.
+func (wsconn *implWebSocketConnection) readByte() (byte, error) {
+	for len(wsconn.pending) == 0 {
+		opcode, payload, err := wsconn.readMessage()
+		if err != nil {
+			return 0, err
+		}
+
+		if opcode == WS_TEXT {
+			wsconn.pending = payload
+			if !bytes.HasSuffix(payload, []byte{'\n'}) {
+				wsconn.pending = append(wsconn.pending, '\n')
+			}
+		} else if wsconn.sideChannelMessageReceived(payload) {
+			return CTRL_C, nil
+		}
+	}
+
+	b := wsconn.pending[0]
+	wsconn.pending = wsconn.pending[1:]
+	return b, nil
+}
+
+// Handles a message on the side channel, and tells if it interrupts the line
+func (wsconn *implWebSocketConnection) sideChannelMessageReceived(payload []byte) bool {
+	var message webSocketMessage
+	if err := json.Unmarshal(payload, &message); err != nil {
+		wsconn.logger.Printlnf("Invalid WebSocket side channel message: %v", err)
+		return false
+	}
+
+	switch message.Type {
+	case "interrupt":
+		return true
+	case "size":
+		// Told the observer as if it was a NAWS subnegotiation
+		size := make([]byte, 4)
+		binary.BigEndian.PutUint16(size, uint16(message.Width))
+		binary.BigEndian.PutUint16(size[2:], uint16(message.Height))
+		wsconn.observer.SubnegotiationReceived(Subnegotiation{Option: NAWS, Payload: size})
+	case "gmcp":
+		wsconn.observer.SubnegotiationReceived(Subnegotiation{Option: GMCP, Payload: append([]byte(message.Package+" "), message.Data...)})
+	default:
+		wsconn.logger.Printlnf("Unknown WebSocket side channel message: %v", message.Type)
+	}
+
+	return false
+}
+
+// Reads a complete text or binary message, which may be split into several frames. Pings are answered, and a
+// close frame is answered and ends the connection (io.EOF).
+func (wsconn *implWebSocketConnection) readMessage() (opcode byte, message []byte, err error) {
+	for {
+		fin, frameOpcode, payload, err := wsconn.readFrame()
+		if err != nil {
+			wsconn.failConnection(err)
+			return 0, nil, err
+		}
+
+		switch frameOpcode {
+		case WS_PING:
+			wsconn.writeFrame(WS_PONG, payload)
+			continue
+		case WS_PONG:
+			continue
+		case WS_CLOSE:
+			wsconn.writeClose(WS_CLOSE_NORMAL)
+			return 0, nil, io.EOF
+		case WS_CONTINUATION:
+			if opcode == 0 {
+				wsconn.failConnection(ErrWebSocketProtocol)
+				return 0, nil, ErrWebSocketProtocol
+			}
+		case WS_TEXT, WS_BINARY:
+			if opcode != 0 {
+				// A new message before the last one was complete
+				wsconn.failConnection(ErrWebSocketProtocol)
+				return 0, nil, ErrWebSocketProtocol
+			}
+			opcode = frameOpcode
+		default:
+			wsconn.failConnection(ErrWebSocketProtocol)
+			return 0, nil, ErrWebSocketProtocol
+		}
+
+		if len(message)+len(payload) > MAX_WEBSOCKET_MESSAGE {
+			wsconn.failConnection(ErrWebSocketMessageTooBig)
+			return 0, nil, ErrWebSocketMessageTooBig
+		}
+		message = append(message, payload...)
+
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// Reads a frame from the browser, and unmasks its payload
+func (wsconn *implWebSocketConnection) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(wsconn.reader, header[:]); err != nil {
+		return
+	}
+
+	fin = header[0]&WS_FIN_BIT != 0
+	opcode = header[0] & WS_OPCODE_MASK
+	if header[0]&WS_RSV_BITS != 0 {
+		return false, 0, nil, ErrWebSocketProtocol
+	}
+
+	if header[1]&WS_MASK_BIT == 0 {
+		// Frames from browsers must be masked
+		return false, 0, nil, ErrWebSocketProtocol
+	}
+
+	length := uint64(header[1] &^ WS_MASK_BIT)
+	switch length {
+	case WS_PAYLOAD_LENGTH_16:
+		var extended [2]byte
+		if _, err = io.ReadFull(wsconn.reader, extended[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case WS_PAYLOAD_LENGTH_64:
+		var extended [8]byte
+		if _, err = io.ReadFull(wsconn.reader, extended[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+
+	if opcode >= WS_CLOSE && (length > WS_MAX_CONTROL_LENGTH || !fin) {
+		return false, 0, nil, ErrWebSocketProtocol
+	}
+
+	if length > MAX_WEBSOCKET_MESSAGE {
+		return false, 0, nil, ErrWebSocketMessageTooBig
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(wsconn.reader, mask[:]); err != nil {
+		return
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(wsconn.reader, payload); err != nil {
+		return
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// Tells the browser why the connection is closed, if it broke the protocol
+func (wsconn *implWebSocketConnection) failConnection(err error) {
+	switch err {
+	case ErrWebSocketProtocol:
+		wsconn.writeClose(WS_CLOSE_PROTOCOL)
+	case ErrWebSocketMessageTooBig:
+		wsconn.writeClose(WS_CLOSE_TOO_BIG)
+	}
+}
+
+func (wsconn *implWebSocketConnection) writeClose(status uint16) error {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, status)
+	return wsconn.writeFrame(WS_CLOSE, payload)
+}
+
+// Writes an unfragmented, unmasked frame
+func (wsconn *implWebSocketConnection) writeFrame(opcode byte, payload []byte) error {
+	wsconn.lock.Lock()
+	defer wsconn.lock.Unlock()
+
+	return wsconn.writeFrameNoLock(opcode, payload)
+}
+
+func (wsconn *implWebSocketConnection) writeFrameNoLock(opcode byte, payload []byte) error {
+	if wsconn.closed {
+		return net.ErrClosed
+	}
+
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, WS_FIN_BIT|opcode)
+
+	switch {
+	case len(payload) < WS_PAYLOAD_LENGTH_16:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, WS_PAYLOAD_LENGTH_16, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	default:
+		frame = append(frame, WS_PAYLOAD_LENGTH_64, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(payload)))
+	}
+
+	_, err := wsconn.conn.Write(append(frame, payload...))
+	return err
+}
+
+func (wsconn *implWebSocketConnection) writeSideChannelMessage(message webSocketMessage) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return wsconn.writeFrame(WS_BINARY, payload)
+}
+
+func (wsconn *implWebSocketConnection) WriteLine(line string) error {
+	return wsconn.WriteString(line + "\n")
+}
+
+func (wsconn *implWebSocketConnection) WriteLinef(line string, args ...interface{}) error {
+	if len(args) == 0 {
+		return wsconn.WriteLine(line)
+	}
+
+	return wsconn.WriteLine(fmt.Sprintf(line, args...))
+}
+
+// Writes text as a text message. New lines are sent as CR LF, like over telnet, since browser terminals need them.
+func (wsconn *implWebSocketConnection) WriteString(text string) error {
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n")
+	return wsconn.writeFrame(WS_TEXT, []byte(strings.ToValidUTF8(text, string(utf8.RuneError))))
+}
+
+func (wsconn *implWebSocketConnection) WriteStringf(text string, args ...interface{}) error {
+	if len(args) == 0 {
+		return wsconn.WriteString(text)
+	}
+
+	return wsconn.WriteString(fmt.Sprintf(text, args...))
+}
+
+func (wsconn *implWebSocketConnection) EchoOff() error {
+	return wsconn.setEcho(false)
+}
+
+func (wsconn *implWebSocketConnection) EchoOn() error {
+	return wsconn.setEcho(true)
+}
+
+func (wsconn *implWebSocketConnection) setEcho(on bool) error {
+	wsconn.lock.Lock()
+	changed := wsconn.echoOff == on
+	wsconn.echoOff = !on
+	wsconn.lock.Unlock()
+
+	if !changed {
+		return nil
+	}
+
+	return wsconn.writeSideChannelMessage(webSocketMessage{Type: "echo", On: &on})
+}
+
+func (wsconn *implWebSocketConnection) Close() error {
+	wsconn.lock.Lock()
+	defer wsconn.lock.Unlock()
+
+	if wsconn.closed {
+		return nil
+	}
+
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, WS_CLOSE_NORMAL)
+	wsconn.writeFrameNoLock(WS_CLOSE, payload)
+	wsconn.closed = true
+
+	return wsconn.conn.Close()
+}
+
+// Browsers tell the size of the terminal on their own, and everything else is known up front, so there is
+// nothing to negotiate
+func (wsconn *implWebSocketConnection) QueryTerminal() error    { return nil }
+func (wsconn *implWebSocketConnection) QueryWindowSize() error  { return nil }
+func (wsconn *implWebSocketConnection) OfferCompression() error { return nil }
+func (wsconn *implWebSocketConnection) OfferGmcp() error        { return nil }
+func (wsconn *implWebSocketConnection) OfferMssp() error        { return nil }
+func (wsconn *implWebSocketConnection) OfferCharset() error     { return nil }
+func (wsconn *implWebSocketConnection) OfferEndOfRecord() error { return nil }
+
+func (wsconn *implWebSocketConnection) MarkPrompt() error {
+	return wsconn.writeSideChannelMessage(webSocketMessage{Type: "prompt"})
+}
+
+// Only GMCP messages ("<package> <JSON data>") have a place on the side channel; other subnegotiations are dropped
+func (wsconn *implWebSocketConnection) WriteSubnegotiation(option byte, payload []byte) error {
+	if option != GMCP {
+		return nil
+	}
+
+	message := webSocketMessage{Type: "gmcp", Package: string(payload)}
+	if i := bytes.IndexByte(payload, ' '); i >= 0 {
+		message.Package = string(payload[:i])
+		message.Data = payload[i+1:]
+	}
+
+	return wsconn.writeSideChannelMessage(message)
+}
+
+// GMCP is always available on the side channel, and echo is whatever the server asked for last
+func (wsconn *implWebSocketConnection) IsLocalOptionEnabled(option byte) bool {
+	wsconn.lock.Lock()
+	defer wsconn.lock.Unlock()
+
+	switch option {
+	case GMCP:
+		return true
+	case ECHO:
+		return wsconn.echoOff
+	default:
+		return false
+	}
+}
+
+func (wsconn *implWebSocketConnection) IsRemoteOptionEnabled(option byte) bool {
+	return false
+}
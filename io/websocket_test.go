@@ -0,0 +1,285 @@
+package io
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jorgensigvardsson/gomud/logging"
+)
+
+// A connection that only records what is written to it
+type writeRecordingConn struct {
+	net.Conn
+	written bytes.Buffer
+	closed  bool
+}
+
+func (conn *writeRecordingConn) Write(b []byte) (int, error) {
+	return conn.written.Write(b)
+}
+
+func (conn *writeRecordingConn) Close() error {
+	conn.closed = true
+	return nil
+}
+
+// Builds a frame the way browsers do, with a masked payload
+func maskedFrame(fin bool, opcode byte, payload string) []byte {
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	header := opcode
+	if fin {
+		header |= WS_FIN_BIT
+	}
+
+	frame := []byte{header}
+	if len(payload) < WS_PAYLOAD_LENGTH_16 {
+		frame = append(frame, WS_MASK_BIT|byte(len(payload)))
+	} else {
+		frame = append(frame, WS_MASK_BIT|WS_PAYLOAD_LENGTH_16, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	}
+	frame = append(frame, mask...)
+
+	for i := 0; i < len(payload); i++ {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+
+	return frame
+}
+
+func newTestWebSocketConnection(frames ...[]byte) (*implWebSocketConnection, *writeRecordingConn, *SpyingTelnetObserver) {
+	conn := &writeRecordingConn{}
+	observer := &SpyingTelnetObserver{}
+	wsconn := NewWebSocketConnection(conn, bufio.NewReader(bytes.NewReader(bytes.Join(frames, nil))), observer, logging.NewNullLogger())
+	return wsconn.(*implWebSocketConnection), conn, observer
+}
+
+func Test_webSocketAccept(t *testing.T) {
+	// The example of RFC 6455
+	if accept := webSocketAccept("dGhlIHNhbXBsZSBub25jZQ=="); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Unexpected accept key: %v", accept)
+	}
+}
+
+func Test_upgradeWebSocket_NotAWebSocketHandshake_Refused(t *testing.T) {
+	recorder := httptest.NewRecorder()
+
+	_, _, err := upgradeWebSocket(recorder, httptest.NewRequest(http.MethodGet, WEBSOCKET_PATH, nil), nil)
+
+	if err != ErrWebSocketProtocol || recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected the request to be refused, but got %v (status %v)", err, recorder.Code)
+	}
+}
+
+func Test_upgradeWebSocket_ForeignOrigin_Refused(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "http://mud.example.com"+WEBSOCKET_PATH, nil)
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	request.Header.Set("Origin", "https://evil.example.com")
+
+	_, _, err := upgradeWebSocket(recorder, request, nil)
+
+	if err != ErrWebSocketOriginNotAllowed || recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected the request to be refused, but got %v (status %v)", err, recorder.Code)
+	}
+}
+
+func Test_isOriginAllowed(t *testing.T) {
+	tests := []struct {
+		origin         string
+		allowedOrigins []string
+		allowed        bool
+	}{
+		{"", nil, true},
+		{"http://mud.example.com", nil, true},
+		{"https://MUD.example.com", nil, true},
+		{"https://evil.example.com", nil, false},
+		{"http://mud.example.com:8080", nil, false},
+		{"https://play.example.com", []string{"https://play.example.com"}, true},
+		{"http://mud.example.com", []string{"https://play.example.com"}, false},
+		{"not a url\x7f", nil, false},
+	}
+
+	for _, test := range tests {
+		if allowed := isOriginAllowed(test.origin, "mud.example.com", test.allowedOrigins); allowed != test.allowed {
+			t.Errorf("Origin %q allowed by %v: expected %v, but got %v", test.origin, test.allowedOrigins, test.allowed, allowed)
+		}
+	}
+}
+
+func Test_WebSocket_ReadLine_EveryTextMessageIsALine(t *testing.T) {
+	wsconn, _, _ := newTestWebSocketConnection(maskedFrame(true, WS_TEXT, "look"), maskedFrame(true, WS_TEXT, "say hi\r\n"))
+
+	first, err1 := wsconn.ReadLine()
+	second, err2 := wsconn.ReadLine()
+
+	if first != "look" || second != "say hi" || err1 != nil || err2 != nil {
+		t.Errorf("Unexpected lines %q (%v) and %q (%v)", first, err1, second, err2)
+	}
+}
+
+func Test_WebSocket_ReadLine_FragmentedMessage_PingAnsweredInBetween(t *testing.T) {
+	wsconn, conn, _ := newTestWebSocketConnection(
+		maskedFrame(false, WS_TEXT, "lo"),
+		maskedFrame(true, WS_PING, "are you there"),
+		maskedFrame(true, WS_CONTINUATION, "ok"),
+	)
+
+	line, err := wsconn.ReadLine()
+
+	if line != "look" || err != nil {
+		t.Errorf("Unexpected line %q (%v)", line, err)
+	}
+
+	pong := append([]byte{WS_FIN_BIT | WS_PONG, 13}, "are you there"...)
+	if !bytes.Equal(pong, conn.written.Bytes()) {
+		t.Errorf("Expected a pong, but got %v", conn.written.Bytes())
+	}
+}
+
+func Test_WebSocket_ReadLine_SizeMessage_ToldAsWindowSize(t *testing.T) {
+	wsconn, _, observer := newTestWebSocketConnection(
+		maskedFrame(true, WS_BINARY, `{"type": "size", "width": 120, "height": 40}`),
+		maskedFrame(true, WS_TEXT, "look"),
+	)
+
+	wsconn.ReadLine()
+
+	if len(observer.subnegotiationsSeen) != 1 {
+		t.Fatalf("Expected one subnegotiation, but saw %v", observer.subnegotiationsSeen)
+	}
+
+	width, height, ok := parseWindowSize(observer.subnegotiationsSeen[0].Payload)
+	if observer.subnegotiationsSeen[0].Option != NAWS || !ok || width != 120 || height != 40 {
+		t.Errorf("Unexpected subnegotiation: %v", observer.subnegotiationsSeen[0])
+	}
+}
+
+func Test_WebSocket_ReadLine_InterruptMessage_Interrupted(t *testing.T) {
+	wsconn, _, _ := newTestWebSocketConnection(maskedFrame(true, WS_BINARY, `{"type": "interrupt"}`))
+
+	_, err := wsconn.ReadLine()
+
+	if err != ErrInterrupted {
+		t.Errorf("Expected ErrInterrupted, but got %v", err)
+	}
+}
+
+func Test_WebSocket_ReadLine_CloseFrame_AnsweredAndEndOfFile(t *testing.T) {
+	wsconn, conn, _ := newTestWebSocketConnection(maskedFrame(true, WS_CLOSE, ""))
+
+	_, err := wsconn.ReadLine()
+
+	if err != io.EOF {
+		t.Errorf("Expected io.EOF, but got %v", err)
+	}
+
+	if !bytes.Equal([]byte{WS_FIN_BIT | WS_CLOSE, 2, 0x03, 0xe8}, conn.written.Bytes()) {
+		t.Errorf("Expected a close frame, but got %v", conn.written.Bytes())
+	}
+}
+
+func Test_WebSocket_ReadLine_UnmaskedFrame_ProtocolError(t *testing.T) {
+	wsconn, conn, _ := newTestWebSocketConnection([]byte{WS_FIN_BIT | WS_TEXT, 2, 'h', 'i'})
+
+	_, err := wsconn.ReadLine()
+
+	if err != ErrWebSocketProtocol {
+		t.Errorf("Expected ErrWebSocketProtocol, but got %v", err)
+	}
+
+	if !bytes.Equal([]byte{WS_FIN_BIT | WS_CLOSE, 2, 0x03, 0xea}, conn.written.Bytes()) {
+		t.Errorf("Expected a close frame, but got %v", conn.written.Bytes())
+	}
+}
+
+func Test_WebSocket_ReadLine_ReservedBitSet_ProtocolError(t *testing.T) {
+	frame := maskedFrame(true, WS_TEXT, "hi")
+	frame[0] |= 0x40 // RSV1, which compression would use, had it been negotiated
+	wsconn, conn, _ := newTestWebSocketConnection(frame)
+
+	_, err := wsconn.ReadLine()
+
+	if err != ErrWebSocketProtocol {
+		t.Errorf("Expected ErrWebSocketProtocol, but got %v", err)
+	}
+
+	if !bytes.Equal([]byte{WS_FIN_BIT | WS_CLOSE, 2, 0x03, 0xea}, conn.written.Bytes()) {
+		t.Errorf("Expected a close frame, but got %v", conn.written.Bytes())
+	}
+}
+
+func Test_WebSocket_WriteLine_TextFrameWithCrLf(t *testing.T) {
+	wsconn, conn, _ := newTestWebSocketConnection()
+
+	wsconn.WriteLine("Hello\nWorld")
+
+	expected := append([]byte{WS_FIN_BIT | WS_TEXT, 14}, "Hello\r\nWorld\r\n"...)
+	if !bytes.Equal(expected, conn.written.Bytes()) {
+		t.Errorf("Unexpected frame %q", conn.written.Bytes())
+	}
+}
+
+func Test_WebSocket_WriteString_LongText_16BitLength(t *testing.T) {
+	wsconn, conn, _ := newTestWebSocketConnection()
+
+	wsconn.WriteString(string(bytes.Repeat([]byte{'x'}, 300)))
+
+	if !bytes.Equal([]byte{WS_FIN_BIT | WS_TEXT, WS_PAYLOAD_LENGTH_16, 1, 44}, conn.written.Bytes()[:4]) || conn.written.Len() != 304 {
+		t.Errorf("Unexpected frame header %v (frame length %v)", conn.written.Bytes()[:4], conn.written.Len())
+	}
+}
+
+func Test_WebSocket_EchoOff_ToldOnSideChannelOnce(t *testing.T) {
+	wsconn, conn, _ := newTestWebSocketConnection()
+
+	wsconn.EchoOff()
+	wsconn.EchoOff()
+
+	payload := `{"type":"echo","on":false}`
+	expected := append([]byte{WS_FIN_BIT | WS_BINARY, byte(len(payload))}, payload...)
+	if !bytes.Equal(expected, conn.written.Bytes()) {
+		t.Errorf("Unexpected frames %q", conn.written.Bytes())
+	}
+
+	if !wsconn.IsLocalOptionEnabled(ECHO) {
+		t.Error("Expected echo to be on our side")
+	}
+}
+
+func Test_WebSocket_WriteSubnegotiation_GmcpSentAsJson(t *testing.T) {
+	wsconn, conn, _ := newTestWebSocketConnection()
+
+	wsconn.WriteSubnegotiation(GMCP, []byte(`Char.Vitals {"hp":10}`))
+	wsconn.WriteSubnegotiation(MSSP, []byte{MSSP_VAR, 'X'})
+
+	payload := `{"type":"gmcp","package":"Char.Vitals","data":{"hp":10}}`
+	expected := append([]byte{WS_FIN_BIT | WS_BINARY, byte(len(payload))}, payload...)
+	if !bytes.Equal(expected, conn.written.Bytes()) {
+		t.Errorf("Unexpected frames %q", conn.written.Bytes())
+	}
+}
+
+func Test_WebSocket_Close_CloseFrameWritten(t *testing.T) {
+	wsconn, conn, _ := newTestWebSocketConnection()
+
+	wsconn.Close()
+	err := wsconn.WriteString("too late")
+
+	if !conn.closed || !bytes.Equal([]byte{WS_FIN_BIT | WS_CLOSE, 2, 0x03, 0xe8}, conn.written.Bytes()) {
+		t.Errorf("Expected a close frame and the connection closed, but got %v", conn.written.Bytes())
+	}
+
+	if err != net.ErrClosed {
+		t.Errorf("Expected net.ErrClosed, but got %v", err)
+	}
+}
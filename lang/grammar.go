@@ -5,11 +5,13 @@ import (
 	"unicode/utf8"
 
 	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/charset"
 )
 
+// Tells if a letter is a vowel, regardless of case and accents (so 'É' and 'å' are vowels)
 func IsVowel(r rune) bool {
-	switch r {
-	case 'a', 'e', 'i', 'o', 'u':
+	switch charset.Fold(string(r)) {
+	case "a", "e", "i", "o", "u", "ae", "oe":
 		return true
 	default:
 		return false
@@ -49,3 +51,18 @@ func DirectionName(direction absmachine.Direction) string {
 		panic(fmt.Sprintf("Unknown direction %v", direction))
 	}
 }
+
+func ClassName(class absmachine.PlayerClass) string {
+	switch class {
+	case absmachine.PC_Warrior:
+		return "Warrior"
+	case absmachine.PC_Thief:
+		return "Thief"
+	case absmachine.PC_Cleric:
+		return "Cleric"
+	case absmachine.PC_Wizard:
+		return "Wizard"
+	default:
+		panic(fmt.Sprintf("Unknown class %v", class))
+	}
+}
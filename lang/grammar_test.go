@@ -0,0 +1,23 @@
+package lang
+
+import "testing"
+
+func Test_IndefiniteArticleFor(t *testing.T) {
+	testCases := map[string]string{
+		"spider": "a",
+		"apple":  "an",
+		"Orc":    "an",
+		"Élan":   "an",
+		"ætt":    "an",
+		"Øre":    "an",
+		"Ödla":   "an",
+		"Ñu":     "a",
+		"":       "a",
+	}
+
+	for noun, expected := range testCases {
+		if result := IndefiniteArticleFor(noun); result != expected {
+			t.Errorf("Expected %q for %q, but got %q", expected, noun, result)
+		}
+	}
+}
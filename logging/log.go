@@ -98,7 +98,7 @@ func (log *nullLogger) Close() {
 
 func (log *composableLogger) Println(args ...interface{}) {
 	for _, v := range log.loggers {
-		v.Println(args)
+		v.Println(args...)
 	}
 }
 
@@ -1,91 +1,210 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"math/rand"
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/circle"
+	"github.com/jorgensigvardsson/gomud/config"
 	"github.com/jorgensigvardsson/gomud/io"
 	"github.com/jorgensigvardsson/gomud/logging"
+	"github.com/jorgensigvardsson/gomud/persistence"
+	"golang.org/x/crypto/ssh"
 )
 
 const TICK = 100 * time.Millisecond
 const MAX_USER_LIMIT = 100
 const MAX_PLAYER_INPUT_QUEUE_LIMIT = 20
 
-func buildWorld() *absmachine.World {
-	world := absmachine.NewWorld()
+func loadConfig(path string, logger logging.Logger) *config.Config {
+	cfg, err := config.Load(path)
 
-	entryRoom := absmachine.NewRoom()
-	entryRoom.Title = "The entry room"
-	entryRoom.Description = "You are in the starting room of this MUD.\r\nThere are creepy spiders and insects everywhere! RUN!"
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Printlnf("No configuration file %v found, using defaults.", path)
+		return config.Default()
+	} else if err != nil {
+		panic(fmt.Sprintf("Failed to load configuration file %v: %v", path, err))
+	}
+
+	return cfg
+}
 
-	peacefulRoom := absmachine.NewRoom()
-	peacefulRoom.Title = "The peaceful room"
-	peacefulRoom.Description = "A peaceful room. Cows and elephants are roaming the vast grassfield that continues to the north."
+// Builds the world from the area files, and restores the state saved in the snapshot at the last shutdown, if there is
+// one. Players in the snapshot are only kept after a copyover, when their connections are handed over.
+func loadWorld(cfg *config.Config, keepPlayers bool, logger logging.Logger) *absmachine.World {
+	var world *absmachine.World
+	var err error
 
-	err := entryRoom.ConnectDuplex(peacefulRoom, absmachine.DIR_NORTH)
+	areasDirectory := cfg.AreasDirectory
+	if cfg.CircleAreasDirectory != "" {
+		areasDirectory = cfg.CircleAreasDirectory
+
+		world, err = circle.ImportDirectory(cfg.CircleAreasDirectory, cfg.CircleStartRoom)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to import CircleMUD areas:\n%v", err))
+		}
+	} else {
+		world, err = persistence.LoadAreas(cfg.AreasDirectory)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to load areas: %v", err))
+		}
+	}
+
+	snapshotInfo, err := os.Stat(cfg.WorldSnapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Printlnf("No world snapshot %v found, the world is as the areas in %v describe it.", cfg.WorldSnapshotPath, areasDirectory)
+		return world
+	} else if err != nil {
+		panic(fmt.Sprintf("Failed to load world snapshot %v: %v", cfg.WorldSnapshotPath, err))
+	}
+
+	// The areas place the mobs and objects, so if they have been edited since the snapshot was saved, their placements win
+	areasChanged, err := changedSince(areasDirectory, snapshotInfo.ModTime())
 	if err != nil {
-		panic(err)
-	}
-
-	mob1 := absmachine.NewMob()
-	mob1.Name = "Angry Spider"
-	mob1.Description = "The hairy 8 legged beast is angry!"
-	mob1.RoomDescription = "An angry spider is looking straight at you with all of its eyes!"
-	mob1.Actions = append(
-		mob1.Actions,
-		absmachine.MobAction{
-			PeriodLength: 20,
-			Probability:  0.1,
-			Function: &absmachine.SimpleVerbMobAction{
-				Verb:        "jumping",
-				Preposition: "around",
-			},
-		},
-	)
+		panic(fmt.Sprintf("Failed to check the areas in %v for changes: %v", areasDirectory, err))
+	}
+
+	if areasChanged {
+		logger.Printlnf("The areas in %v have changed since the world snapshot %v was saved, mobs and objects are placed anew.", areasDirectory, cfg.WorldSnapshotPath)
+	}
 
-	world.AddMobs([]*absmachine.Mob{mob1})
-	world.AddRooms([]*absmachine.Room{entryRoom, peacefulRoom})
+	err = persistence.RestoreWorld(world, cfg.WorldSnapshotPath, !areasChanged)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to load world snapshot %v: %v", cfg.WorldSnapshotPath, err))
+	}
 
-	mob1.RelocateToRoom(entryRoom)
-	world.StartRoom = entryRoom
+	// Nobody is connected right after startup, so players in the snapshot (of a failed copyover) can't stay in the world
+	if !keepPlayers {
+		for _, player := range append([]*absmachine.Player(nil), world.Players...) {
+			absmachine.DestroyPlayer(player)
+		}
+	}
 
+	logger.Printlnf("World state restored from %v.", cfg.WorldSnapshotPath)
 	return world
 }
 
+// Tells if any file in a directory (or its subdirectories) has been modified after a point in time
+func changedSince(directory string, since time.Time) (bool, error) {
+	changed := false
+
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() && info.ModTime().After(since) {
+			changed = true
+		}
+		return nil
+	})
+
+	return changed, err
+}
+
 func main() {
+	configPath := flag.String("config", "gomud.json", "Path to configuration file")
+	copyoverStatePath := flag.String("copyover", "", "Path to the state handed over by the previous process in a copyover (used internally)")
+	flag.Parse()
+
 	// Make sure we seed the RNG
 	rand.Seed(time.Now().UnixNano())
 
-	world := buildWorld()
 	logger := logging.NewTimestampLoggerDecorator(
 		logging.NewSynchronizingLoggerDecorator(
 			logging.NewConsoleLogger(),
 			50,
 		),
 	)
-	inputQueue := io.NewInputQueue(MAX_USER_LIMIT, MAX_PLAYER_INPUT_QUEUE_LIMIT, logger)
+	cfg := loadConfig(*configPath, logger)
+
+	var copyoverState *io.CopyoverState
+	if *copyoverStatePath != "" {
+		var err error
+		copyoverState, err = io.LoadCopyoverState(*copyoverStatePath)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to recover from copyover: %v", err))
+		}
+		os.Remove(*copyoverStatePath)
+	}
+
+	world := loadWorld(cfg, copyoverState != nil, logger)
+
+	accounts, err := persistence.NewFileAccountStore(cfg.AccountsDirectory)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to open account store in %v: %v", cfg.AccountsDirectory, err))
+	}
+
+	inputQueue := io.NewInputQueue(MAX_USER_LIMIT, MAX_PLAYER_INPUT_QUEUE_LIMIT, accounts, cfg, logger)
+	if copyoverState != nil {
+		inputQueue.SetStartTime(time.Unix(copyoverState.StartTime, 0))
+	}
 	commandChannel := make(chan *io.PlayerInput, MAX_USER_LIMIT*MAX_PLAYER_INPUT_QUEUE_LIMIT)
-	sigtermChannel := make(chan os.Signal)
+	sigtermChannel := make(chan os.Signal, 1)
 	connectionsStopChannel := make(chan interface{})
-	listenerErrorChannel := make(chan error, 1)
+	listenerErrorChannel := make(chan error, 4) // One error from each listener, when they are closed
+	detacher := io.NewDetacher(MAX_USER_LIMIT)
 	workGroup := sync.WaitGroup{}
 
 	defer close(commandChannel)
 	defer close(sigtermChannel)
 	defer logger.Close()
 
-	logger.Println("Starting up Go MUD on port 5000...")
-	listener, err := net.Listen("tcp", ":5000")
+	var listener net.Listener
+	if copyoverState != nil {
+		logger.Println("Recovering Go MUD after copyover...")
+		listener, err = recoverListener(copyoverState)
+	} else {
+		logger.Printlnf("Starting up Go MUD on port %v...", cfg.Port)
+		listener, err = net.Listen("tcp", fmt.Sprintf(":%v", cfg.Port))
+	}
 
 	if err != nil {
-		panic("Failed to open TCP port 5000")
+		panic(fmt.Sprintf("Failed to open TCP port %v", cfg.Port))
+	}
+
+	// The encrypted, WebSocket and SSH listeners are not handed over in a copyover, since they are cheap to open again
+	var tlsListener net.Listener
+	if cfg.TlsPort != 0 {
+		logger.Printlnf("Listening for encrypted connections on port %v...", cfg.TlsPort)
+		tlsListener, err = io.ListenTls(cfg.TlsPort, cfg.TlsCertificate, cfg.TlsKey, cfg.TlsSelfSigned, logger)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to open TLS port %v: %v", cfg.TlsPort, err))
+		}
+	}
+
+	var webSocketListener net.Listener
+	if cfg.WebSocketPort != 0 {
+		logger.Printlnf("Listening for browser connections on port %v...", cfg.WebSocketPort)
+		webSocketListener, err = net.Listen("tcp", fmt.Sprintf(":%v", cfg.WebSocketPort))
+		if err != nil {
+			panic(fmt.Sprintf("Failed to open WebSocket port %v: %v", cfg.WebSocketPort, err))
+		}
+	}
+
+	var sshListener net.Listener
+	var sshConfig *ssh.ServerConfig
+	if cfg.SshPort != 0 {
+		logger.Printlnf("Listening for SSH connections on port %v...", cfg.SshPort)
+		sshConfig, err = io.NewSshServerConfig(cfg.SshHostKey, accounts, logger)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to set up SSH with host key %v: %v", cfg.SshHostKey, err))
+		}
+
+		sshListener, err = net.Listen("tcp", fmt.Sprintf(":%v", cfg.SshPort))
+		if err != nil {
+			panic(fmt.Sprintf("Failed to open SSH port %v: %v", cfg.SshPort, err))
+		}
 	}
 
 	// Setup SIGTERM handler
@@ -93,7 +212,20 @@ func main() {
 	logger.Println("Stop server with Ctrl+C (SIGTERM)")
 
 	// Spin off in a go routine to handle connections
-	go io.HandleConnections(listener, logger, commandChannel, listenerErrorChannel, connectionsStopChannel, &workGroup)
+	go io.HandleConnections(listener, logger, commandChannel, listenerErrorChannel, connectionsStopChannel, detacher, &workGroup)
+	if tlsListener != nil {
+		go io.HandleConnections(tlsListener, logger, commandChannel, listenerErrorChannel, connectionsStopChannel, detacher, &workGroup)
+	}
+	if webSocketListener != nil {
+		go io.HandleWebSocketConnections(webSocketListener, cfg.WebSocketAllowedOrigins, logger, commandChannel, listenerErrorChannel, connectionsStopChannel, detacher, &workGroup)
+	}
+	if sshListener != nil {
+		go io.HandleSshConnections(sshListener, sshConfig, logger, commandChannel, listenerErrorChannel, connectionsStopChannel, detacher, &workGroup)
+	}
+
+	if copyoverState != nil {
+		reattachSessions(copyoverState, world, logger, commandChannel, connectionsStopChannel, detacher, &workGroup)
+	}
 
 	// The game loop!
 	run := true
@@ -104,6 +236,11 @@ func main() {
 		inputQueue.Execute(world, tick)
 		handleCommandsT1 := time.Now().UTC()
 
+		if inputQueue.CopyoverRequested() {
+			logger.Println("Copyover...")
+			break
+		}
+
 		// Remove the delta from the TICK length
 		timeToSleep := TICK - handleCommandsT0.Sub(handleCommandsT1)
 		timeToWakeup := handleCommandsT1.Add(timeToSleep)
@@ -130,18 +267,58 @@ func main() {
 		tick++
 	}
 
+	// A copyover hands the listening socket over to the next process, so it must outlive the listener
+	copyover := inputQueue.CopyoverRequested()
+	var listenerFile *os.File
+	if copyover {
+		listenerFile, err = listener.(*net.TCPListener).File()
+		if err != nil {
+			logger.Printlnf("Copyover failed, the listener can't be handed over: %v", err)
+			copyover = false
+		}
+	}
+
 	// Shut everything down!
 	listener.Close()
+	if tlsListener != nil {
+		tlsListener.Close()
+	}
+	if webSocketListener != nil {
+		webSocketListener.Close()
+	}
+	if sshListener != nil {
+		sshListener.Close()
+	}
 
-	// Terminate all connected
-	close(connectionsStopChannel)
+	var sessions []*io.DetachedSession
+	if copyover {
+		// Detach the connections of all players, and wait for all go routines to stop
+		sessions = detacher.Detach(&workGroup)
+	} else {
+		// Terminate all connected
+		close(connectionsStopChannel)
 
-	// Wait for all go routines to stop
-	workGroup.Wait()
+		// Wait for all go routines to stop
+		workGroup.Wait()
+	}
 
 	// Now we're no longer accepting new connections, and all existing sessions have been closed
+	inputQueue.SaveAllPlayers(world)
+
+	err = persistence.SaveWorld(world, cfg.WorldSnapshotPath, copyover)
+	if err != nil {
+		logger.Printlnf("Failed to save world snapshot %v: %v", cfg.WorldSnapshotPath, err)
+	}
+
+	if copyover {
+		err = execCopyover(cfg, *configPath, listenerFile, sessions, inputQueue.StartTime())
 
-	// TODO: Serialize current state of world!
+		// Still here? Then the copyover failed, and the players are dropped
+		logger.Printlnf("Copyover failed: %v", err)
+		for _, session := range sessions {
+			session.File.Close()
+		}
+	}
 
 	logger.Println("Go MUD successfully shut down.")
 }
@@ -0,0 +1,20 @@
+package mudio
+
+import "github.com/jorgensigvardsson/gomud/charset"
+
+// What the client (MUD client or terminal) of a player can do, as far as it has told us
+type ClientCapabilities struct {
+	ClientName   string // E.g. "MUDLET", empty if unknown
+	TerminalType string // E.g. "XTERM-256COLOR", empty if unknown
+	Ansi         bool   // 16 colors
+	Colors256    bool
+	TrueColor    bool
+	Utf8         bool
+	ScreenReader bool
+	Mxp          bool            // Known to understand MXP, by the name of the client
+	Mccp         bool            // Output is compressed
+	Charset      charset.Charset // What output is encoded in, and input decoded from
+	Secure       bool            // The connection is encrypted (TLS)
+	Width        int             // The size of the window, in columns and lines, 0 if unknown
+	Height       int
+}
@@ -4,7 +4,9 @@ import (
 	"strings"
 
 	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/config"
 	"github.com/jorgensigvardsson/gomud/logging"
+	"github.com/jorgensigvardsson/gomud/persistence"
 )
 
 const InvalidInput = "Invalid input."
@@ -21,8 +23,16 @@ type CommandResult struct {
 	Output                 string
 	TurnOffEcho            bool
 	TurnOnEcho             bool
+	CopyoverRequested      bool          // If true, the server reboots without dropping connections once the command is done
+	GmcpMessages           []GmcpMessage // Sent after the output, to clients that support GMCP
+	DisplayChanged         bool          // The player's display settings (colors, split screen) changed, and apply from this command's output on
+	Job                    Job           // If not nil, the command is executed again when the job is done, without input
 }
 
+// Work that is too slow to do on the game loop, like hashing a password. It is done elsewhere, so it must not touch
+// the world, and what it returns is handed to the command in CommandContext.JobResult.
+type Job func() interface{}
+
 type Command interface {
 	Execute(context *CommandContext) (result CommandResult, err *CommandError)
 }
@@ -30,10 +40,14 @@ type Command interface {
 type CommandRequirementsEvaluator func(player *absmachine.Player) bool
 
 type CommandContext struct {
-	Input  string
-	World  *absmachine.World
-	Player *absmachine.Player
-	Logger logging.Logger
+	Input     string
+	World     *absmachine.World
+	Player    *absmachine.Player
+	Logger    logging.Logger
+	Accounts  persistence.AccountStore
+	Config    *config.Config
+	Client    ClientCapabilities // What the player's client can do
+	JobResult interface{}        // What the command's job returned, when the command is executed because it is done
 }
 
 type CommandError struct {
@@ -0,0 +1,72 @@
+package mudio
+
+import (
+	"strconv"
+	"strings"
+)
+
+/**** Command: SSH key ****/
+// Manages the public keys that log in to the player's account over SSH without a password
+type CommandSshKey struct {
+	args []string
+}
+
+const sshKeyUsage = "Usage: sshkey, sshkey add <public key>, or sshkey remove <number>"
+
+func NewCommandSshKey(args []string) (Command, CommandRequirementsEvaluator) {
+	return &CommandSshKey{args}, RequirePlayerLoggedIn
+}
+
+func (command *CommandSshKey) Execute(context *CommandContext) (CommandResult, *CommandError) {
+	account, err := context.Accounts.Load(context.Player.Name)
+	if err != nil {
+		context.Logger.Printlnf("Failed to load account for %v: %v", context.Player.Name, err)
+		return CommandResult{}, &CommandError{"Your account could not be loaded, please try again later."}
+	}
+
+	b := buffer{}
+
+	switch {
+	case len(command.args) == 0:
+		if len(account.AuthorizedKeys) == 0 {
+			return CommandResult{Output: "You have no SSH keys. Add one with: sshkey add <public key>"}, nil
+		}
+
+		b.Println("$heading$Your SSH keys:$fg_white$")
+		for i, key := range account.AuthorizedKeys {
+			b.Printlnf("%3d. %v", i+1, shortenKey(key))
+		}
+		return CommandResult{Output: b.ToString()}, nil
+	case strings.EqualFold(command.args[0], "add") && len(command.args) > 1:
+		// The key is the rest of the line, verbatim
+		args, _ := ParseArguments(context.Input, 2)
+		if account.AddAuthorizedKey(args[2]) != nil {
+			return CommandResult{}, &CommandError{"That is not a public key. Paste a line like the one in ~/.ssh/id_ed25519.pub."}
+		}
+		b.Println("Key added. You can now log in over SSH without a password.")
+	case strings.EqualFold(command.args[0], "remove") && len(command.args) == 2:
+		number, err := strconv.Atoi(command.args[1])
+		if err != nil || !account.RemoveAuthorizedKey(number-1) {
+			return CommandResult{}, &CommandError{"You have no SSH key with that number."}
+		}
+		b.Println("Key removed.")
+	default:
+		return CommandResult{}, &CommandError{sshKeyUsage}
+	}
+
+	if err := context.Accounts.Save(account); err != nil {
+		context.Logger.Printlnf("Failed to save account for %v: %v", context.Player.Name, err)
+		return CommandResult{}, &CommandError{"Your account could not be saved, please try again later."}
+	}
+
+	return CommandResult{Output: b.ToString()}, nil
+}
+
+// Shortens the key data of an authorized_keys line, which is too long to be readable
+func shortenKey(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) >= 2 && len(fields[1]) > 20 {
+		fields[1] = fields[1][:8] + "..." + fields[1][len(fields[1])-8:]
+	}
+	return strings.Join(fields, " ")
+}
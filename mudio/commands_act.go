@@ -5,6 +5,8 @@ import (
 	"strings"
 
 	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/ansi"
+	"github.com/jorgensigvardsson/gomud/charset"
 	"github.com/jorgensigvardsson/gomud/lang"
 )
 
@@ -38,10 +40,10 @@ func (command *CommandLook) Execute(context *CommandContext) (CommandResult, *Co
 	}
 
 	if nilCount == 3 {
-		return CommandResult{}, &CommandError{fmt.Sprintf("Can't find %v in the room...", command.args[0])}
+		return CommandResult{}, &CommandError{fmt.Sprintf("Can't find %v in the room...", ansi.Escape(command.args[0]))}
 	} else if nilCount != 2 {
 		// TODO: How to let user disambiguate?
-		return CommandResult{}, &CommandError{fmt.Sprintf("There are more than one thing in the room called %v...", command.args[0])}
+		return CommandResult{}, &CommandError{fmt.Sprintf("There are more than one thing in the room called %v...", ansi.Escape(command.args[0]))}
 	}
 
 	if mob != nil {
@@ -56,28 +58,28 @@ func (command *CommandLook) Execute(context *CommandContext) (CommandResult, *Co
 }
 
 func findTargets(room *absmachine.Room, target string) (*absmachine.Mob, *absmachine.Object, *absmachine.Player) {
-	targetLowerCase := strings.ToLower(target)
+	targetFolded := charset.Fold(target)
 
 	var mob *absmachine.Mob = nil
 	var obj *absmachine.Object = nil
 	var player *absmachine.Player = nil
 
 	for _, aMob := range room.Mobs {
-		if strings.HasPrefix(strings.ToLower(aMob.Name), targetLowerCase) {
+		if strings.HasPrefix(charset.Fold(aMob.Name), targetFolded) {
 			mob = aMob
 			break
 		}
 	}
 
 	for _, anObj := range room.Objects {
-		if strings.HasPrefix(strings.ToLower(anObj.Name), targetLowerCase) {
+		if strings.HasPrefix(charset.Fold(anObj.Name), targetFolded) {
 			obj = anObj
 			break
 		}
 	}
 
 	for _, aPlayer := range room.Players {
-		if strings.HasPrefix(strings.ToLower(aPlayer.Name), targetLowerCase) {
+		if strings.HasPrefix(charset.Fold(aPlayer.Name), targetFolded) {
 			player = aPlayer
 			break
 		}
@@ -94,7 +96,7 @@ func lookRoom(context *CommandContext, args ...string) (CommandResult, *CommandE
 	b := buffer{}
 
 	// Show the title of the room
-	b.Println(context.Player.Room.Title)
+	b.Printlnf("$roomtitle$%v$fg_white$", context.Player.Room.Title)
 
 	// Show the description of the room (and indent first line)
 	b.Printf("   ")
@@ -109,7 +111,7 @@ func lookRoom(context *CommandContext, args ...string) (CommandResult, *CommandE
 
 	for _, mob := range context.Player.Room.Mobs {
 		if mob.RoomDescription != "" {
-			b.Printlnf(mob.RoomDescription)
+			b.Println(mob.RoomDescription)
 		} else {
 			b.Printlnf("%v %v is here.", lang.IndefiniteArticleFor(mob.Name), mob.Name)
 		}
@@ -117,7 +119,7 @@ func lookRoom(context *CommandContext, args ...string) (CommandResult, *CommandE
 
 	for _, object := range context.Player.World.Objects {
 		if object.RoomDescription != "" {
-			b.Printlnf(object.RoomDescription)
+			b.Println(object.RoomDescription)
 		} else {
 			b.Printlnf("%v %v is lying on the ground.", lang.IndefiniteArticleFor(object.Name), object.Name)
 		}
@@ -127,7 +129,7 @@ func lookRoom(context *CommandContext, args ...string) (CommandResult, *CommandE
 	hasAdjacentRoom := false
 	for d, r := range context.Player.Room.AdjacentRooms {
 		if r != nil {
-			b.Printlnf("%-10s - %s", lang.DirectionName(absmachine.Direction(d)), r.Title)
+			b.Printlnf("$exit$%-10s - %s$fg_white$", lang.DirectionName(absmachine.Direction(d)), r.Title)
 			hasAdjacentRoom = true
 		}
 	}
@@ -0,0 +1,32 @@
+package mudio
+
+/**** Command: Copyover ****/
+type CommandCopyover struct{}
+
+const CopyoverRecoveryMessage = "$fg_bmagenta$The world shimmers around you for a moment."
+
+func NewCommandCopyover(args []string) (Command, CommandRequirementsEvaluator) {
+	return &CommandCopyover{}, RequirePlayerLoggedIn
+}
+
+func (command *CommandCopyover) Execute(context *CommandContext) (CommandResult, *CommandError) {
+	if context.Player.Level < context.Config.AdminLevel {
+		return CommandResult{}, ErrUnavailableCommand
+	}
+
+	context.Logger.Printlnf("Copyover requested by %v", context.Player.Name)
+	return CommandResult{Output: "Rebooting...", CopyoverRequested: true}, nil
+}
+
+/**** Command: Copyover recovery ****/
+// Not typed by players, but run for every player whose connection survived a copyover
+type CommandCopyoverRecovery struct{}
+
+func NewCommandCopyoverRecovery() Command {
+	return &CommandCopyoverRecovery{}
+}
+
+func (command *CommandCopyoverRecovery) Execute(context *CommandContext) (CommandResult, *CommandError) {
+	// The connection is new, so it must be told the player's display settings again
+	return CommandResult{Output: CopyoverRecoveryMessage, DisplayChanged: true}, nil
+}
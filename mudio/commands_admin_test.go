@@ -0,0 +1,45 @@
+package mudio
+
+import (
+	"testing"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/config"
+	"github.com/jorgensigvardsson/gomud/logging"
+)
+
+func newAdminContext(level int) *CommandContext {
+	return &CommandContext{
+		Player: &absmachine.Player{Name: "Bob", Level: level, State: absmachine.PS_LOGGED_IN},
+		Logger: logging.NewNullLogger(),
+		Config: config.Default(),
+	}
+}
+
+func Test_Copyover_Admin_RequestsCopyover(t *testing.T) {
+	// Arrange
+	context := newAdminContext(config.Default().AdminLevel)
+	command, _ := NewCommandCopyover([]string{})
+
+	// Act
+	result, err := command.Execute(context)
+
+	// Assert
+	if err != nil || !result.CopyoverRequested {
+		t.Errorf("Copyover was not requested: %+v, %v", result, err)
+	}
+}
+
+func Test_Copyover_NotAdmin_Refused(t *testing.T) {
+	// Arrange
+	context := newAdminContext(config.Default().AdminLevel - 1)
+	command, _ := NewCommandCopyover([]string{})
+
+	// Act
+	result, err := command.Execute(context)
+
+	// Assert
+	if err == nil || result.CopyoverRequested {
+		t.Errorf("Copyover was requested by a mortal: %+v", result)
+	}
+}
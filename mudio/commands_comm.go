@@ -28,7 +28,7 @@ func (command *CommandTell) Execute(context *CommandContext) (CommandResult, *Co
 	}
 
 	if otherPlayer == nil {
-		return CommandResult{}, &CommandError{fmt.Sprintf("Nobody with the name %v is online right now...", command.args[0])}
+		return CommandResult{}, &CommandError{fmt.Sprintf("Nobody with the name %v is online right now...", ansi.Escape(command.args[0]))}
 	}
 
 	if otherPlayer.State.HasFlag(absmachine.PS_BUSY) {
@@ -56,7 +56,7 @@ func (command *CommandTell) Execute(context *CommandContext) (CommandResult, *Co
 			TextMessages: []TextMessage{
 				{
 					RecipientPlayer: otherPlayer,
-					Text:            fmt.Sprintf("$fg_bcyan$%v tells you: %v", context.Player.Name, ansi.Escape(args[2])),
+					Text:            fmt.Sprintf("$tell$%v tells you: %v", context.Player.Name, ansi.Escape(args[2])),
 				},
 			},
 		},
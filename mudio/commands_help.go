@@ -36,7 +36,7 @@ func (command *CommandHelp) Execute(context *CommandContext) (CommandResult, *Co
 		lastCat := ""
 		for _, e := range copy {
 			if lastCat != e.cat {
-				b.Printlnf("$fg_yellow$..:: %v ::..$fg_white$", e.cat)
+				b.Printlnf("$heading$..:: %v ::..$fg_white$", e.cat)
 				lastCat = e.cat
 			}
 
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/persistence"
 )
 
 /**** Command: Login ****/
@@ -13,47 +14,192 @@ const (
 	LS_Initial LoginState = iota
 	LS_WantUsername
 	LS_WantPassword
+	LS_VerifyingPassword
+
+	// Character creation states, in the order they are visited
+	LS_ConfirmName
+	LS_ChoosePassword
+	LS_ConfirmPassword
+	LS_ChooseClass
+	LS_WantDescription
+	LS_HashingPassword
 )
 
+const usernamePrompt = "$prompt$Username: "
+const passwordPrompt = "$prompt$Password: "
+
 type CommandLogin struct {
-	username string
-	state    LoginState
+	username       string
+	authenticated  bool // The player has already proven who it is, and is not asked for a password
+	state          LoginState
+	failedAttempts int
+	newCharacter   newCharacter
+	account        *persistence.Account // The account whose password is being verified
 }
 
 func NewCommandLogin(args []string) (Command, CommandRequirementsEvaluator) {
 	return &CommandLogin{state: LS_Initial}, nil
 }
 
+// Logs in a player whose name is already known, e.g. the user name of an SSH connection. If `authenticated` is set,
+// the player has proven to own the account (with a public key), and is not asked for a password.
+func NewCommandLoginAs(username string, authenticated bool) Command {
+	return &CommandLogin{state: LS_Initial, username: username, authenticated: authenticated}
+}
+
 func (command *CommandLogin) Execute(context *CommandContext) (CommandResult, *CommandError) {
 	switch command.state {
 	case LS_Initial:
 		// Show message of the day to user and set command's state to LS_WantUsername
 		command.state = LS_WantUsername
-		return CommandResult{Prompt: "$fg_bcyan$Username: ", Output: "Welcome to GO mud!\r\n" /* TODO: Read from file */}, nil
+		welcome := "Welcome to GO mud!\r\n" /* TODO: Read from file */
+		if !persistence.IsValidAccountName(command.username) {
+			// No name known (or not one that could be a character's), so ask for it
+			return CommandResult{Prompt: usernamePrompt, Output: welcome}, nil
+		}
+
+		// The name is already known, as if the player had typed it
+		result, err := command.usernameEntered(context, command.username)
+		result.Output = welcome + result.Output
+		return result, err
 	case LS_WantUsername:
-		command.username = context.Input
-		command.state = LS_WantPassword
-		return CommandResult{Prompt: "$fg_bcyan$Password: ", TurnOffEcho: true}, nil
+		// A typed name has not been proven by anything
+		command.authenticated = false
+		return command.usernameEntered(context, context.Input)
 	case LS_WantPassword:
-		if context.World.HasPlayer(command.username) {
+		account, err := context.Accounts.Load(command.username)
+
+		if err != nil {
+			context.Logger.Printlnf("Failed to load account for %v: %v", command.username, err)
 			return CommandResult{
 				TerminatationRequested: true,
 				TurnOnEcho:             true,
 				Output:                 "\r\n", /* Because echo off "stole" the new line from the user */
-			}, &CommandError{"You are already logged in from another computer."}
+			}, &CommandError{"Your account could not be loaded, please try again later."}
 		}
-		context.Player.Name = command.username
-		context.Player.State.SetFlag(absmachine.PS_LOGGED_IN)
-		context.World.AddPlayers([]*absmachine.Player{context.Player})
-		context.Player.RelocateToRoom(context.World.StartRoom)
 
-		lookResult, _ := lookRoom(context)
+		// bcrypt is slow on purpose, which would hold up the game for everyone
+		password := context.Input
+		command.account = account
+		command.state = LS_VerifyingPassword
+		return CommandResult{Job: func() interface{} { return account.VerifyPassword(password) }}, nil
+	case LS_VerifyingPassword:
+		account := command.account
+		command.account = nil
+		command.state = LS_WantPassword
 
-		return CommandResult{
-			Output:     "\n" + /* Because echo off "stole" the new line from the user */ lookResult.Output,
-			TurnOnEcho: true,
-		}, nil
+		if verified, _ := context.JobResult.(bool); !verified {
+			return command.failedAttempt(context)
+		}
+
+		if context.World.HasPlayer(account.Name) {
+			return CommandResult{
+				TerminatationRequested: true,
+				TurnOnEcho:             true,
+				Output:                 "\r\n", /* Because echo off "stole" the new line from the user */
+			}, &CommandError{"You are already logged in from another computer."}
+		}
+
+		result, err := command.enterGame(context, account)
+		result.Output = "\n" + /* Because echo off "stole" the new line from the user */ result.Output
+		result.TurnOnEcho = true
+		return result, err
+	case LS_ConfirmName, LS_ChoosePassword, LS_ConfirmPassword, LS_ChooseClass, LS_WantDescription:
+		return command.executeCreationState(context)
+	case LS_HashingPassword:
+		return command.passwordHashed(context)
 	default:
 		return CommandResult{TerminatationRequested: true}, &CommandError{fmt.Sprintf("Unknown state reached: %v, preventing player from logging in.", command.state)}
 	}
 }
+
+func (command *CommandLogin) usernameEntered(context *CommandContext, username string) (CommandResult, *CommandError) {
+	if !persistence.IsValidAccountName(username) {
+		return CommandResult{Prompt: usernamePrompt}, &CommandError{
+			fmt.Sprintf(
+				"Names must be %v to %v letters long, and contain nothing but letters.",
+				persistence.MinAccountNameLength,
+				persistence.MaxAccountNameLength,
+			),
+		}
+	}
+	command.username = username
+
+	if !context.Accounts.Exists(command.username) {
+		// Never heard of this one, so let's create a new character!
+		return command.enterCreationState(LS_ConfirmName, "")
+	}
+
+	if command.authenticated {
+		return command.authenticatedLogin(context)
+	}
+
+	command.state = LS_WantPassword
+	return CommandResult{Prompt: passwordPrompt, TurnOffEcho: true}, nil
+}
+
+// Logs in a player that has proven to own the account some other way than by the password
+func (command *CommandLogin) authenticatedLogin(context *CommandContext) (CommandResult, *CommandError) {
+	account, err := context.Accounts.Load(command.username)
+
+	if err != nil {
+		context.Logger.Printlnf("Failed to load account for %v: %v", command.username, err)
+		return CommandResult{TerminatationRequested: true}, &CommandError{"Your account could not be loaded, please try again later."}
+	}
+
+	if context.World.HasPlayer(account.Name) {
+		return CommandResult{TerminatationRequested: true}, &CommandError{"You are already logged in from another computer."}
+	}
+
+	return command.enterGame(context, account)
+}
+
+func (command *CommandLogin) failedAttempt(context *CommandContext) (CommandResult, *CommandError) {
+	command.failedAttempts++
+	context.Logger.Printlnf("Failed login attempt %v for %v", command.failedAttempts, command.username)
+
+	if command.failedAttempts >= context.Config.MaxLoginAttempts {
+		return CommandResult{
+			TerminatationRequested: true,
+			TurnOnEcho:             true,
+			Output:                 "\r\n", /* Because echo off "stole" the new line from the user */
+		}, &CommandError{"Too many failed login attempts."}
+	}
+
+	return CommandResult{
+		Prompt: passwordPrompt,
+		Output: "\r\n$error$Wrong password.\r\n", /* Leading new line because echo off "stole" the new line from the user */
+	}, nil
+}
+
+// Puts the player described by the account into the world
+func (command *CommandLogin) enterGame(context *CommandContext, account *persistence.Account) (CommandResult, *CommandError) {
+	account.ApplyTo(context.Player)
+
+	if err := context.World.AddPlayers([]*absmachine.Player{context.Player}); err != nil {
+		context.Logger.Printlnf("Failed to add %v to the world: %v", account.Name, err)
+		return CommandResult{TerminatationRequested: true}, &CommandError{"You could not enter the game, please try again later."}
+	}
+
+	startRoom := context.World.FindRoomByVNum(account.LastRoom)
+	if startRoom == nil {
+		startRoom = context.World.StartRoom
+	}
+
+	if startRoom == nil {
+		context.Logger.Printlnf("Failed to put %v in a room: the world has no start room", account.Name)
+		absmachine.DestroyPlayer(context.Player)
+		return CommandResult{TerminatationRequested: true}, &CommandError{"You could not enter the game, please try again later."}
+	}
+
+	if err := context.Player.RelocateToRoom(startRoom); err != nil {
+		context.Logger.Printlnf("Failed to put %v in a room: %v", account.Name, err)
+		absmachine.DestroyPlayer(context.Player)
+		return CommandResult{TerminatationRequested: true}, &CommandError{"You could not enter the game, please try again later."}
+	}
+
+	context.Player.State.SetFlag(absmachine.PS_LOGGED_IN)
+	lookResult, _ := lookRoom(context)
+
+	return CommandResult{Output: lookResult.Output, DisplayChanged: true}, nil
+}
@@ -0,0 +1,408 @@
+package mudio
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/config"
+	"github.com/jorgensigvardsson/gomud/logging"
+	"github.com/jorgensigvardsson/gomud/persistence"
+)
+
+type memoryAccountStore struct {
+	accounts map[string]*persistence.Account
+}
+
+func newMemoryAccountStore() *memoryAccountStore {
+	return &memoryAccountStore{accounts: make(map[string]*persistence.Account)}
+}
+
+func (store *memoryAccountStore) Exists(name string) bool {
+	_, found := store.accounts[strings.ToLower(name)]
+	return found
+}
+
+func (store *memoryAccountStore) Load(name string) (*persistence.Account, error) {
+	account, found := store.accounts[strings.ToLower(name)]
+	if !found {
+		return nil, persistence.ErrAccountNotFound
+	}
+	accountCopy := *account
+	return &accountCopy, nil
+}
+
+func (store *memoryAccountStore) Save(account *persistence.Account) error {
+	accountCopy := *account
+	store.accounts[strings.ToLower(account.Name)] = &accountCopy
+	return nil
+}
+
+func newLoginContext(store persistence.AccountStore) *CommandContext {
+	world := absmachine.NewWorld()
+	room := absmachine.NewRoom()
+	room.Title = "The start room"
+	world.AddRooms([]*absmachine.Room{room})
+	world.StartRoom = room
+
+	return &CommandContext{
+		World:    world,
+		Player:   absmachine.NewPlayer(),
+		Logger:   logging.NewNullLogger(),
+		Accounts: store,
+		Config:   config.Default(),
+	}
+}
+
+func runLogin(command Command, context *CommandContext, inputs ...string) (CommandResult, *CommandError) {
+	var result CommandResult
+	var err *CommandError
+
+	for _, input := range inputs {
+		context.Input = input
+		result, err = command.Execute(context)
+
+		// Like the game loop, which has the job done elsewhere
+		for result.Job != nil {
+			context.Input = ""
+			context.JobResult = result.Job()
+			result, err = command.Execute(context)
+			context.JobResult = nil
+		}
+	}
+
+	return result, err
+}
+
+func newAccount(name string, password string) *persistence.Account {
+	account := &persistence.Account{Name: name, Health: 12, Mana: 34}
+	account.SetPassword(password)
+	return account
+}
+
+func Test_Login_CorrectPassword(t *testing.T) {
+	// Arrange
+	store := newMemoryAccountStore()
+	store.Save(newAccount("Bob", "secret"))
+	context := newLoginContext(store)
+	command, _ := NewCommandLogin([]string{})
+
+	// Act
+	result, err := runLogin(command, context, "", "bob", "secret")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.Prompt != "" || result.TerminatationRequested {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	if !context.Player.State.HasFlag(absmachine.PS_LOGGED_IN) {
+		t.Error("Player is not logged in")
+	}
+
+	if context.Player.Name != "Bob" || context.Player.Health != 12 || context.Player.Mana != 34 {
+		t.Errorf("Player was not restored from account: %+v", *context.Player)
+	}
+
+	if context.Player.Room != context.World.StartRoom {
+		t.Error("Player was not placed in the start room")
+	}
+}
+
+func Test_Login_NoStartRoom_Terminates(t *testing.T) {
+	// Arrange
+	store := newMemoryAccountStore()
+	store.Save(newAccount("Bob", "secret"))
+	context := newLoginContext(store)
+	context.World.StartRoom = nil
+	command, _ := NewCommandLogin([]string{})
+
+	// Act
+	result, err := runLogin(command, context, "", "bob", "secret")
+
+	// Assert
+	if err == nil || !result.TerminatationRequested {
+		t.Errorf("Expected termination with an error, got %+v (%v)", result, err)
+	}
+
+	if context.World.HasPlayer("Bob") || context.Player.State.HasFlag(absmachine.PS_LOGGED_IN) {
+		t.Error("Player was left in the world")
+	}
+}
+
+func Test_Login_WrongPassword_PromptsAgain(t *testing.T) {
+	// Arrange
+	store := newMemoryAccountStore()
+	store.Save(newAccount("Bob", "secret"))
+	context := newLoginContext(store)
+	command, _ := NewCommandLogin([]string{})
+
+	// Act
+	result, err := runLogin(command, context, "", "bob", "wrong")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.Prompt != passwordPrompt || result.TerminatationRequested {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	if context.Player.State.HasFlag(absmachine.PS_LOGGED_IN) {
+		t.Error("Player is logged in")
+	}
+}
+
+func Test_Login_TooManyFailedAttempts_Terminates(t *testing.T) {
+	// Arrange
+	store := newMemoryAccountStore()
+	store.Save(newAccount("Bob", "secret"))
+	context := newLoginContext(store)
+	context.Config.MaxLoginAttempts = 2
+	command, _ := NewCommandLogin([]string{})
+
+	// Act
+	result, err := runLogin(command, context, "", "bob", "wrong", "still wrong")
+
+	// Assert
+	if err == nil {
+		t.Error("Expected an error")
+	}
+
+	if !result.TerminatationRequested {
+		t.Errorf("Expected termination: %+v", result)
+	}
+
+	if len(context.World.Players) != 0 {
+		t.Error("Player was added to world")
+	}
+}
+
+func Test_Login_InvalidUsername_PromptsAgain(t *testing.T) {
+	context := newLoginContext(newMemoryAccountStore())
+	command, _ := NewCommandLogin([]string{})
+
+	result, err := runLogin(command, context, "", "../bob")
+
+	if err == nil {
+		t.Error("Expected an error")
+	}
+
+	if result.Prompt != usernamePrompt {
+		t.Errorf("Unexpected prompt: %v", result.Prompt)
+	}
+}
+
+func Test_Login_AlreadyLoggedIn_Terminates(t *testing.T) {
+	// Arrange
+	store := newMemoryAccountStore()
+	store.Save(newAccount("Bob", "secret"))
+	context := newLoginContext(store)
+	context.World.AddPlayers([]*absmachine.Player{{Name: "Bob"}})
+	command, _ := NewCommandLogin([]string{})
+
+	// Act
+	result, err := runLogin(command, context, "", "bob", "secret")
+
+	// Assert
+	if err == nil {
+		t.Error("Expected an error")
+	}
+
+	if !result.TerminatationRequested {
+		t.Errorf("Expected termination: %+v", result)
+	}
+}
+
+func Test_Login_UnknownUser_CreatesCharacter(t *testing.T) {
+	// Arrange
+	store := newMemoryAccountStore()
+	context := newLoginContext(store)
+	command, _ := NewCommandLogin([]string{})
+
+	// Act
+	result, err := runLogin(command, context, "", "alice", "yes", "secret", "secret", "wiz", "A tall wizard.")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.Prompt != "" || result.TerminatationRequested {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	account, loadErr := store.Load("alice")
+	if loadErr != nil {
+		t.Fatalf("Account was not saved: %v", loadErr)
+	}
+
+	if !account.VerifyPassword("secret") {
+		t.Error("Password was not saved")
+	}
+
+	stats := absmachine.StartingStats[absmachine.PC_Wizard]
+	if account.Class != absmachine.PC_Wizard || account.Health != stats.Health || account.Mana != stats.Mana || account.Description != "A tall wizard." {
+		t.Errorf("Unexpected account: %+v", *account)
+	}
+
+	if !context.Player.State.HasFlag(absmachine.PS_LOGGED_IN) || context.Player.Room != context.World.StartRoom {
+		t.Error("Player did not enter the game")
+	}
+}
+
+func Test_Login_CreateCharacter_PasswordMismatch_AsksAgain(t *testing.T) {
+	context := newLoginContext(newMemoryAccountStore())
+	command, _ := NewCommandLogin([]string{})
+
+	result, _ := runLogin(command, context, "", "alice", "y", "secret", "terces")
+
+	if result.Prompt != "$prompt$Choose a password: " {
+		t.Errorf("Unexpected prompt: %v", result.Prompt)
+	}
+}
+
+func Test_Login_CreateCharacter_Back_RevisesEarlierAnswer(t *testing.T) {
+	// Arrange
+	store := newMemoryAccountStore()
+	context := newLoginContext(store)
+	command, _ := NewCommandLogin([]string{})
+
+	// Act
+	result, _ := runLogin(command, context, "", "alice", "y", "secret", "secret", "back", "other", "other")
+
+	// Assert
+	if result.Prompt != "$prompt$Class: " || !result.TurnOnEcho {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	runLogin(command, context, "cleric", "A humble cleric.")
+
+	account, err := store.Load("alice")
+	if err != nil {
+		t.Fatalf("Account was not saved: %v", err)
+	}
+
+	if !account.VerifyPassword("other") {
+		t.Error("Revised password was not used")
+	}
+}
+
+func Test_Login_CreateCharacter_RejectName_AsksForUsername(t *testing.T) {
+	context := newLoginContext(newMemoryAccountStore())
+	command, _ := NewCommandLogin([]string{})
+
+	result, _ := runLogin(command, context, "", "alice", "no")
+
+	if result.Prompt != usernamePrompt {
+		t.Errorf("Unexpected prompt: %v", result.Prompt)
+	}
+}
+
+func Test_LoginAs_Authenticated_NoPasswordAsked(t *testing.T) {
+	store := newMemoryAccountStore()
+	store.Save(newAccount("Bob", "secret"))
+	context := newLoginContext(store)
+	command := NewCommandLoginAs("bob", true)
+
+	result, err := runLogin(command, context, "")
+
+	if err != nil || result.Prompt != "" {
+		t.Fatalf("Unexpected result: %+v (%v)", result, err)
+	}
+
+	if !context.Player.State.HasFlag(absmachine.PS_LOGGED_IN) || context.Player.Name != "Bob" {
+		t.Errorf("Player is not logged in as Bob: %+v", *context.Player)
+	}
+}
+
+func Test_LoginAs_NotAuthenticated_PasswordAsked(t *testing.T) {
+	store := newMemoryAccountStore()
+	store.Save(newAccount("Bob", "secret"))
+	context := newLoginContext(store)
+	command := NewCommandLoginAs("bob", false)
+
+	result, _ := runLogin(command, context, "")
+
+	if result.Prompt != passwordPrompt {
+		t.Errorf("Unexpected prompt: %v", result.Prompt)
+	}
+
+	runLogin(command, context, "secret")
+
+	if !context.Player.State.HasFlag(absmachine.PS_LOGGED_IN) {
+		t.Error("Player is not logged in")
+	}
+}
+
+func Test_LoginAs_InvalidName_UsernameAsked(t *testing.T) {
+	command := NewCommandLoginAs("root@host", true)
+
+	result, _ := runLogin(command, newLoginContext(newMemoryAccountStore()), "")
+
+	if result.Prompt != usernamePrompt {
+		t.Errorf("Unexpected prompt: %v", result.Prompt)
+	}
+}
+
+func Test_LoginAs_TypedNameAfterwards_NotAuthenticated(t *testing.T) {
+	store := newMemoryAccountStore()
+	store.Save(newAccount("Bob", "secret"))
+	command := NewCommandLoginAs("root@host", true)
+
+	result, _ := runLogin(command, newLoginContext(store), "", "bob")
+
+	if result.Prompt != passwordPrompt {
+		t.Errorf("Unexpected prompt: %v", result.Prompt)
+	}
+}
+
+func Test_Login_Password_VerifiedByJob(t *testing.T) {
+	store := newMemoryAccountStore()
+	store.Save(newAccount("Bob", "secret"))
+	context := newLoginContext(store)
+	command, _ := NewCommandLogin([]string{})
+	runLogin(command, context, "", "bob")
+
+	context.Input = "secret"
+	result, err := command.Execute(context)
+
+	if err != nil || result.Job == nil || result.Prompt != "" {
+		t.Fatalf("Expected a job, but got %+v (%v)", result, err)
+	}
+
+	if context.Player.State.HasFlag(absmachine.PS_LOGGED_IN) {
+		t.Error("Player logged in before the password was verified")
+	}
+
+	if verified, _ := result.Job().(bool); !verified {
+		t.Error("Expected the job to verify the password")
+	}
+}
+
+func Test_Login_CreateCharacter_BackAsPassword_Chosen(t *testing.T) {
+	store := newMemoryAccountStore()
+	context := newLoginContext(store)
+	command, _ := NewCommandLogin([]string{})
+
+	runLogin(command, context, "", "alice", "y", "Back", "Back", "thief", "A sneaky thief.")
+
+	account, err := store.Load("alice")
+	if err != nil || !account.VerifyPassword("Back") {
+		t.Errorf("Expected \"Back\" to be the password (%v)", err)
+	}
+}
+
+func Test_parseClass_AmbiguousPrefix_NotFound(t *testing.T) {
+	if _, found := parseClass("w"); found {
+		t.Error("Expected \"w\" to be ambiguous")
+	}
+
+	if class, found := parseClass("wi"); !found || class != absmachine.PC_Wizard {
+		t.Errorf("Expected a wizard, but got %v (%v)", class, found)
+	}
+}
@@ -0,0 +1,217 @@
+package mudio
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/lang"
+	"github.com/jorgensigvardsson/gomud/persistence"
+)
+
+// Typing this at any step of the character creation goes back to the previous step, except when choosing a password,
+// which may be anything
+const CharacterCreationBack = "back"
+
+const MinPasswordLength = 4
+
+// The answers given so far during character creation
+type newCharacter struct {
+	password    string
+	class       absmachine.PlayerClass
+	description string
+	echoOff     bool // Keeps track of whether we have asked the client to stop echoing
+}
+
+// What hashing the password of a new character came up with
+type passwordHash struct {
+	hash string
+	err  error
+}
+
+func (command *CommandLogin) executeCreationState(context *CommandContext) (CommandResult, *CommandError) {
+	input := context.Input
+
+	choosingPassword := command.state == LS_ChoosePassword || command.state == LS_ConfirmPassword
+	if !choosingPassword && strings.EqualFold(input, CharacterCreationBack) {
+		return command.enterCreationState(previousCreationState(command.state), "")
+	}
+
+	switch command.state {
+	case LS_ConfirmName:
+		lcInput := strings.ToLower(input)
+		switch {
+		case lcInput != "" && strings.HasPrefix("yes", lcInput):
+			return command.enterCreationState(LS_ChoosePassword, "")
+		case lcInput != "" && strings.HasPrefix("no", lcInput):
+			return command.enterCreationState(LS_WantUsername, "Ok, what is it then?")
+		default:
+			return command.enterCreationState(LS_ConfirmName, InvalidInput)
+		}
+	case LS_ChoosePassword:
+		if len(input) < MinPasswordLength {
+			return command.enterCreationState(LS_ChoosePassword, fmt.Sprintf("$error$Passwords must be at least %v characters long.", MinPasswordLength))
+		}
+		command.newCharacter.password = input
+		return command.enterCreationState(LS_ConfirmPassword, "")
+	case LS_ConfirmPassword:
+		if input != command.newCharacter.password {
+			return command.enterCreationState(LS_ChoosePassword, "$error$Passwords don't match, let's try again.")
+		}
+		return command.enterCreationState(LS_ChooseClass, "")
+	case LS_ChooseClass:
+		class, found := parseClass(input)
+		if !found {
+			return command.enterCreationState(LS_ChooseClass, "$error$That's not a class (or it could be more than one).")
+		}
+		command.newCharacter.class = class
+		return command.enterCreationState(LS_WantDescription, "")
+	case LS_WantDescription:
+		if input == "" {
+			return command.enterCreationState(LS_WantDescription, "$error$Surely there is something to say about you?")
+		}
+		command.newCharacter.description = input
+		return command.createCharacter(context)
+	default:
+		return CommandResult{TerminatationRequested: true}, &CommandError{fmt.Sprintf("Unknown state reached: %v, preventing player from creating a character.", command.state)}
+	}
+}
+
+func previousCreationState(state LoginState) LoginState {
+	switch state {
+	case LS_ConfirmName:
+		return LS_WantUsername
+	case LS_ChooseClass:
+		// The password is chosen again, rather than just retyped
+		return LS_ChoosePassword
+	default:
+		return state - 1
+	}
+}
+
+// Moves the command into a state, and returns the prompt for that state. If `message` is non-empty, it
+// is shown before the prompt
+func (command *CommandLogin) enterCreationState(state LoginState, message string) (CommandResult, *CommandError) {
+	b := buffer{}
+
+	if command.newCharacter.echoOff {
+		b.Printf("\r\n") // Because echo off "stole" the new line from the user
+	}
+
+	if message != "" {
+		b.Printf("%v\r\n", message)
+	}
+
+	result := CommandResult{}
+
+	switch state {
+	case LS_WantUsername:
+		result.Prompt = usernamePrompt
+	case LS_ConfirmName:
+		result.Prompt = fmt.Sprintf("$prompt$Did I get that right, %v (y/n)? ", command.username)
+	case LS_ChoosePassword:
+		result.Prompt = "$prompt$Choose a password: "
+	case LS_ConfirmPassword:
+		result.Prompt = "$prompt$Retype password: "
+	case LS_ChooseClass:
+		b.Printf("Choose a class (type \"%v\" to go back):\r\n", CharacterCreationBack)
+		for class := absmachine.PlayerClass(0); class < absmachine.NUM_CLASSES; class++ {
+			b.Printf("  %v\r\n", lang.ClassName(class))
+		}
+		result.Prompt = "$prompt$Class: "
+	case LS_WantDescription:
+		b.Printf("Describe your character in a sentence or two. This is what others see when they look at you.\r\n")
+		result.Prompt = "$prompt$Description: "
+	}
+
+	wantEchoOff := state == LS_ChoosePassword || state == LS_ConfirmPassword
+	if wantEchoOff && !command.newCharacter.echoOff {
+		result.TurnOffEcho = true
+	} else if !wantEchoOff && command.newCharacter.echoOff {
+		result.TurnOnEcho = true
+	}
+
+	command.newCharacter.echoOff = wantEchoOff
+	command.state = state
+	result.Output = b.ToString()
+	return result, nil
+}
+
+// Finds the class whose name starts with the text. A text that could be more than one class is no class.
+func parseClass(text string) (absmachine.PlayerClass, bool) {
+	lcText := strings.ToLower(text)
+	if lcText == "" {
+		return 0, false
+	}
+
+	matches := 0
+	var found absmachine.PlayerClass
+	for class := absmachine.PlayerClass(0); class < absmachine.NUM_CLASSES; class++ {
+		name := strings.ToLower(lang.ClassName(class))
+		if name == lcText {
+			return class, true
+		}
+
+		if strings.HasPrefix(name, lcText) {
+			matches++
+			found = class
+		}
+	}
+
+	return found, matches == 1
+}
+
+func (command *CommandLogin) createCharacter(context *CommandContext) (CommandResult, *CommandError) {
+	if context.Accounts.Exists(command.username) {
+		// Somebody beat us to it while we were busy answering questions!
+		return command.enterCreationState(LS_WantUsername, fmt.Sprintf("$error$Somebody just took the name %v, please choose another one.", command.username))
+	}
+
+	// bcrypt is slow on purpose, which would hold up the game for everyone
+	password := command.newCharacter.password
+	command.state = LS_HashingPassword
+	return CommandResult{Job: func() interface{} {
+		hash, err := persistence.HashPassword(password)
+		return passwordHash{hash, err}
+	}}, nil
+}
+
+// Saves the new character, once its password is hashed, and puts it into the world
+func (command *CommandLogin) passwordHashed(context *CommandContext) (CommandResult, *CommandError) {
+	if context.Accounts.Exists(command.username) {
+		// Somebody beat us to it while the password was hashed
+		return command.enterCreationState(LS_WantUsername, fmt.Sprintf("$error$Somebody just took the name %v, please choose another one.", command.username))
+	}
+
+	result, _ := context.JobResult.(passwordHash)
+	err := result.err
+	if result.hash == "" && err == nil {
+		err = errors.New("no password hash")
+	}
+
+	stats := absmachine.StartingStats[command.newCharacter.class]
+	account := &persistence.Account{
+		Name:         command.username,
+		PasswordHash: result.hash,
+		Description:  command.newCharacter.description,
+		Class:        command.newCharacter.class,
+		Level:        1,
+		Health:       stats.Health,
+		Mana:         stats.Mana,
+	}
+
+	if err == nil {
+		err = context.Accounts.Save(account)
+	}
+
+	if err != nil {
+		context.Logger.Printlnf("Failed to create account for %v: %v", command.username, err)
+		return CommandResult{TerminatationRequested: true}, &CommandError{"Your character could not be created, please try again later."}
+	}
+
+	context.Logger.Printlnf("New character %v created", account.Name)
+	command.newCharacter = newCharacter{}
+
+	return command.enterGame(context, account)
+}
@@ -0,0 +1,152 @@
+package mudio
+
+import (
+	"strings"
+
+	"github.com/jorgensigvardsson/gomud/ansi"
+)
+
+/**** Command: Color ****/
+// Shows and changes the player's colors of semantic markup, like errors and room titles
+type CommandColor struct {
+	args []string
+}
+
+const colorUsage = "Usage: color, color <entry>, color <entry> <style>, or color <entry> default"
+
+func NewCommandColor(args []string) (Command, CommandRequirementsEvaluator) {
+	return &CommandColor{args}, RequirePlayerLoggedIn
+}
+
+func (command *CommandColor) Execute(context *CommandContext) (CommandResult, *CommandError) {
+	theme := ansi.Theme(context.Player.ColorTheme)
+	b := buffer{}
+
+	if len(command.args) == 0 {
+		b.Println("$heading$Your colors:$fg_white$")
+		for _, tag := range ansi.SemanticTags() {
+			printThemeEntry(&b, theme, tag)
+		}
+		b.Println("Change one with: color <entry> <style>, where the style is made of names like")
+		b.Println("bold, underline, fg_red, bg_bblue, fg_c208 (256 colors) or fg_#ff8800, e.g: color error bold fg_c196")
+		return CommandResult{Output: b.ToString()}, nil
+	}
+
+	tag := strings.ToLower(command.args[0])
+	if !ansi.IsSemanticTag(tag) {
+		return CommandResult{}, &CommandError{"There is no such entry. These are: " + strings.Join(ansi.SemanticTags(), ", ")}
+	}
+
+	switch {
+	case len(command.args) == 1:
+		printThemeEntry(&b, theme, tag)
+		return CommandResult{Output: b.ToString()}, nil
+	case len(command.args) == 2 && strings.EqualFold(command.args[1], "default"):
+		delete(context.Player.ColorTheme, tag)
+	default:
+		style, err := ansi.ParseStyle(command.args[1:])
+		if err != nil {
+			return CommandResult{}, &CommandError{colorUsage}
+		}
+
+		if context.Player.ColorTheme == nil {
+			context.Player.ColorTheme = make(map[string]string)
+		}
+		context.Player.ColorTheme[tag] = style
+	}
+
+	printThemeEntry(&b, ansi.Theme(context.Player.ColorTheme), tag)
+	return CommandResult{Output: b.ToString(), DisplayChanged: true}, nil
+}
+
+// Shows how an entry of the theme looks, and what it is made of
+func printThemeEntry(b *buffer, theme ansi.Theme, tag string) {
+	source := "default"
+	if _, found := theme[tag]; found {
+		source = "yours"
+	}
+
+	b.Printlnf("%-10s $%v$This is how it looks$reset$$fg_white$$bg_black$  %v (%v)", tag, tag, ansi.StyleNames(theme.Style(tag)), source)
+}
+
+/**** Command: Split screen ****/
+// Turns the split screen on or off, where output scrolls above a status bar and the prompt
+type CommandSplitScreen struct {
+	args []string
+}
+
+func NewCommandSplitScreen(args []string) (Command, CommandRequirementsEvaluator) {
+	return &CommandSplitScreen{args}, RequirePlayerLoggedIn
+}
+
+func (command *CommandSplitScreen) Execute(context *CommandContext) (CommandResult, *CommandError) {
+	switch {
+	case len(command.args) == 0:
+		context.Player.SplitScreen = !context.Player.SplitScreen
+	case len(command.args) == 1 && strings.EqualFold(command.args[0], "on"):
+		context.Player.SplitScreen = true
+	case len(command.args) == 1 && strings.EqualFold(command.args[0], "off"):
+		context.Player.SplitScreen = false
+	default:
+		return CommandResult{}, &CommandError{"Usage: splitscreen, or splitscreen on|off"}
+	}
+
+	if !context.Player.SplitScreen {
+		return CommandResult{Output: "Split screen is off.", DisplayChanged: true}, nil
+	}
+
+	output := "Split screen is on."
+	if !context.Client.Ansi {
+		output += " Your client doesn't seem to be a terminal that can show it, though."
+	}
+	return CommandResult{Output: output, DisplayChanged: true}, nil
+}
+
+/**** Command: Prompt ****/
+// Shows and changes what the player's prompt shows
+type CommandPrompt struct {
+	args []string
+}
+
+func NewCommandPrompt(args []string) (Command, CommandRequirementsEvaluator) {
+	return &CommandPrompt{args}, RequirePlayerLoggedIn
+}
+
+func (command *CommandPrompt) Execute(context *CommandContext) (CommandResult, *CommandError) {
+	b := buffer{}
+
+	switch {
+	case len(command.args) == 0:
+		format := context.Player.PromptFormat
+		if format == "" {
+			format = DefaultPromptFormat
+		}
+		b.Printlnf("Your prompt is: %v", ansi.Escape(format))
+		b.Println("Change it with: prompt <format>, where these are replaced by what they stand for:")
+		b.Printlnf("  %%h health, %%m mana, %%l level, %%n name, %%r room, %%e exits, %%b busy (*), %%t game hour, %%%% a percent sign")
+		b.Printlnf("e.g: prompt $fg_green$%%h$fg_white$/%%m %%e>")
+		return CommandResult{Output: b.ToString()}, nil
+	case len(command.args) == 1 && strings.EqualFold(command.args[0], "default"):
+		context.Player.PromptFormat = ""
+	default:
+		// The format is the rest of the line, verbatim
+		args, _ := ParseArguments(context.Input, 1)
+		format := args[1]
+		if !strings.HasSuffix(format, " ") {
+			// Whatever the player types starts after the prompt, not right against it
+			format += " "
+		}
+
+		switch ValidatePromptFormat(format) {
+		case ErrPromptFormatTooLong:
+			return CommandResult{}, &CommandError{"That prompt is too long."}
+		case ErrInvalidPromptToken:
+			return CommandResult{}, &CommandError{"That prompt has a % which is not followed by h, m, l, n, r, e, b, t or %."}
+		case ErrInvalidPromptMarkup:
+			return CommandResult{}, &CommandError{"That prompt has markup between dollar signs that is not a color, an attribute or an entry of your color theme (use $$$$ for a dollar sign)."}
+		}
+		context.Player.PromptFormat = format
+	}
+
+	return CommandResult{Output: "Ok."}, nil
+}
@@ -0,0 +1,144 @@
+package mudio
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+)
+
+func Test_Color_SetEntry_DisplayChanged(t *testing.T) {
+	command, _ := NewCommandColor([]string{"Error", "bold", "fg_c196"})
+	context := CommandContext{Player: absmachine.NewPlayer()}
+
+	result, err := command.Execute(&context)
+
+	if err != nil || !result.DisplayChanged {
+		t.Fatalf("Unexpected result: %+v (%v)", result, err)
+	}
+
+	if context.Player.ColorTheme["error"] != "$bold$$fg_c196$" {
+		t.Errorf("Unexpected theme: %v", context.Player.ColorTheme)
+	}
+
+	if !strings.Contains(result.Output, "bold fg_c196 (yours)") {
+		t.Errorf("Unexpected output: %v", result.Output)
+	}
+}
+
+func Test_Color_NoColorName_Rejected(t *testing.T) {
+	command, _ := NewCommandColor([]string{"error", "fg_"})
+	context := CommandContext{Player: absmachine.NewPlayer()}
+
+	_, err := command.Execute(&context)
+
+	if err == nil || context.Player.ColorTheme != nil {
+		t.Errorf("Expected an error, but got theme %v (%v)", context.Player.ColorTheme, err)
+	}
+}
+
+func Test_Color_Default_EntryRemoved(t *testing.T) {
+	command, _ := NewCommandColor([]string{"error", "default"})
+	context := CommandContext{Player: absmachine.NewPlayer()}
+	context.Player.ColorTheme = map[string]string{"error": "$fg_red$", "tell": "$fg_blue$"}
+
+	result, _ := command.Execute(&context)
+
+	if _, found := context.Player.ColorTheme["error"]; found || len(context.Player.ColorTheme) != 1 || !result.DisplayChanged {
+		t.Errorf("Unexpected theme: %v", context.Player.ColorTheme)
+	}
+
+	if !strings.Contains(result.Output, "fg_bred (default)") {
+		t.Errorf("Unexpected output: %v", result.Output)
+	}
+}
+
+func Test_Color_NoArguments_AllEntriesListed(t *testing.T) {
+	command, _ := NewCommandColor([]string{})
+	context := CommandContext{Player: absmachine.NewPlayer()}
+
+	result, _ := command.Execute(&context)
+
+	for _, tag := range []string{"error", "exit", "mobaction", "prompt", "roomtitle", "tell"} {
+		if !strings.Contains(result.Output, "$"+tag+"$") {
+			t.Errorf("Entry %v not shown: %v", tag, result.Output)
+		}
+	}
+
+	if result.DisplayChanged {
+		t.Error("Listing should not change the theme")
+	}
+}
+
+func Test_Color_InvalidStyleOrEntry_Error(t *testing.T) {
+	for _, args := range [][]string{{"error", "fg_purple"}, {"nothing", "fg_red"}} {
+		command, _ := NewCommandColor(args)
+		context := CommandContext{Player: absmachine.NewPlayer()}
+
+		result, err := command.Execute(&context)
+
+		if err == nil || result.DisplayChanged || len(context.Player.ColorTheme) != 0 {
+			t.Errorf("Expected %v to fail, but got %+v", args, result)
+		}
+	}
+}
+
+func Test_SplitScreen_OnOffAndToggle(t *testing.T) {
+	context := CommandContext{Player: absmachine.NewPlayer(), Client: ClientCapabilities{Ansi: true}}
+	expected := []bool{true, false, true}
+
+	for i, args := range [][]string{{"on"}, {"OFF"}, {}} {
+		command, _ := NewCommandSplitScreen(args)
+		result, err := command.Execute(&context)
+
+		if err != nil || !result.DisplayChanged || context.Player.SplitScreen != expected[i] {
+			t.Errorf("Unexpected result of %v: %+v (%v), split screen %v", args, result, err, context.Player.SplitScreen)
+		}
+	}
+}
+
+func Test_SplitScreen_NoAnsi_Warned(t *testing.T) {
+	command, _ := NewCommandSplitScreen([]string{"on"})
+	context := CommandContext{Player: absmachine.NewPlayer()}
+
+	result, _ := command.Execute(&context)
+
+	if !strings.Contains(result.Output, "doesn't seem to be a terminal") {
+		t.Errorf("Unexpected output: %v", result.Output)
+	}
+}
+
+func Test_Prompt_Format_RestOfLineKept(t *testing.T) {
+	command, _ := NewCommandPrompt([]string{"[%h", "%m]"})
+	context := CommandContext{Player: absmachine.NewPlayer(), Input: "prompt   [%h  %m]"}
+
+	_, err := command.Execute(&context)
+
+	if err != nil || context.Player.PromptFormat != "[%h  %m] " {
+		t.Errorf("Unexpected format %q (%v)", context.Player.PromptFormat, err)
+	}
+}
+
+func Test_Prompt_InvalidToken_Refused(t *testing.T) {
+	command, _ := NewCommandPrompt([]string{"%q"})
+	context := CommandContext{Player: absmachine.NewPlayer(), Input: "prompt %q"}
+	context.Player.PromptFormat = "%h> "
+
+	_, err := command.Execute(&context)
+
+	if err == nil || context.Player.PromptFormat != "%h> " {
+		t.Errorf("Expected the format to be refused, but got %q", context.Player.PromptFormat)
+	}
+}
+
+func Test_Prompt_Default_FormatCleared(t *testing.T) {
+	command, _ := NewCommandPrompt([]string{"default"})
+	context := CommandContext{Player: absmachine.NewPlayer(), Input: "prompt default"}
+	context.Player.PromptFormat = "%h> "
+
+	command.Execute(&context)
+
+	if context.Player.PromptFormat != "" {
+		t.Errorf("Unexpected format %q", context.Player.PromptFormat)
+	}
+}
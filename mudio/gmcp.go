@@ -0,0 +1,69 @@
+package mudio
+
+import (
+	"strings"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/lang"
+)
+
+// An out-of-band message to the client (GMCP), which clients use for gauges, maps and such, rather than showing it
+// as text. `Data` is sent as JSON.
+type GmcpMessage struct {
+	Package string // E.g. "Char.Vitals"
+	Data    interface{}
+}
+
+const (
+	GMCP_CharVitals = "Char.Vitals"
+	GMCP_CharStatus = "Char.Status"
+	GMCP_RoomInfo   = "Room.Info"
+)
+
+type CharVitals struct {
+	Hp   int `json:"hp"`
+	Mana int `json:"mana"`
+}
+
+type CharStatus struct {
+	Name  string `json:"name"`
+	Level int    `json:"level"`
+	Class string `json:"class"`
+}
+
+type RoomInfo struct {
+	Num   int            `json:"num"`
+	Name  string         `json:"name"`
+	Exits map[string]int `json:"exits"` // Direction ("n", "u", etc) -> room number
+}
+
+func NewGmcpCharVitals(player *absmachine.Player) GmcpMessage {
+	return GmcpMessage{
+		Package: GMCP_CharVitals,
+		Data:    CharVitals{Hp: player.Health, Mana: player.Mana},
+	}
+}
+
+func NewGmcpCharStatus(player *absmachine.Player) GmcpMessage {
+	return GmcpMessage{
+		Package: GMCP_CharStatus,
+		Data:    CharStatus{Name: player.Name, Level: player.Level, Class: lang.ClassName(player.Class)},
+	}
+}
+
+func NewGmcpRoomInfo(room *absmachine.Room) GmcpMessage {
+	info := RoomInfo{
+		Num:   room.VNum,
+		Name:  room.Title,
+		Exits: make(map[string]int),
+	}
+
+	for direction, adjacentRoom := range room.AdjacentRooms {
+		if adjacentRoom != nil {
+			name := strings.ToLower(lang.DirectionName(absmachine.Direction(direction))[:1])
+			info.Exits[name] = adjacentRoom.VNum
+		}
+	}
+
+	return GmcpMessage{Package: GMCP_RoomInfo, Data: info}
+}
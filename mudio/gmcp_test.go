@@ -0,0 +1,42 @@
+package mudio
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+)
+
+func Test_NewGmcpRoomInfo(t *testing.T) {
+	room := absmachine.Room{VNum: 3001, Title: "The Temple"}
+	north := absmachine.Room{VNum: 3054}
+	down := absmachine.Room{VNum: 3100}
+	room.Connect(&north, absmachine.DIR_NORTH)
+	room.Connect(&down, absmachine.DIR_DOWN)
+
+	message := NewGmcpRoomInfo(&room)
+	data, err := json.Marshal(message.Data)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if message.Package != "Room.Info" || string(data) != `{"num":3001,"name":"The Temple","exits":{"d":3100,"n":3054}}` {
+		t.Errorf("Unexpected message: %v %s", message.Package, data)
+	}
+}
+
+func Test_NewGmcpCharVitals_NewGmcpCharStatus(t *testing.T) {
+	player := absmachine.Player{Name: "Bob", Health: 25, Mana: 7, Level: 3, Class: absmachine.PC_Cleric}
+
+	vitals := NewGmcpCharVitals(&player)
+	status := NewGmcpCharStatus(&player)
+
+	if vitals.Package != "Char.Vitals" || vitals.Data != (CharVitals{Hp: 25, Mana: 7}) {
+		t.Errorf("Unexpected vitals: %+v", vitals)
+	}
+
+	if status.Package != "Char.Status" || status.Data != (CharStatus{Name: "Bob", Level: 3, Class: "Cleric"}) {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+}
@@ -12,6 +12,7 @@ type commandConstructor struct {
 	shortDesc string
 	longDesc  string
 	cons      func(args []string) (Command, CommandRequirementsEvaluator)
+	exact     bool // If true, the command must be typed out in full (for commands that are dangerous to trigger by accident)
 }
 
 type CommandLine struct {
@@ -28,6 +29,7 @@ const (
 	CAT_Information   = "Information"
 	CAT_Session       = "Session"
 	CAT_Communication = "Communication"
+	CAT_Admin         = "Admin"
 )
 
 var commandConstructors = []commandConstructor{
@@ -50,7 +52,12 @@ var commandConstructors = []commandConstructor{
 	{name: "look", cons: NewCommandLook, cat: CAT_Information, shortDesc: "Allows for occular examination"},
 	{name: "who", cons: NewCommandWho, cat: CAT_Session, shortDesc: "Who's online?"},
 	{name: "quit", cons: NewCommandQuit, cat: CAT_Session, shortDesc: "For when you have to go!"},
+	{name: "color", cons: NewCommandColor, cat: CAT_Session, shortDesc: "Your colors", longDesc: "color                      shows your colors\ncolor <entry>              shows one of them\ncolor <entry> <style>      changes it, e.g: color roomtitle bold fg_#ff8800\ncolor <entry> default      changes it back"},
+	{name: "splitscreen", cons: NewCommandSplitScreen, cat: CAT_Session, shortDesc: "Keep the prompt and a status bar at the bottom of the screen", longDesc: "splitscreen                turns the split screen on or off\nsplitscreen on|off         turns it on or off\nOutput scrolls above the status bar and the prompt. Your terminal must understand VT100 escape codes, and tell its size."},
+	{name: "prompt", cons: NewCommandPrompt, cat: CAT_Session, shortDesc: "Choose what your prompt shows", longDesc: "prompt                     shows your prompt, and what it can show\nprompt <format>            changes it, e.g: prompt [%h/%m] %e>\nprompt default             changes it back"},
+	{name: "sshkey", cons: NewCommandSshKey, cat: CAT_Session, shortDesc: "Log in over SSH without a password", longDesc: "sshkey                     lists your SSH keys\nsshkey add <public key>     lets the key log in to your character over SSH, without a password\nsshkey remove <number>     removes a key"},
 	{name: "tell", cons: NewCommandTell, cat: CAT_Communication, shortDesc: "Send private messages to others"},
+	{name: "copyover", cons: NewCommandCopyover, cat: CAT_Admin, shortDesc: "Reboots the server without dropping players", exact: true},
 }
 
 type CommandParser = func(text string, player *absmachine.Player) (command Command, err error)
@@ -58,6 +65,10 @@ type CommandParser = func(text string, player *absmachine.Player) (command Comma
 func findCommandConstructor(text string) *commandConstructor {
 	cmdNameLowerCase := strings.ToLower(text)
 	for i, commandConstructor := range commandConstructors {
+		if commandConstructor.exact && commandConstructor.name != cmdNameLowerCase {
+			continue
+		}
+
 		if strings.HasPrefix(commandConstructor.name, cmdNameLowerCase) {
 			return &commandConstructors[i]
 		}
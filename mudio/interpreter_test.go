@@ -255,3 +255,17 @@ func Test_ParseArguments(t *testing.T) {
 		)
 	}
 }
+
+func Test_ParseCommand_ExactCommandNotMatchedByPrefix(t *testing.T) {
+	player := &absmachine.Player{State: absmachine.PS_LOGGED_IN}
+
+	_, err := ParseCommand("copy", player)
+	if err != ErrUnknownCommand {
+		t.Errorf("Abbreviated command generated the unexpected error: %v", err)
+	}
+
+	command, err := ParseCommand("copyover", player)
+	if _, ok := command.(*CommandCopyover); !ok || err != nil {
+		t.Errorf("Command typed in full was not parsed: %v, %v", command, err)
+	}
+}
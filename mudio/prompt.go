@@ -0,0 +1,149 @@
+package mudio
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/ansi"
+	"github.com/jorgensigvardsson/gomud/lang"
+)
+
+// Players choose what their prompt shows with a format string, in the style of CircleMUD: the tokens below are
+// replaced by what they stand for, and everything else is shown as it is, markup included (colors, attributes and
+// semantic tags, e.g. $fg_green$ or $error$, and $$ for a dollar sign).
+//
+// %h = health
+// %m = mana
+// %l = level
+// %n = name
+// %r = the title of the room
+// %e = the exits of the room, e.g. "NSU"
+// %b = "*" while a command waits for an answer, nothing otherwise
+// %t = the hour of the game day, e.g. "7pm" (the day starts at midnight when the server starts)
+// %% = a percent sign
+
+const DefaultPromptFormat = "[H:%h] [M:%m] > "
+
+const MaxPromptFormatLength = 80
+
+var ErrPromptFormatTooLong = errors.New("prompt format too long")
+var ErrInvalidPromptToken = errors.New("invalid prompt token")
+var ErrInvalidPromptMarkup = errors.New("invalid prompt markup")
+
+const promptTokens = "hmlnrebt%"
+
+// A game hour lasts 75 seconds, as in CircleMUD, with 10 ticks a second. The prompt shows whole hours only, since
+// it's drawn again whenever it changes.
+const TicksPerGameHour = 750
+
+// Checks that a prompt format only has known tokens and markup, and isn't too long
+func ValidatePromptFormat(format string) error {
+	if len(format) > MaxPromptFormatLength {
+		return ErrPromptFormatTooLong
+	}
+
+	for i := 0; i < len(format); i++ {
+		switch format[i] {
+		case '%':
+			if i+1 == len(format) || strings.IndexByte(promptTokens, format[i+1]) < 0 {
+				return ErrInvalidPromptToken
+			}
+			i++
+		case '$':
+			end := strings.IndexByte(format[i+1:], '$')
+			if end < 0 {
+				return ErrInvalidPromptMarkup
+			}
+
+			markup := format[i : i+end+2]
+			if markup != "$$" && !ansi.IsSemanticTag(markup[1:len(markup)-1]) && !ansi.IsValidStyle(markup) {
+				return ErrInvalidPromptMarkup
+			}
+			i += end + 1
+		}
+	}
+
+	return nil
+}
+
+// Renders the prompt of a player, with the player's format, or the default one. `tick` is the tick of the game loop.
+func RenderPrompt(player *absmachine.Player, tick int) string {
+	format := player.PromptFormat
+	if format == "" {
+		format = DefaultPromptFormat
+	}
+
+	var b strings.Builder
+	b.WriteString("$prompt$")
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+
+		i++
+		switch format[i] {
+		case 'h':
+			b.WriteString(strconv.Itoa(player.Health))
+		case 'm':
+			b.WriteString(strconv.Itoa(player.Mana))
+		case 'l':
+			b.WriteString(strconv.Itoa(player.Level))
+		case 'n':
+			b.WriteString(player.Name)
+		case 'r':
+			if player.Room != nil {
+				b.WriteString(ansi.Escape(player.Room.Title))
+			}
+		case 'e':
+			b.WriteString(exitLetters(player.Room))
+		case 'b':
+			if player.State.HasFlag(absmachine.PS_BUSY) {
+				b.WriteByte('*')
+			}
+		case 't':
+			b.WriteString(gameHour(tick))
+		case '%':
+			b.WriteByte('%')
+		}
+	}
+
+	return b.String()
+}
+
+// The hour of the game day at a tick of the game loop, e.g. "12am" or "7pm"
+func gameHour(tick int) string {
+	hour := tick / TicksPerGameHour % 24
+
+	suffix := "am"
+	if hour >= 12 {
+		suffix = "pm"
+	}
+
+	if hour%12 == 0 {
+		return "12" + suffix
+	}
+	return strconv.Itoa(hour%12) + suffix
+}
+
+// The first letters of the directions out of a room, or "-" if there are none
+func exitLetters(room *absmachine.Room) string {
+	if room == nil {
+		return "-"
+	}
+
+	letters := ""
+	for d, r := range room.AdjacentRooms {
+		if r != nil {
+			letters += lang.DirectionName(absmachine.Direction(d))[:1]
+		}
+	}
+
+	if letters == "" {
+		return "-"
+	}
+	return letters
+}
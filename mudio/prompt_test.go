@@ -0,0 +1,85 @@
+package mudio
+
+import (
+	"testing"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+)
+
+func Test_ValidatePromptFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		err    error
+	}{
+		{"[%h/%m] %e> ", nil},
+		{"100%% > ", nil},
+		{"%x > ", ErrInvalidPromptToken},
+		{"$fg_green$%h$reset$ $error$%m$$ > ", nil},
+		{"$fg_$%h > ", ErrInvalidPromptMarkup},
+		{"$nosuchtag$%h > ", ErrInvalidPromptMarkup},
+		{"$%h > ", ErrInvalidPromptMarkup},
+		{"$fg_%h$ > ", ErrInvalidPromptMarkup},
+		{"> %", ErrInvalidPromptToken},
+		{string(make([]byte, MaxPromptFormatLength+1)), ErrPromptFormatTooLong},
+	}
+
+	for _, test := range tests {
+		if err := ValidatePromptFormat(test.format); err != test.err {
+			t.Errorf("Format %q: expected %v, but got %v", test.format, test.err, err)
+		}
+	}
+}
+
+func Test_RenderPrompt_AllTokens(t *testing.T) {
+	room := &absmachine.Room{Title: "The $cheap$ room"}
+	room.Connect(&absmachine.Room{}, absmachine.DIR_NORTH)
+	room.Connect(&absmachine.Room{}, absmachine.DIR_UP)
+	player := &absmachine.Player{Name: "Bob", Health: 10, Mana: 5, Level: 2, Room: room, State: absmachine.PS_BUSY}
+	player.PromptFormat = "%n %l %h/%m %r %e%b %t 100%% > "
+
+	prompt := RenderPrompt(player, 19*TicksPerGameHour+10)
+
+	if prompt != "$prompt$Bob 2 10/5 The $$cheap$$ room NU* 7pm 100% > " {
+		t.Errorf("Unexpected prompt %q", prompt)
+	}
+}
+
+func Test_RenderPrompt_NoFormat_Default(t *testing.T) {
+	player := &absmachine.Player{Health: 10, Mana: 5}
+
+	prompt := RenderPrompt(player, 0)
+
+	if prompt != "$prompt$[H:10] [M:5] > " {
+		t.Errorf("Unexpected prompt %q", prompt)
+	}
+}
+
+func Test_RenderPrompt_NoExits_Dash(t *testing.T) {
+	player := &absmachine.Player{Room: &absmachine.Room{}}
+	player.PromptFormat = "%e> "
+
+	if prompt := RenderPrompt(player, 0); prompt != "$prompt$-> " {
+		t.Errorf("Unexpected prompt %q", prompt)
+	}
+}
+
+func Test_gameHour(t *testing.T) {
+	tests := []struct {
+		tick int
+		hour string
+	}{
+		{0, "12am"},
+		{TicksPerGameHour - 1, "12am"},
+		{TicksPerGameHour, "1am"},
+		{11 * TicksPerGameHour, "11am"},
+		{12 * TicksPerGameHour, "12pm"},
+		{23 * TicksPerGameHour, "11pm"},
+		{24 * TicksPerGameHour, "12am"},
+	}
+
+	for _, test := range tests {
+		if hour := gameHour(test.tick); hour != test.hour {
+			t.Errorf("Tick %v: expected %q, but got %q", test.tick, test.hour, hour)
+		}
+	}
+}
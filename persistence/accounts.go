@@ -0,0 +1,264 @@
+package persistence
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/ansi"
+	"github.com/jorgensigvardsson/gomud/charset"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	MinAccountNameLength = 2
+	MaxAccountNameLength = 20
+)
+
+var ErrAccountNotFound = errors.New("account not found")
+var ErrInvalidAccountName = errors.New("invalid account name")
+var ErrInvalidAuthorizedKey = errors.New("invalid public key")
+
+type Account struct {
+	Name         string
+	PasswordHash string // bcrypt hash, the salt is part of the hash
+	Description  string
+	Class        absmachine.PlayerClass
+	Level        int
+	Health       int
+	Mana         int
+	LastRoom     int // Virtual number of the room the player was in when the account was last saved
+	ColorTheme   map[string]string
+	SplitScreen  bool
+	PromptFormat string
+
+	AuthorizedKeys []string // Public keys (authorized_keys lines) that log in over SSH without a password
+}
+
+// Stores player accounts. An account store is meant to be used from the game loop, except for Load, which must
+// also be safe to call from other goroutines while the game loop uses the store (SSH public keys are looked up
+// while connections are set up).
+type AccountStore interface {
+	Exists(name string) bool
+	Load(name string) (*Account, error)
+	Save(account *Account) error
+}
+
+type fileAccountStore struct {
+	directory string
+}
+
+// Creates an account store which keeps one JSON file per account in `directory`. Loading is safe while accounts are
+// saved, since an account file is replaced as a whole.
+func NewFileAccountStore(directory string) (AccountStore, error) {
+	err := os.MkdirAll(directory, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileAccountStore{directory: directory}, nil
+}
+
+// Account names are restricted to letters only. Since they are used as file names
+// this also protects us from players typing in paths as their names!
+func IsValidAccountName(name string) bool {
+	length := len([]rune(name))
+	if length < MinAccountNameLength || length > MaxAccountNameLength {
+		return false
+	}
+
+	for _, r := range name {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Names are folded, so that players whose clients can't type "Åsa" can log in as "Asa"
+func (store *fileAccountStore) accountPath(name string) string {
+	return filepath.Join(store.directory, charset.Fold(name)+".json")
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (store *fileAccountStore) Exists(name string) bool {
+	if !IsValidAccountName(name) {
+		return false
+	}
+
+	return fileExists(store.accountPath(name))
+}
+
+func (store *fileAccountStore) Load(name string) (*Account, error) {
+	if !IsValidAccountName(name) {
+		return nil, ErrInvalidAccountName
+	}
+
+	data, err := os.ReadFile(store.accountPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrAccountNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	account := &Account{}
+	err = json.Unmarshal(data, account)
+	if err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+func (store *fileAccountStore) Save(account *Account) error {
+	if !IsValidAccountName(account.Name) {
+		return ErrInvalidAccountName
+	}
+
+	data, err := json.MarshalIndent(account, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that a crash never leaves a half written account behind
+	path := store.accountPath(account.Name)
+	tmpPath := path + ".tmp"
+
+	err = os.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+func (account *Account) SetPassword(password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	account.PasswordHash = hash
+	return nil
+}
+
+// Hashes a password for Account.PasswordHash. This is slow on purpose, and is best done off the game loop.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (account *Account) VerifyPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)) == nil
+}
+
+// Adds a public key, given as a line of an authorized_keys file (e.g. "ssh-ed25519 AAAA... me@laptop")
+func (account *Account) AddAuthorizedKey(line string) error {
+	key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	if err != nil {
+		return ErrInvalidAuthorizedKey
+	}
+
+	if account.IsAuthorizedKey(key) {
+		return nil
+	}
+
+	normalized := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	if comment != "" {
+		normalized += " " + comment
+	}
+
+	account.AuthorizedKeys = append(account.AuthorizedKeys, normalized)
+	return nil
+}
+
+// Removes a public key by its index in AuthorizedKeys, and tells if there was one
+func (account *Account) RemoveAuthorizedKey(index int) bool {
+	if index < 0 || index >= len(account.AuthorizedKeys) {
+		return false
+	}
+
+	account.AuthorizedKeys = append(account.AuthorizedKeys[:index], account.AuthorizedKeys[index+1:]...)
+	return true
+}
+
+func (account *Account) IsAuthorizedKey(key ssh.PublicKey) bool {
+	for _, line := range account.AuthorizedKeys {
+		authorized, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err == nil && bytes.Equal(authorized.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Copies the persisted state of the account onto a player
+func (account *Account) ApplyTo(player *absmachine.Player) {
+	player.Name = account.Name
+	player.Description = account.Description
+	player.Class = account.Class
+	player.Level = account.Level
+	player.Health = account.Health
+	player.Mana = account.Mana
+	player.ColorTheme = validColorTheme(account.ColorTheme)
+	player.SplitScreen = account.SplitScreen
+	player.PromptFormat = account.PromptFormat
+}
+
+// Leaves out what a player couldn't have put in a color theme, in case the account file was edited by hand
+func validColorTheme(theme map[string]string) map[string]string {
+	if theme == nil {
+		return nil
+	}
+
+	valid := make(map[string]string, len(theme))
+	for tag, style := range theme {
+		if ansi.IsSemanticTag(tag) && ansi.IsValidStyle(style) {
+			valid[tag] = style
+		}
+	}
+	return valid
+}
+
+// Copies the state of a player that should be persisted onto the account
+func (account *Account) UpdateFrom(player *absmachine.Player) {
+	account.Description = player.Description
+	account.Class = player.Class
+	account.Level = player.Level
+	account.Health = player.Health
+	account.Mana = player.Mana
+	account.ColorTheme = player.ColorTheme
+	account.SplitScreen = player.SplitScreen
+	account.PromptFormat = player.PromptFormat
+
+	if player.Room != nil {
+		account.LastRoom = player.Room.VNum
+	}
+}
+
+// Saves the state of a logged in player to its account
+func SavePlayer(store AccountStore, player *absmachine.Player) error {
+	account, err := store.Load(player.Name)
+	if err != nil {
+		return err
+	}
+
+	account.UpdateFrom(player)
+	return store.Save(account)
+}
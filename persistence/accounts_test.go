@@ -0,0 +1,244 @@
+package persistence
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+	"golang.org/x/crypto/ssh"
+)
+
+func Test_IsValidAccountName(t *testing.T) {
+	validNames := []string{"Bob", "al", "Åsa", "abcdefghijklmnopqrst"}
+	invalidNames := []string{"", "a", "../etc", "Bob1", "Bob Smith", "abcdefghijklmnopqrstu"}
+
+	for _, name := range validNames {
+		if !IsValidAccountName(name) {
+			t.Errorf("Expected %v to be a valid name", name)
+		}
+	}
+
+	for _, name := range invalidNames {
+		if IsValidAccountName(name) {
+			t.Errorf("Expected %v to be an invalid name", name)
+		}
+	}
+}
+
+func Test_FileAccountStore_SaveThenLoad(t *testing.T) {
+	// Arrange
+	store, err := NewFileAccountStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	account := &Account{Name: "Bob", Class: absmachine.PC_Wizard, Level: 3, Health: 10, Mana: 20, LastRoom: 3001}
+	account.ColorTheme = map[string]string{"roomtitle": "$bold$$fg_yellow$"}
+	account.SplitScreen = true
+	account.PromptFormat = "%h/%m %e> "
+	account.AuthorizedKeys = []string{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIK0wmN/Cr3JXqmLW7u+g9pTh+wyqDHpSQEIQczXkVx9q bob@home"}
+
+	// Act
+	err = store.Save(account)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	loadedAccount, err := store.Load("bob")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(loadedAccount, account) {
+		t.Errorf("Loaded account %+v differs from saved account %+v", *loadedAccount, *account)
+	}
+
+	if !store.Exists("BOB") {
+		t.Error("Account names should be case insensitive")
+	}
+}
+
+func Test_FileAccountStore_AccentsIgnored(t *testing.T) {
+	// Arrange
+	directory := t.TempDir()
+	store, _ := NewFileAccountStore(directory)
+
+	// Act
+	err := store.Save(&Account{Name: "Åsa"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	account, err := store.Load("asa")
+
+	// Assert
+	if err != nil || account.Name != "Åsa" {
+		t.Errorf("Expected to find Åsa as asa, but got %+v, error: %v", account, err)
+	}
+
+	if !fileExists(filepath.Join(directory, "asa.json")) {
+		t.Error("Account was not saved under the folded name")
+	}
+}
+
+func Test_FileAccountStore_LoadMissingAccount(t *testing.T) {
+	store, _ := NewFileAccountStore(t.TempDir())
+
+	_, err := store.Load("nobody")
+
+	if err != ErrAccountNotFound {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func Test_FileAccountStore_LoadWhileSaving_WholeAccountLoaded(t *testing.T) {
+	// Arrange
+	store, _ := NewFileAccountStore(t.TempDir())
+	store.Save(&Account{Name: "Bob", Description: strings.Repeat("x", 10000)})
+
+	done := make(chan interface{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			store.Save(&Account{Name: "Bob", Description: strings.Repeat("y", 10000+i)})
+		}
+	}()
+
+	// Act & Assert
+	for i := 0; i < 100; i++ {
+		account, err := store.Load("Bob")
+		if err != nil || len(account.Description) < 10000 {
+			t.Fatalf("Unexpected account %+v, error: %v", account, err)
+		}
+	}
+	<-done
+}
+
+func Test_FileAccountStore_LoadInvalidName(t *testing.T) {
+	store, _ := NewFileAccountStore(t.TempDir())
+
+	_, err := store.Load("../../etc/passwd")
+
+	if err != ErrInvalidAccountName {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func Test_Account_VerifyPassword(t *testing.T) {
+	account := &Account{Name: "Bob"}
+	err := account.SetPassword("secret")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if account.PasswordHash == "secret" {
+		t.Error("Password is stored in clear text!")
+	}
+
+	if !account.VerifyPassword("secret") {
+		t.Error("Correct password was not accepted")
+	}
+
+	if account.VerifyPassword("Secret") {
+		t.Error("Wrong password was accepted")
+	}
+}
+
+func Test_SavePlayer_UpdatesAccount(t *testing.T) {
+	// Arrange
+	store, _ := NewFileAccountStore(t.TempDir())
+	store.Save(&Account{Name: "Bob", PasswordHash: "hash"})
+	player := &absmachine.Player{Name: "Bob", Health: 42, Mana: 17, Level: 2, Room: &absmachine.Room{VNum: 3001}}
+
+	// Act
+	err := SavePlayer(store, player)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	account, _ := store.Load("Bob")
+	if account.Health != 42 || account.Mana != 17 || account.Level != 2 || account.LastRoom != 3001 {
+		t.Errorf("Account was not updated: %+v", *account)
+	}
+
+	if account.PasswordHash != "hash" {
+		t.Errorf("Password hash was not kept: %v", account.PasswordHash)
+	}
+}
+
+func Test_Account_ApplyTo_InvalidColorThemeEntriesLeftOut(t *testing.T) {
+	account := &Account{Name: "Bob", ColorTheme: map[string]string{
+		"error":     "$fg_c196$",
+		"exit":      "$fg_$",
+		"prompt":    "$fg_red$$$",
+		"nosuchtag": "$bold$",
+	}}
+	player := absmachine.NewPlayer()
+
+	account.ApplyTo(player)
+
+	if !reflect.DeepEqual(player.ColorTheme, map[string]string{"error": "$fg_c196$"}) {
+		t.Errorf("Unexpected color theme %v", player.ColorTheme)
+	}
+}
+
+func newTestPublicKey(t *testing.T) ssh.PublicKey {
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	key, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return key
+}
+
+func Test_Account_AddAuthorizedKey_KeyAuthorizedOnce(t *testing.T) {
+	account := &Account{Name: "Bob"}
+	key := newTestPublicKey(t)
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))) + " bob@home"
+
+	err1 := account.AddAuthorizedKey("  " + line + "\n")
+	err2 := account.AddAuthorizedKey(line)
+
+	if err1 != nil || err2 != nil {
+		t.Fatalf("Unexpected errors: %v, %v", err1, err2)
+	}
+
+	if len(account.AuthorizedKeys) != 1 || account.AuthorizedKeys[0] != line {
+		t.Errorf("Unexpected keys: %v", account.AuthorizedKeys)
+	}
+
+	if !account.IsAuthorizedKey(key) || account.IsAuthorizedKey(newTestPublicKey(t)) {
+		t.Error("Only the added key should be authorized")
+	}
+}
+
+func Test_Account_AddAuthorizedKey_NotAKey_Error(t *testing.T) {
+	account := &Account{Name: "Bob"}
+
+	if err := account.AddAuthorizedKey("ssh-ed25519 notbase64"); err != ErrInvalidAuthorizedKey {
+		t.Errorf("Expected ErrInvalidAuthorizedKey, but got %v", err)
+	}
+}
+
+func Test_Account_RemoveAuthorizedKey(t *testing.T) {
+	account := &Account{Name: "Bob"}
+	key := newTestPublicKey(t)
+	account.AddAuthorizedKey(string(ssh.MarshalAuthorizedKey(key)))
+
+	if account.RemoveAuthorizedKey(1) || !account.RemoveAuthorizedKey(0) || account.IsAuthorizedKey(key) {
+		t.Errorf("Unexpected keys after removal: %v", account.AuthorizedKeys)
+	}
+}
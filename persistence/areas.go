@@ -0,0 +1,296 @@
+package persistence
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+	"github.com/jorgensigvardsson/gomud/lang"
+)
+
+// An area file describes a part of the world. Rooms are identified by positive virtual numbers which
+// must be unique across all area files, so that exits can lead into other areas. Mobs and objects are
+// described as prototypes (with virtual numbers of their own), and are put into rooms by placements.
+type areaFile struct {
+	Name       string
+	StartRoom  int // If non-zero, this is the room new players start in. Only one area may have a start room.
+	Rooms      []areaRoom
+	Mobs       []areaMob
+	Objects    []areaObject
+	Placements []areaPlacement
+}
+
+type areaRoom struct {
+	VNum        int
+	Title       string
+	Description string
+	Exits       map[string]int // Direction name -> room virtual number
+}
+
+type areaMob struct {
+	VNum            int
+	Name            string
+	Description     string
+	RoomDescription string
+	Actions         []mobActionRecord
+}
+
+type areaObject struct {
+	VNum            int
+	Name            string
+	Description     string
+	RoomDescription string
+}
+
+// Puts `Count` instances (1 if not specified) of either a mob or an object prototype into a room
+type areaPlacement struct {
+	Mob    int
+	Object int
+	Room   int
+	Count  int
+}
+
+type AreaError struct {
+	File    string
+	Message string
+}
+
+func (e *AreaError) Error() string {
+	return fmt.Sprintf("%v: %v", e.File, e.Message)
+}
+
+func areaErrorf(file string, format string, args ...interface{}) *AreaError {
+	return &AreaError{File: file, Message: fmt.Sprintf(format, args...)}
+}
+
+func parseDirection(name string) (absmachine.Direction, bool) {
+	for direction := absmachine.Direction(0); direction < absmachine.NUM_DIR; direction++ {
+		if strings.EqualFold(lang.DirectionName(direction), name) {
+			return direction, true
+		}
+	}
+
+	return 0, false
+}
+
+// Loads all area files (*.json) in a directory and builds a world from them
+func LoadAreas(directory string) (*absmachine.World, error) {
+	paths, err := filepath.Glob(filepath.Join(directory, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no area files found in %v", directory)
+	}
+
+	sort.Strings(paths)
+
+	areas := make([]areaFile, len(paths))
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields() // Catch typos made by builders
+		err = decoder.Decode(&areas[i])
+		if err != nil {
+			return nil, areaErrorf(path, "%v", err)
+		}
+	}
+
+	return buildWorldFromAreas(paths, areas)
+}
+
+func buildWorldFromAreas(paths []string, areas []areaFile) (*absmachine.World, error) {
+	world := absmachine.NewWorld()
+	roomFiles := make(map[int]string)
+	var allRooms []*absmachine.Room
+
+	// First pass: create all rooms and prototypes, so that exits and placements may refer to them in any area
+	for i, area := range areas {
+		path := paths[i]
+
+		for _, record := range area.Rooms {
+			if record.VNum <= 0 {
+				return nil, areaErrorf(path, "room %v must have a positive virtual number", record.Title)
+			}
+
+			if otherFile, found := roomFiles[record.VNum]; found {
+				return nil, areaErrorf(path, "room %v is already defined in %v", record.VNum, otherFile)
+			}
+
+			if record.Title == "" {
+				return nil, areaErrorf(path, "room %v has no title", record.VNum)
+			}
+
+			room := absmachine.NewRoom()
+			room.VNum = record.VNum
+			room.Title = record.Title
+			room.Description = record.Description
+			roomFiles[record.VNum] = path
+			allRooms = append(allRooms, room)
+		}
+
+		for _, record := range area.Mobs {
+			if record.VNum <= 0 {
+				return nil, areaErrorf(path, "mob %v must have a positive virtual number", record.Name)
+			}
+
+			prototype := &absmachine.MobPrototype{
+				VNum:            record.VNum,
+				Name:            record.Name,
+				Description:     record.Description,
+				RoomDescription: record.RoomDescription,
+			}
+
+			for _, actionRecord := range record.Actions {
+				action, err := decodeMobAction(actionRecord)
+				if err != nil {
+					return nil, areaErrorf(path, "mob %v: %v", record.VNum, err)
+				}
+				prototype.Actions = append(prototype.Actions, action)
+			}
+
+			if lowLevelErr := world.AddMobPrototypes([]*absmachine.MobPrototype{prototype}); lowLevelErr != nil {
+				return nil, areaErrorf(path, "%v", lowLevelErr)
+			}
+		}
+
+		for _, record := range area.Objects {
+			if record.VNum <= 0 {
+				return nil, areaErrorf(path, "object %v must have a positive virtual number", record.Name)
+			}
+
+			prototype := &absmachine.ObjectPrototype{
+				VNum:            record.VNum,
+				Name:            record.Name,
+				Description:     record.Description,
+				RoomDescription: record.RoomDescription,
+			}
+
+			if lowLevelErr := world.AddObjectPrototypes([]*absmachine.ObjectPrototype{prototype}); lowLevelErr != nil {
+				return nil, areaErrorf(path, "%v", lowLevelErr)
+			}
+		}
+	}
+
+	if lowLevelErr := world.AddRooms(allRooms); lowLevelErr != nil {
+		return nil, lowLevelErr
+	}
+
+	// Second pass: connect rooms, and populate them
+	for i, area := range areas {
+		path := paths[i]
+
+		if area.StartRoom != 0 {
+			if world.StartRoom != nil {
+				return nil, areaErrorf(path, "only one area may have a start room")
+			}
+
+			world.StartRoom = world.FindRoomByVNum(area.StartRoom)
+			if world.StartRoom == nil {
+				return nil, areaErrorf(path, "start room %v does not exist", area.StartRoom)
+			}
+		}
+
+		for _, record := range area.Rooms {
+			for directionName, vnum := range record.Exits {
+				direction, ok := parseDirection(directionName)
+				if !ok {
+					return nil, areaErrorf(path, "room %v has an exit in unknown direction %v", record.VNum, directionName)
+				}
+
+				adjacentRoom := world.FindRoomByVNum(vnum)
+				if adjacentRoom == nil {
+					return nil, areaErrorf(path, "room %v has an exit %v to room %v, which does not exist", record.VNum, directionName, vnum)
+				}
+
+				if lowLevelErr := world.FindRoomByVNum(record.VNum).Connect(adjacentRoom, direction); lowLevelErr != nil {
+					return nil, areaErrorf(path, "room %v: %v", record.VNum, lowLevelErr)
+				}
+			}
+		}
+
+		for _, placement := range area.Placements {
+			err := place(world, placement)
+			if err != nil {
+				return nil, areaErrorf(path, "%v", err)
+			}
+		}
+	}
+
+	if world.StartRoom == nil {
+		return nil, fmt.Errorf("none of the areas has a start room")
+	}
+
+	return world, nil
+}
+
+// A placement puts at most this many mobs or objects into a room, which catches typos before they use up the memory
+const MaxPlacementCount = 1000
+
+func place(world *absmachine.World, placement areaPlacement) error {
+	room := world.FindRoomByVNum(placement.Room)
+	if room == nil {
+		return fmt.Errorf("placement in room %v, which does not exist", placement.Room)
+	}
+
+	if (placement.Mob == 0) == (placement.Object == 0) {
+		return fmt.Errorf("placement in room %v must place either a mob or an object", placement.Room)
+	}
+
+	if placement.Count < 0 {
+		return fmt.Errorf("placement in room %v has a negative count %v", placement.Room, placement.Count)
+	}
+
+	if placement.Count > MaxPlacementCount {
+		return fmt.Errorf("placement in room %v has a count %v, which is more than %v", placement.Room, placement.Count, MaxPlacementCount)
+	}
+
+	count := placement.Count
+	if count == 0 {
+		count = 1
+	}
+
+	for n := 0; n < count; n++ {
+		if placement.Mob != 0 {
+			prototype := world.MobPrototypes[placement.Mob]
+			if prototype == nil {
+				return fmt.Errorf("placement of mob %v, which does not exist", placement.Mob)
+			}
+
+			mob := absmachine.NewMobFromPrototype(prototype)
+			if lowLevelErr := world.AddMobs([]*absmachine.Mob{mob}); lowLevelErr != nil {
+				return lowLevelErr
+			}
+
+			if lowLevelErr := mob.RelocateToRoom(room); lowLevelErr != nil {
+				return lowLevelErr
+			}
+		} else {
+			prototype := world.ObjectPrototypes[placement.Object]
+			if prototype == nil {
+				return fmt.Errorf("placement of object %v, which does not exist", placement.Object)
+			}
+
+			object := absmachine.NewObjectFromPrototype(prototype)
+			if lowLevelErr := world.AddObjects([]*absmachine.Object{object}); lowLevelErr != nil {
+				return lowLevelErr
+			}
+
+			if lowLevelErr := object.RelocateToRoom(room); lowLevelErr != nil {
+				return lowLevelErr
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package persistence
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+)
+
+func writeAreaFiles(t *testing.T, areas ...string) string {
+	directory := t.TempDir()
+
+	for i, area := range areas {
+		path := filepath.Join(directory, string(rune('a'+i))+".json")
+		if err := os.WriteFile(path, []byte(area), 0600); err != nil {
+			t.Fatalf("Failed to write area file: %v", err)
+		}
+	}
+
+	return directory
+}
+
+func Test_LoadAreas_ShippedAreas(t *testing.T) {
+	world, err := LoadAreas("../areas")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if world.StartRoom == nil || len(world.Rooms) == 0 {
+		t.Error("World has no rooms")
+	}
+}
+
+func Test_LoadAreas_ExitsAcrossAreas(t *testing.T) {
+	// Arrange
+	directory := writeAreaFiles(
+		t,
+		`{"StartRoom": 1, "Rooms": [{"VNum": 1, "Title": "One", "Exits": {"east": 2}}],
+		  "Objects": [{"VNum": 1, "Name": "Rock"}]}`,
+		`{"Rooms": [{"VNum": 2, "Title": "Two", "Exits": {"West": 1}}],
+		  "Mobs": [{"VNum": 1, "Name": "Cow", "Actions": [{"PeriodLength": 5, "Probability": 1, "Type": "SimpleVerb", "Parameters": {"Verb": "mooing"}}]}],
+		  "Placements": [{"Mob": 1, "Room": 2, "Count": 2}, {"Object": 1, "Room": 1}]}`,
+	)
+
+	// Act
+	world, err := LoadAreas(directory)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(world.Rooms) != 2 {
+		t.Fatalf("Unexpected rooms: %v", world.Rooms)
+	}
+
+	one, two := world.Rooms[0], world.Rooms[1]
+	if world.StartRoom != one || one.AdjacentRooms[absmachine.DIR_EAST] != two || two.AdjacentRooms[absmachine.DIR_WEST] != one {
+		t.Error("Rooms are not connected as expected")
+	}
+
+	if len(two.Mobs) != 2 || len(two.Mobs[0].Actions) != 1 || two.Mobs[0].Prototype != world.MobPrototypes[1] {
+		t.Error("Mobs were not placed with their actions")
+	}
+
+	if two.Mobs[0].Id == two.Mobs[1].Id {
+		t.Error("Mob instances share the same id")
+	}
+
+	if len(one.Objects) != 1 {
+		t.Error("Object was not placed")
+	}
+}
+
+func Test_LoadAreas_ValidationErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		area          string
+		expectedError string
+	}{
+		{"unknown exit", `{"StartRoom": 1, "Rooms": [{"VNum": 1, "Title": "One", "Exits": {"north": 9}}]}`, "does not exist"},
+		{"unknown direction", `{"StartRoom": 1, "Rooms": [{"VNum": 1, "Title": "One", "Exits": {"sideways": 1}}]}`, "unknown direction"},
+		{"duplicate room", `{"StartRoom": 1, "Rooms": [{"VNum": 1, "Title": "One"}, {"VNum": 1, "Title": "Uno"}]}`, "already defined"},
+		{"no start room", `{"Rooms": [{"VNum": 1, "Title": "One"}]}`, "start room"},
+		{"duplicate mob", `{"StartRoom": 1, "Rooms": [{"VNum": 1, "Title": "One"}], "Mobs": [{"VNum": 1, "Name": "Cow"}, {"VNum": 1, "Name": "Bull"}]}`, "already in use"},
+		{"mob in unknown room", `{"StartRoom": 1, "Rooms": [{"VNum": 1, "Title": "One"}], "Mobs": [{"VNum": 1, "Name": "Cow"}], "Placements": [{"Mob": 1, "Room": 2}]}`, "does not exist"},
+		{"unknown mob placed", `{"StartRoom": 1, "Rooms": [{"VNum": 1, "Title": "One"}], "Placements": [{"Mob": 5, "Room": 1}]}`, "does not exist"},
+		{"negative count", `{"StartRoom": 1, "Rooms": [{"VNum": 1, "Title": "One"}], "Mobs": [{"VNum": 1, "Name": "Cow"}], "Placements": [{"Mob": 1, "Room": 1, "Count": -1}]}`, "negative count"},
+		{"count too large", `{"StartRoom": 1, "Rooms": [{"VNum": 1, "Title": "One"}], "Mobs": [{"VNum": 1, "Name": "Cow"}], "Placements": [{"Mob": 1, "Room": 1, "Count": 100000000}]}`, "more than 1000"},
+		{"empty placement", `{"StartRoom": 1, "Rooms": [{"VNum": 1, "Title": "One"}], "Placements": [{"Room": 1}]}`, "either a mob or an object"},
+		{"unknown mob action", `{"StartRoom": 1, "Rooms": [{"VNum": 1, "Title": "One"}], "Mobs": [{"VNum": 1, "Name": "Cow", "Actions": [{"PeriodLength": 1, "Type": "Dance"}]}]}`, "unknown mob action type"},
+		{"zero period length", `{"StartRoom": 1, "Rooms": [{"VNum": 1, "Title": "One"}], "Mobs": [{"VNum": 1, "Name": "Cow", "Actions": [{"PeriodLength": 0, "Type": "SimpleVerb", "Parameters": {"Verb": "mooing"}}]}]}`, "period length 0 is not positive"},
+		{"typo", `{"StartRoom": 1, "Roms": []}`, "unknown field"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := LoadAreas(writeAreaFiles(t, testCase.area))
+
+			if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+				t.Errorf("Expected error containing %q, got: %v", testCase.expectedError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,408 @@
+package persistence
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+)
+
+// Bump this whenever the snapshot format changes in a way older code can't read
+const SnapshotVersion = 3
+
+// Rooms are referenced by their virtual numbers, which are never zero in a world
+const noRoom = 0
+
+var ErrUnsupportedSnapshotVersion = errors.New("unsupported world snapshot version")
+
+// The on-disk representation of the state of a world. Rooms and prototypes are static content, which always comes
+// from the area files, so only what changes while the game runs is saved. All references to static content are stored
+// as virtual numbers (rooms, prototypes).
+type worldSnapshot struct {
+	Version int
+	Mobs    []mobRecord
+	Objects []objectRecord
+	Players []playerRecord
+}
+
+type mobActionRecord struct {
+	PeriodLength int
+	Probability  float32
+	Type         string
+	Parameters   json.RawMessage
+}
+
+// Mobs made from a prototype are made from it again when they are restored, so only mobs without one have their
+// description saved
+type mobRecord struct {
+	Id              int
+	Prototype       int // Virtual number of the prototype, or 0 if the mob has none
+	Room            int
+	Name            string            `json:",omitempty"`
+	Description     string            `json:",omitempty"`
+	RoomDescription string            `json:",omitempty"`
+	Actions         []mobActionRecord `json:",omitempty"`
+}
+
+type objectRecord struct {
+	Id              int
+	Prototype       int // Virtual number of the prototype, or 0 if the object has none
+	Room            int
+	Name            string `json:",omitempty"`
+	Description     string `json:",omitempty"`
+	RoomDescription string `json:",omitempty"`
+}
+
+type playerRecord struct {
+	Name         string
+	Description  string
+	Health       int
+	Mana         int
+	Level        int
+	State        absmachine.PlayerState
+	Class        absmachine.PlayerClass
+	Room         int
+	ColorTheme   map[string]string
+	SplitScreen  bool
+	PromptFormat string
+}
+
+const mobActionTypeSimpleVerb = "SimpleVerb"
+
+func encodeMobAction(action absmachine.MobAction) (mobActionRecord, error) {
+	record := mobActionRecord{
+		PeriodLength: action.PeriodLength,
+		Probability:  action.Probability,
+	}
+
+	switch function := action.Function.(type) {
+	case *absmachine.SimpleVerbMobAction:
+		record.Type = mobActionTypeSimpleVerb
+	default:
+		return record, fmt.Errorf("mob action function of type %T can't be saved", function)
+	}
+
+	parameters, err := json.Marshal(action.Function)
+	if err != nil {
+		return record, err
+	}
+
+	record.Parameters = parameters
+	return record, nil
+}
+
+func decodeMobAction(record mobActionRecord) (absmachine.MobAction, error) {
+	action := absmachine.MobAction{
+		PeriodLength: record.PeriodLength,
+		Probability:  record.Probability,
+	}
+
+	// The mob action runner divides by the period length
+	if record.PeriodLength <= 0 {
+		return action, fmt.Errorf("mob action period length %v is not positive", record.PeriodLength)
+	}
+
+	if record.Probability < 0 || record.Probability > 1 {
+		return action, fmt.Errorf("mob action probability %v is not between 0 and 1", record.Probability)
+	}
+
+	switch record.Type {
+	case mobActionTypeSimpleVerb:
+		function := &absmachine.SimpleVerbMobAction{}
+		decoder := json.NewDecoder(bytes.NewReader(record.Parameters))
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(function)
+		if err != nil {
+			return action, err
+		}
+		action.Function = function
+	default:
+		return action, fmt.Errorf("unknown mob action type %v", record.Type)
+	}
+
+	return action, nil
+}
+
+func encodeMobActions(actions []absmachine.MobAction) ([]mobActionRecord, error) {
+	var records []mobActionRecord
+
+	for _, action := range actions {
+		record, err := encodeMobAction(action)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func decodeMobActions(records []mobActionRecord) ([]absmachine.MobAction, error) {
+	var actions []absmachine.MobAction
+
+	for _, record := range records {
+		action, err := decodeMobAction(record)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+
+	return actions, nil
+}
+
+// Writes the state of the world to a file. Players are only included for a copyover, when their connections live on in
+// the next process; otherwise they are kept in their accounts.
+func SaveWorld(world *absmachine.World, path string, withPlayers bool) error {
+	roomVNum := func(room *absmachine.Room) (int, error) {
+		if room == nil {
+			return noRoom, nil
+		}
+
+		if room.World != world {
+			return noRoom, fmt.Errorf("room %v is referenced, but is not part of the world", room.Title)
+		}
+
+		return room.VNum, nil
+	}
+
+	snapshot := worldSnapshot{Version: SnapshotVersion}
+
+	var err error
+	for _, mob := range world.Mobs {
+		record := mobRecord{Id: mob.Id}
+
+		if mob.Prototype != nil {
+			record.Prototype = mob.Prototype.VNum
+		} else {
+			record.Name = mob.Name
+			record.Description = mob.Description
+			record.RoomDescription = mob.RoomDescription
+
+			record.Actions, err = encodeMobActions(mob.Actions)
+			if err != nil {
+				return err
+			}
+		}
+
+		record.Room, err = roomVNum(mob.Room)
+		if err != nil {
+			return err
+		}
+
+		snapshot.Mobs = append(snapshot.Mobs, record)
+	}
+
+	for _, object := range world.Objects {
+		record := objectRecord{Id: object.Id}
+
+		if object.Prototype != nil {
+			record.Prototype = object.Prototype.VNum
+		} else {
+			record.Name = object.Name
+			record.Description = object.Description
+			record.RoomDescription = object.RoomDescription
+		}
+
+		record.Room, err = roomVNum(object.Room)
+		if err != nil {
+			return err
+		}
+
+		snapshot.Objects = append(snapshot.Objects, record)
+	}
+
+	if withPlayers {
+		for _, player := range world.Players {
+			record := playerRecord{
+				Name:         player.Name,
+				Description:  player.Description,
+				Health:       player.Health,
+				Mana:         player.Mana,
+				Level:        player.Level,
+				State:        player.State,
+				Class:        player.Class,
+				ColorTheme:   player.ColorTheme,
+				SplitScreen:  player.SplitScreen,
+				PromptFormat: player.PromptFormat,
+			}
+
+			record.Room, err = roomVNum(player.Room)
+			if err != nil {
+				return err
+			}
+
+			snapshot.Players = append(snapshot.Players, record)
+		}
+	}
+
+	data, err := json.MarshalIndent(&snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that a crash never leaves a half written snapshot behind
+	tmpPath := path + ".tmp"
+	err = os.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// Restores the state saved by SaveWorld into a world built from the area files. The mobs and objects the areas placed
+// are replaced by the ones in the snapshot, unless `withMobsAndObjects` is false (e.g. when the placements in the
+// areas have changed since the snapshot was saved). The areas may also have changed in other ways: mobs and objects
+// whose prototype or room is gone are left out, and players whose room is gone are put in the start room.
+func RestoreWorld(world *absmachine.World, path string, withMobsAndObjects bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	snapshot := worldSnapshot{}
+	err = json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return err
+	}
+
+	if snapshot.Version != SnapshotVersion {
+		return fmt.Errorf("%w: %v", ErrUnsupportedSnapshotVersion, snapshot.Version)
+	}
+
+	// Decode everything before the world is touched, so that a broken snapshot leaves the world as the areas built it
+	mobs := make([]*absmachine.Mob, 0, len(snapshot.Mobs))
+	mobRooms := make([]*absmachine.Room, 0, len(snapshot.Mobs))
+	objects := make([]*absmachine.Object, 0, len(snapshot.Objects))
+	objectRooms := make([]*absmachine.Room, 0, len(snapshot.Objects))
+
+	if withMobsAndObjects {
+		for _, record := range snapshot.Mobs {
+			room := world.FindRoomByVNum(record.Room)
+			if room == nil && record.Room != noRoom {
+				continue
+			}
+
+			var mob *absmachine.Mob
+			if record.Prototype != 0 {
+				prototype := world.MobPrototypes[record.Prototype]
+				if prototype == nil {
+					continue
+				}
+				mob = absmachine.NewMobFromPrototype(prototype)
+			} else {
+				mob = absmachine.NewMob()
+				mob.Name = record.Name
+				mob.Description = record.Description
+				mob.RoomDescription = record.RoomDescription
+
+				mob.Actions, err = decodeMobActions(record.Actions)
+				if err != nil {
+					return fmt.Errorf("mob %v: %w", record.Id, err)
+				}
+			}
+
+			mob.Id = record.Id
+			mobs = append(mobs, mob)
+			mobRooms = append(mobRooms, room)
+		}
+
+		for _, record := range snapshot.Objects {
+			room := world.FindRoomByVNum(record.Room)
+			if room == nil && record.Room != noRoom {
+				continue
+			}
+
+			var object *absmachine.Object
+			if record.Prototype != 0 {
+				prototype := world.ObjectPrototypes[record.Prototype]
+				if prototype == nil {
+					continue
+				}
+				object = absmachine.NewObjectFromPrototype(prototype)
+			} else {
+				object = absmachine.NewObject()
+				object.Name = record.Name
+				object.Description = record.Description
+				object.RoomDescription = record.RoomDescription
+			}
+
+			object.Id = record.Id
+			objects = append(objects, object)
+			objectRooms = append(objectRooms, room)
+		}
+
+		for _, mob := range append([]*absmachine.Mob(nil), world.Mobs...) {
+			absmachine.DestroyMob(mob)
+		}
+
+		for _, object := range append([]*absmachine.Object(nil), world.Objects...) {
+			absmachine.DestroyObject(object)
+		}
+
+		if lowLevelErr := world.AddMobs(mobs); lowLevelErr != nil {
+			return lowLevelErr
+		}
+
+		for i, mob := range mobs {
+			if err := relocate(mob, mobRooms[i]); err != nil {
+				return err
+			}
+		}
+
+		if lowLevelErr := world.AddObjects(objects); lowLevelErr != nil {
+			return lowLevelErr
+		}
+
+		for i, object := range objects {
+			if err := relocate(object, objectRooms[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, record := range snapshot.Players {
+		player := absmachine.NewPlayer()
+		player.Name = record.Name
+		player.Description = record.Description
+		player.Health = record.Health
+		player.Mana = record.Mana
+		player.Level = record.Level
+		player.State = record.State
+		player.Class = record.Class
+		player.ColorTheme = record.ColorTheme
+		player.SplitScreen = record.SplitScreen
+		player.PromptFormat = record.PromptFormat
+
+		if lowLevelErr := world.AddPlayers([]*absmachine.Player{player}); lowLevelErr != nil {
+			return lowLevelErr
+		}
+
+		room := world.FindRoomByVNum(record.Room)
+		if room == nil && record.Room != noRoom {
+			room = world.StartRoom
+		}
+
+		if err := relocate(player, room); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func relocate(relocatable absmachine.RelocatableToRoom, room *absmachine.Room) error {
+	if room == nil {
+		return nil
+	}
+
+	if lowLevelErr := relocatable.RelocateToRoom(room); lowLevelErr != nil {
+		return lowLevelErr
+	}
+
+	return nil
+}
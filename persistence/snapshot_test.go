@@ -0,0 +1,237 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jorgensigvardsson/gomud/absmachine"
+)
+
+func buildTestWorld() *absmachine.World {
+	world := absmachine.NewWorld()
+	room1 := &absmachine.Room{VNum: 3001, Title: "Room 1", Description: "The first room"}
+	room2 := &absmachine.Room{VNum: 3002, Title: "Room 2", Description: "The second room"}
+	room1.ConnectDuplex(room2, absmachine.DIR_EAST)
+	room1.ExitDetails[absmachine.DIR_EAST] = &absmachine.ExitDetails{Keywords: "door", Flags: absmachine.EX_DOOR, KeyVNum: 42}
+	world.AddRooms([]*absmachine.Room{room1, room2})
+	world.StartRoom = room1
+
+	spider := &absmachine.MobPrototype{
+		VNum:            10,
+		Name:            "Spider",
+		Description:     "Hairy",
+		RoomDescription: "A spider is here.",
+		Actions: []absmachine.MobAction{
+			{PeriodLength: 20, Probability: 0.5, Function: &absmachine.SimpleVerbMobAction{Verb: "jumping", Preposition: "around"}},
+		},
+	}
+	world.AddMobPrototypes([]*absmachine.MobPrototype{spider})
+	mob := absmachine.NewMobFromPrototype(spider)
+	world.AddMobs([]*absmachine.Mob{mob})
+	mob.RelocateToRoom(room2)
+
+	object := &absmachine.Object{Name: "Rock", Description: "A rock"}
+	world.AddObjects([]*absmachine.Object{object})
+	object.RelocateToRoom(room1)
+
+	player := &absmachine.Player{Name: "Bob", Health: 10, Mana: 5, Level: 2, Class: absmachine.PC_Thief, State: absmachine.PS_STANDING}
+	player.ColorTheme = map[string]string{"error": "$fg_c196$"}
+	player.SplitScreen = true
+	player.PromptFormat = "%h/%m %e> "
+	world.AddPlayers([]*absmachine.Player{player})
+	player.RelocateToRoom(room2)
+
+	return world
+}
+
+func Test_SaveWorld_RestoreWorld_RoundTrip(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "world.json")
+	original := buildTestWorld()
+	original.Mobs[0].RelocateToRoom(original.Rooms[0])
+	original.Objects[0].Name = "Pebble" // Objects without a prototype are saved as they are
+
+	// Act
+	err := SaveWorld(original, path, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	world := buildTestWorld()
+	absmachine.DestroyPlayer(world.Players[0]) // Players are only in the world while they are logged in
+	err = RestoreWorld(world, path, true)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(world.Rooms) != 2 || len(world.Mobs) != 1 || len(world.Objects) != 1 || len(world.Players) != 1 {
+		t.Fatalf("Unexpected world contents: %+v", *world)
+	}
+
+	room1, room2 := world.Rooms[0], world.Rooms[1]
+
+	mob := world.Mobs[0]
+	if mob.Id != original.Mobs[0].Id || mob.Prototype != world.MobPrototypes[10] || world.FindMobById(mob.Id) != mob {
+		t.Error("Mob prototype or id was not restored")
+	}
+
+	if mob.Room != room1 || len(room1.Mobs) != 1 || room1.Mobs[0] != mob || len(room2.Mobs) != 0 || mob.World != world {
+		t.Error("Mob was not placed in its room")
+	}
+
+	if len(mob.Actions) != 1 {
+		t.Fatalf("Mob actions were not restored: %+v", mob.Actions)
+	}
+
+	object := world.Objects[0]
+	if object.Name != "Pebble" || object.Room != room1 || len(room1.Objects) != 1 {
+		t.Errorf("Unexpected object: %+v", *object)
+	}
+
+	player := world.Players[0]
+	if player.Name != "Bob" || player.Room != room2 || player.Class != absmachine.PC_Thief || player.Health != 10 || player.ColorTheme["error"] != "$fg_c196$" || !player.SplitScreen || player.PromptFormat != "%h/%m %e> " {
+		t.Errorf("Unexpected player: %+v", *player)
+	}
+}
+
+func Test_RestoreWorld_PrototypeChanged_MobsMadeFromNewPrototype(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "world.json")
+	SaveWorld(buildTestWorld(), path, false)
+
+	world := buildTestWorld()
+	world.MobPrototypes[10].Description = "Very hairy"
+
+	// Act
+	err := RestoreWorld(world, path, true)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(world.Mobs) != 1 || world.Mobs[0].Description != "Very hairy" {
+		t.Errorf("Mob was not made from the new prototype: %+v", world.Mobs)
+	}
+}
+
+func Test_RestoreWorld_WithoutMobsAndObjects_PlacementsKept(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "world.json")
+	original := buildTestWorld()
+	original.Mobs[0].RelocateToRoom(original.Rooms[0])
+	SaveWorld(original, path, false)
+
+	world := buildTestWorld()
+	mob := world.Mobs[0]
+
+	// Act
+	err := RestoreWorld(world, path, false)
+
+	// Assert
+	if err != nil || len(world.Mobs) != 1 || world.Mobs[0] != mob || mob.Room != world.Rooms[1] {
+		t.Errorf("Placed mob was not kept: %+v (%v)", world.Mobs, err)
+	}
+}
+
+func Test_RestoreWorld_ContentGone_LeftOut(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "world.json")
+	data, _ := json.Marshal(worldSnapshot{
+		Version: SnapshotVersion,
+		Mobs:    []mobRecord{{Id: 1, Prototype: 99, Room: 3001}, {Id: 2, Prototype: 10, Room: 3001}},
+		Objects: []objectRecord{{Id: 1, Name: "Rock", Room: 7}},
+		Players: []playerRecord{{Name: "Alice", Room: 7}},
+	})
+	os.WriteFile(path, data, 0600)
+	world := buildTestWorld()
+
+	// Act
+	err := RestoreWorld(world, path, true)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(world.Mobs) != 1 || world.Mobs[0].Id != 2 || len(world.Objects) != 0 {
+		t.Errorf("Mobs and objects whose prototype or room is gone were restored: %+v %+v", world.Mobs, world.Objects)
+	}
+
+	if player := world.FindPlayerByName("Alice"); player == nil || player.Room != world.StartRoom {
+		t.Errorf("Player whose room is gone was not put in the start room: %+v", player)
+	}
+}
+
+func Test_RestoreWorld_InvalidMobAction(t *testing.T) {
+	testCases := []struct {
+		name   string
+		action mobActionRecord
+	}{
+		{"unknown parameter", mobActionRecord{PeriodLength: 10, Probability: 0.5, Type: mobActionTypeSimpleVerb, Parameters: json.RawMessage(`{"Verb": "jumping", "Verbb": "around"}`)}},
+		{"probability above 1", mobActionRecord{PeriodLength: 10, Probability: 1.5, Type: mobActionTypeSimpleVerb, Parameters: json.RawMessage(`{"Verb": "jumping"}`)}},
+		{"negative probability", mobActionRecord{PeriodLength: 10, Probability: -0.5, Type: mobActionTypeSimpleVerb, Parameters: json.RawMessage(`{"Verb": "jumping"}`)}},
+		{"zero period length", mobActionRecord{PeriodLength: 0, Probability: 0.5, Type: mobActionTypeSimpleVerb, Parameters: json.RawMessage(`{"Verb": "jumping"}`)}},
+		{"negative period length", mobActionRecord{PeriodLength: -10, Probability: 0.5, Type: mobActionTypeSimpleVerb, Parameters: json.RawMessage(`{"Verb": "jumping"}`)}},
+		{"unknown type", mobActionRecord{PeriodLength: 10, Probability: 0.5, Type: "Dance", Parameters: json.RawMessage(`{}`)}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			// Arrange
+			path := filepath.Join(t.TempDir(), "world.json")
+			data, _ := json.Marshal(worldSnapshot{
+				Version: SnapshotVersion,
+				Mobs:    []mobRecord{{Id: 1, Name: "Frog", Room: 3001, Actions: []mobActionRecord{testCase.action}}},
+			})
+			os.WriteFile(path, data, 0600)
+			world := buildTestWorld()
+			mob := world.Mobs[0]
+
+			// Act
+			err := RestoreWorld(world, path, true)
+
+			// Assert
+			if err == nil {
+				t.Error("Expected an error")
+			}
+
+			if len(world.Mobs) != 1 || world.Mobs[0] != mob {
+				t.Error("World was changed by a broken snapshot")
+			}
+		})
+	}
+}
+
+func Test_RestoreWorld_UnsupportedVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "world.json")
+	data, _ := json.Marshal(worldSnapshot{Version: SnapshotVersion + 1})
+	os.WriteFile(path, data, 0600)
+
+	err := RestoreWorld(buildTestWorld(), path, true)
+
+	if !errors.Is(err, ErrUnsupportedSnapshotVersion) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func Test_SaveWorld_WithoutPlayers_NoPlayersLoaded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "world.json")
+
+	err := SaveWorld(buildTestWorld(), path, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	world := buildTestWorld()
+	err = RestoreWorld(world, path, true)
+
+	if err != nil || len(world.Players) != 1 || len(world.Rooms[1].Players) != 1 {
+		t.Errorf("Expected only the player of the world, but got %+v (%v)", world.Players, err)
+	}
+}